@@ -0,0 +1,3 @@
+// Package acme solves ACME DNS-01 challenges using domains managed by
+// DigitalOcean.
+package acme
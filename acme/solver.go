@@ -0,0 +1,232 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+const (
+	challengeLabel = "_acme-challenge"
+
+	// DefaultTTL is the TTL of challenge records when none is set.
+	DefaultTTL = 30
+
+	defaultPropagationTimeout = 2 * time.Minute
+	defaultPollInterval       = 5 * time.Second
+)
+
+// TXTResolver looks up TXT records. It is used to check that a challenge
+// record is being served before the ACME server is asked to validate it.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NewResolver returns a TXTResolver that queries the DNS server at addr,
+// given as host:port.
+func NewResolver(addr string) TXTResolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// ChallengeValue returns the TXT record value for a DNS-01 key
+// authorization.
+func ChallengeValue(keyAuth string) string {
+	sum := sha256.Sum256([]byte(keyAuth))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Solver creates and removes DNS-01 challenge records. It is safe for
+// concurrent use, including several challenges for the same name.
+type Solver struct {
+	Client *godo.Client
+
+	// TTL of the challenge records. DefaultTTL is used when it is zero.
+	TTL int
+
+	// Resolver, when set, is polled after a record is created until it
+	// serves the challenge value.
+	Resolver TXTResolver
+
+	// PropagationTimeout and PollInterval control the wait for the
+	// Resolver.
+	PropagationTimeout time.Duration
+	PollInterval       time.Duration
+
+	mu      sync.Mutex
+	records map[challengeKey][]createdRecord
+}
+
+type challengeKey struct {
+	fqdn, value string
+}
+
+type createdRecord struct {
+	domain string
+	id     int
+}
+
+// NewSolver returns a Solver using the given client.
+func NewSolver(client *godo.Client) *Solver {
+	return &Solver{Client: client}
+}
+
+// FindDomain returns the managed domain that owns fqdn, choosing the
+// longest matching suffix.
+func (s *Solver) FindDomain(ctx context.Context, fqdn string) (string, error) {
+	fqdn = normalize(fqdn)
+
+	best := ""
+	opt := &godo.ListOptions{}
+	for {
+		domains, resp, err := s.Client.Domains.List(ctx, opt)
+		if err != nil {
+			return "", err
+		}
+
+		for _, d := range domains {
+			name := normalize(d.Name)
+			if (fqdn == name || strings.HasSuffix(fqdn, "."+name)) && len(name) > len(best) {
+				best = name
+			}
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return "", err
+		}
+
+		opt.Page = page + 1
+	}
+
+	if best == "" {
+		return "", fmt.Errorf("no managed domain owns %s", fqdn)
+	}
+	return best, nil
+}
+
+// Present creates the challenge record for fqdn with the given value, as
+// returned by ChallengeValue. When a Resolver is set it waits until the
+// record is served.
+func (s *Solver) Present(ctx context.Context, fqdn, value string) error {
+	fqdn = challengeFQDN(fqdn)
+
+	domain, err := s.FindDomain(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	name := challengeLabel
+	if fqdn != domain {
+		name += "." + strings.TrimSuffix(fqdn, "."+domain)
+	}
+
+	record, _, err := s.Client.Domains.CreateRecord(ctx, domain, &godo.DomainRecordEditRequest{
+		Type: "TXT",
+		Name: name,
+		Data: value,
+		TTL:  ttl,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.records == nil {
+		s.records = make(map[challengeKey][]createdRecord)
+	}
+	k := challengeKey{fqdn, value}
+	s.records[k] = append(s.records[k], createdRecord{domain: domain, id: record.ID})
+	s.mu.Unlock()
+
+	if s.Resolver == nil {
+		return nil
+	}
+	return s.waitForRecord(ctx, challengeLabel+"."+fqdn, value)
+}
+
+// CleanUp removes the challenge record created by Present for fqdn and
+// value. Records created for other values, or by anyone else, are left in
+// place.
+func (s *Solver) CleanUp(ctx context.Context, fqdn, value string) error {
+	k := challengeKey{challengeFQDN(fqdn), value}
+
+	s.mu.Lock()
+	records := s.records[k]
+	if len(records) == 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("no challenge record was created for %s", k.fqdn)
+	}
+	record := records[len(records)-1]
+	if len(records) == 1 {
+		delete(s.records, k)
+	} else {
+		s.records[k] = records[:len(records)-1]
+	}
+	s.mu.Unlock()
+
+	_, err := s.Client.Domains.DeleteRecord(ctx, record.domain, record.id)
+	return err
+}
+
+func (s *Solver) waitForRecord(ctx context.Context, name, value string) error {
+	timeout := s.PropagationTimeout
+	if timeout == 0 {
+		timeout = defaultPropagationTimeout
+	}
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		values, err := s.Resolver.LookupTXT(ctx, name)
+		if err == nil {
+			for _, v := range values {
+				if v == value {
+					return nil
+				}
+			}
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("challenge record %s was not served within %s", name, timeout)
+		}
+	}
+}
+
+// challengeFQDN returns the name whose challenge record validates fqdn. A
+// wildcard name is validated at its base name.
+func challengeFQDN(fqdn string) string {
+	return strings.TrimPrefix(normalize(fqdn), "*.")
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,219 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+var (
+	mux *http.ServeMux
+
+	ctx = context.TODO()
+
+	client *godo.Client
+
+	server *httptest.Server
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = godo.NewClient(nil)
+	url, _ := url.Parse(server.URL)
+	client.BaseURL = url
+
+	mux.HandleFunc("/v2/domains", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"domains": [{"name": "example.com"}, {"name": "internal.example.com"}, {"name": "example.org"}]}`)
+	})
+}
+
+func teardown() {
+	server.Close()
+}
+
+type stubResolver struct {
+	mu      sync.Mutex
+	lookups int
+	values  map[string][]string
+}
+
+func (r *stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	// The record only shows up on the second lookup.
+	if r.lookups < 2 {
+		return nil, nil
+	}
+	return r.values[name], nil
+}
+
+func TestSolver_FindDomain(t *testing.T) {
+	setup()
+	defer teardown()
+
+	s := NewSolver(client)
+	tests := map[string]string{
+		"host.internal.example.com.": "internal.example.com",
+		"www.example.com":            "example.com",
+		"EXAMPLE.org":                "example.org",
+	}
+	for fqdn, expected := range tests {
+		domain, err := s.FindDomain(ctx, fqdn)
+		if err != nil {
+			t.Errorf("FindDomain(%q) returned error: %v", fqdn, err)
+		}
+		if domain != expected {
+			t.Errorf("FindDomain(%q) = %q, expected %q", fqdn, domain, expected)
+		}
+	}
+
+	if _, err := s.FindDomain(ctx, "example.net"); err == nil {
+		t.Error("FindDomain expected an error for an unmanaged name")
+	}
+}
+
+func TestSolver_PresentAndCleanUp(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var mu sync.Mutex
+	nextID := 0
+	var deleted []string
+	mux.HandleFunc("/v2/domains/internal.example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		v := godo.DomainRecordEditRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		expected := godo.DomainRecordEditRequest{Type: "TXT", Name: "_acme-challenge.host", Data: v.Data, TTL: DefaultTTL}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("Request body\n got=%#v\nwant=%#v", v, expected)
+		}
+		mu.Lock()
+		nextID++
+		fmt.Fprintf(w, `{"domain_record": {"id": %d, "data": %q}}`, nextID, v.Data)
+		mu.Unlock()
+	})
+	mux.HandleFunc("/v2/domains/internal.example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("Request method = %v, expected %v", r.Method, http.MethodDelete)
+		}
+		mu.Lock()
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/domains/internal.example.com/records/"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	resolver := &stubResolver{values: map[string][]string{
+		"_acme-challenge.host.internal.example.com": {"value-a", "value-b"},
+	}}
+	s := &Solver{Client: client, Resolver: resolver, PollInterval: time.Millisecond}
+
+	var wg sync.WaitGroup
+	for _, v := range []string{"value-a", "value-b"} {
+		wg.Add(1)
+		go func(v string) {
+			defer wg.Done()
+			if err := s.Present(ctx, "host.internal.example.com", v); err != nil {
+				t.Errorf("Present returned error: %v", err)
+			}
+		}(v)
+	}
+	wg.Wait()
+
+	// Remember which record holds value-a so that exactly that one is
+	// expected to be removed.
+	s.mu.Lock()
+	idA := s.records[challengeKey{"host.internal.example.com", "value-a"}][0].id
+	s.mu.Unlock()
+
+	if err := s.CleanUp(ctx, "host.internal.example.com.", "value-a"); err != nil {
+		t.Fatalf("CleanUp returned error: %v", err)
+	}
+	if expected := []string{fmt.Sprint(idA)}; !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("CleanUp deleted %v, expected %v", deleted, expected)
+	}
+
+	if err := s.CleanUp(ctx, "host.internal.example.com", "value-a"); err == nil {
+		t.Error("CleanUp expected an error for a record that was already removed")
+	}
+
+	if err := s.CleanUp(ctx, "host.internal.example.com", "value-b"); err != nil {
+		t.Fatalf("CleanUp returned error: %v", err)
+	}
+	sort.Strings(deleted)
+	if expected := []string{"1", "2"}; !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("CleanUp deleted %v, expected %v", deleted, expected)
+	}
+}
+
+func TestSolver_PropagationTimeout(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"domain_record": {"id": 1}}`)
+	})
+
+	s := &Solver{
+		Client:             client,
+		Resolver:           &stubResolver{},
+		PollInterval:       time.Millisecond,
+		PropagationTimeout: 20 * time.Millisecond,
+	}
+	if err := s.Present(ctx, "example.com", "value"); err == nil {
+		t.Error("Present expected an error when the record is never served")
+	}
+}
+
+func TestChallengeValue(t *testing.T) {
+	expected := "61rBZ_4knHblO0MNoxFsXZ_eTFUHum0B6IVRbhvUn5I"
+	if got := ChallengeValue("token.thumbprint"); got != expected {
+		t.Errorf("ChallengeValue returned %q, expected %q", got, expected)
+	}
+}
+
+func TestSolver_PresentWildcard(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var names []string
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		v := godo.DomainRecordEditRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		names = append(names, v.Name)
+		fmt.Fprintf(w, `{"domain_record": {"id": %d}}`, len(names))
+	})
+	mux.HandleFunc("/v2/domains/example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s := NewSolver(client)
+	for _, fqdn := range []string{"*.example.com", "*.www.example.com."} {
+		if err := s.Present(ctx, fqdn, "value"); err != nil {
+			t.Fatalf("Present(%q) returned error: %v", fqdn, err)
+		}
+		if err := s.CleanUp(ctx, fqdn, "value"); err != nil {
+			t.Errorf("CleanUp(%q) returned error: %v", fqdn, err)
+		}
+	}
+
+	if expected := []string{"_acme-challenge", "_acme-challenge.www"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("record names = %v, expected %v", names, expected)
+	}
+}
@@ -0,0 +1,65 @@
+// Command doks-credential is a kubectl exec credential plugin for
+// DigitalOcean Kubernetes clusters. It reads an API token from
+// DIGITALOCEAN_ACCESS_TOKEN and prints an ExecCredential for the cluster
+// given with --cluster-id, caching credentials until shortly before they
+// expire.
+//
+// With --kubeconfig it instead prints a kubeconfig for the cluster whose user
+// runs this command.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/godo/kubeconfig"
+)
+
+func main() {
+	clusterID := flag.String("cluster-id", "", "ID of the Kubernetes cluster")
+	cacheDir := flag.String("cache-dir", kubeconfig.DefaultCacheDir(), "directory for cached credentials, empty to disable caching")
+	printKubeconfig := flag.Bool("kubeconfig", false, "print a kubeconfig that uses this command for credentials")
+	flag.Parse()
+
+	if err := run(*clusterID, *cacheDir, *printKubeconfig); err != nil {
+		fmt.Fprintln(os.Stderr, "doks-credential:", err)
+		os.Exit(1)
+	}
+}
+
+func run(clusterID, cacheDir string, printKubeconfig bool) error {
+	if clusterID == "" {
+		return fmt.Errorf("--cluster-id is required")
+	}
+	token := os.Getenv("DIGITALOCEAN_ACCESS_TOKEN")
+	if token == "" {
+		return fmt.Errorf("DIGITALOCEAN_ACCESS_TOKEN is not set")
+	}
+
+	ctx := context.Background()
+	client := godo.NewFromToken(token)
+
+	if printKubeconfig {
+		c, err := kubeconfig.ExecKubeconfig(ctx, client, clusterID, os.Args[0])
+		if err != nil {
+			return err
+		}
+		data, err := c.Bytes()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	provider := &kubeconfig.CredentialProvider{Client: client, CacheDir: cacheDir}
+	cred, err := provider.ExecCredential(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(cred)
+}
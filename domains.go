@@ -3,6 +3,7 @@ package godo
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 )
 
@@ -25,6 +26,9 @@ type DomainsService interface {
 	DeleteRecord(context.Context, string, int) (*Response, error)
 	EditRecord(context.Context, string, int, *DomainRecordEditRequest) (*DomainRecord, *Response, error)
 	CreateRecord(context.Context, string, *DomainRecordEditRequest) (*DomainRecord, *Response, error)
+
+	ExportZone(context.Context, string) (string, *Response, error)
+	ImportZone(context.Context, string, io.Reader) (*ZoneImportReport, *Response, error)
 }
 
 // DomainsServiceOp handles communication with the domain related methods of the
@@ -0,0 +1,365 @@
+package godo
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	minDomainRecordTTL = 30
+	maxDomainRecordTTL = 2147483647
+
+	// maxTXTRecordLength is the longest TXT record data accepted.
+	maxTXTRecordLength = 512
+
+	maxUint16 = 65535
+)
+
+// TypedDomainRecord is a domain record with the fields that matter for its
+// type. Typed records are built with the validating constructors, such as
+// ARecord, or converted from a DomainRecord with Typed.
+type TypedDomainRecord interface {
+	// EditRequest returns the request that creates or updates the record.
+	EditRequest() *DomainRecordEditRequest
+}
+
+// DomainRecordA is an A record.
+type DomainRecordA struct {
+	ID   int
+	Name string
+	TTL  int
+	IP   net.IP
+}
+
+// DomainRecordAAAA is an AAAA record.
+type DomainRecordAAAA struct {
+	ID   int
+	Name string
+	TTL  int
+	IP   net.IP
+}
+
+// DomainRecordCNAME is a CNAME record.
+type DomainRecordCNAME struct {
+	ID     int
+	Name   string
+	TTL    int
+	Target string
+}
+
+// DomainRecordMX is an MX record.
+type DomainRecordMX struct {
+	ID       int
+	Name     string
+	TTL      int
+	Host     string
+	Priority int
+}
+
+// DomainRecordTXT is a TXT record.
+type DomainRecordTXT struct {
+	ID   int
+	Name string
+	TTL  int
+	Text string
+}
+
+// DomainRecordSRV is an SRV record.
+type DomainRecordSRV struct {
+	ID       int
+	Name     string
+	TTL      int
+	Target   string
+	Priority int
+	Weight   int
+	Port     int
+}
+
+// DomainRecordCAA is a CAA record.
+type DomainRecordCAA struct {
+	ID    int
+	Name  string
+	TTL   int
+	Flags int
+	Tag   string
+	Value string
+}
+
+// DomainRecordNS is an NS record.
+type DomainRecordNS struct {
+	ID   int
+	Name string
+	TTL  int
+	Host string
+}
+
+var (
+	_ TypedDomainRecord = &DomainRecordA{}
+	_ TypedDomainRecord = &DomainRecordAAAA{}
+	_ TypedDomainRecord = &DomainRecordCNAME{}
+	_ TypedDomainRecord = &DomainRecordMX{}
+	_ TypedDomainRecord = &DomainRecordTXT{}
+	_ TypedDomainRecord = &DomainRecordSRV{}
+	_ TypedDomainRecord = &DomainRecordCAA{}
+	_ TypedDomainRecord = &DomainRecordNS{}
+)
+
+// ARecord returns a validated A record. Name is relative to the domain, or
+// "@" for the domain itself. A TTL of zero uses the API default.
+func ARecord(name, ip string, ttl int) (*DomainRecordA, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.To4() == nil {
+		return nil, NewArgError("ip", "must be an IPv4 address")
+	}
+	return &DomainRecordA{Name: name, TTL: ttl, IP: addr.To4()}, nil
+}
+
+// AAAARecord returns a validated AAAA record.
+func AAAARecord(name, ip string, ttl int) (*DomainRecordAAAA, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.To4() != nil {
+		return nil, NewArgError("ip", "must be an IPv6 address")
+	}
+	return &DomainRecordAAAA{Name: name, TTL: ttl, IP: addr}, nil
+}
+
+// CNAMERecord returns a validated CNAME record. The target must be "@" or a
+// fully qualified name ending in a dot.
+func CNAMERecord(name, target string, ttl int) (*DomainRecordCNAME, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	if name == "@" {
+		return nil, NewArgError("name", "a CNAME record cannot be created at the domain apex")
+	}
+	if err := validateRecordHost("target", target); err != nil {
+		return nil, err
+	}
+	return &DomainRecordCNAME{Name: name, TTL: ttl, Target: target}, nil
+}
+
+// MXRecord returns a validated MX record. The host must be "@" or a fully
+// qualified name ending in a dot.
+func MXRecord(name, host string, priority, ttl int) (*DomainRecordMX, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	if err := validateRecordHost("host", host); err != nil {
+		return nil, err
+	}
+	if priority < 0 || priority > maxUint16 {
+		return nil, NewArgError("priority", "must be between 0 and 65535")
+	}
+	return &DomainRecordMX{Name: name, TTL: ttl, Host: host, Priority: priority}, nil
+}
+
+// TXTRecord returns a validated TXT record.
+func TXTRecord(name, text string, ttl int) (*DomainRecordTXT, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	if len(text) == 0 {
+		return nil, NewArgError("text", "cannot be an empty string")
+	}
+	if len(text) > maxTXTRecordLength {
+		return nil, NewArgError("text", fmt.Sprintf("cannot be longer than %d characters", maxTXTRecordLength))
+	}
+	return &DomainRecordTXT{Name: name, TTL: ttl, Text: text}, nil
+}
+
+// SRVRecord returns a validated SRV record. The name must start with the
+// service and protocol labels, such as "_sip._tcp". The target must be "@"
+// or a fully qualified name ending in a dot.
+func SRVRecord(name, target string, priority, weight, port, ttl int) (*DomainRecordSRV, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 || !strings.HasPrefix(labels[0], "_") || !strings.HasPrefix(labels[1], "_") {
+		return nil, NewArgError("name", "must start with _service._protocol")
+	}
+	if err := validateRecordHost("target", target); err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		arg   string
+		value int
+	}{{"priority", priority}, {"weight", weight}, {"port", port}} {
+		if f.value < 0 || f.value > maxUint16 {
+			return nil, NewArgError(f.arg, "must be between 0 and 65535")
+		}
+	}
+	return &DomainRecordSRV{Name: name, TTL: ttl, Target: target, Priority: priority, Weight: weight, Port: port}, nil
+}
+
+// CAARecord returns a validated CAA record. Flags must be 0 or 128 and the
+// tag one of issue, issuewild or iodef.
+func CAARecord(name string, flags int, tag, value string, ttl int) (*DomainRecordCAA, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	if flags != 0 && flags != 128 {
+		return nil, NewArgError("flags", "must be 0 or 128")
+	}
+	switch tag {
+	case "issue", "issuewild", "iodef":
+	default:
+		return nil, NewArgError("tag", "must be issue, issuewild or iodef")
+	}
+	if len(value) == 0 {
+		return nil, NewArgError("value", "cannot be an empty string")
+	}
+	return &DomainRecordCAA{Name: name, TTL: ttl, Flags: flags, Tag: tag, Value: value}, nil
+}
+
+// NSRecord returns a validated NS record. The host must be a fully
+// qualified name ending in a dot.
+func NSRecord(name, host string, ttl int) (*DomainRecordNS, error) {
+	if err := validateRecordHeader(name, ttl); err != nil {
+		return nil, err
+	}
+	if host == "@" {
+		return nil, NewArgError("host", "must be a fully qualified name ending in a dot")
+	}
+	if err := validateRecordHost("host", host); err != nil {
+		return nil, err
+	}
+	return &DomainRecordNS{Name: name, TTL: ttl, Host: host}, nil
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordA) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{Type: "A", Name: r.Name, Data: r.IP.String(), TTL: r.TTL}
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordAAAA) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{Type: "AAAA", Name: r.Name, Data: r.IP.String(), TTL: r.TTL}
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordCNAME) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{Type: "CNAME", Name: r.Name, Data: r.Target, TTL: r.TTL}
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordMX) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{Type: "MX", Name: r.Name, Data: r.Host, Priority: r.Priority, TTL: r.TTL}
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordTXT) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{Type: "TXT", Name: r.Name, Data: r.Text, TTL: r.TTL}
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordSRV) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{
+		Type:     "SRV",
+		Name:     r.Name,
+		Data:     r.Target,
+		Priority: r.Priority,
+		Weight:   r.Weight,
+		Port:     r.Port,
+		TTL:      r.TTL,
+	}
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordCAA) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{Type: "CAA", Name: r.Name, Data: r.Value, Flags: r.Flags, Tag: r.Tag, TTL: r.TTL}
+}
+
+// EditRequest returns the request for the record.
+func (r *DomainRecordNS) EditRequest() *DomainRecordEditRequest {
+	return &DomainRecordEditRequest{Type: "NS", Name: r.Name, Data: r.Host, TTL: r.TTL}
+}
+
+// Typed converts a DomainRecord into its typed form. Records are converted
+// as returned by the API and are not validated.
+func (d DomainRecord) Typed() (TypedDomainRecord, error) {
+	switch d.Type {
+	case "A":
+		return &DomainRecordA{ID: d.ID, Name: d.Name, TTL: d.TTL, IP: net.ParseIP(d.Data)}, nil
+	case "AAAA":
+		return &DomainRecordAAAA{ID: d.ID, Name: d.Name, TTL: d.TTL, IP: net.ParseIP(d.Data)}, nil
+	case "CNAME":
+		return &DomainRecordCNAME{ID: d.ID, Name: d.Name, TTL: d.TTL, Target: d.Data}, nil
+	case "MX":
+		return &DomainRecordMX{ID: d.ID, Name: d.Name, TTL: d.TTL, Host: d.Data, Priority: d.Priority}, nil
+	case "TXT":
+		return &DomainRecordTXT{ID: d.ID, Name: d.Name, TTL: d.TTL, Text: d.Data}, nil
+	case "SRV":
+		return &DomainRecordSRV{
+			ID:       d.ID,
+			Name:     d.Name,
+			TTL:      d.TTL,
+			Target:   d.Data,
+			Priority: d.Priority,
+			Weight:   d.Weight,
+			Port:     d.Port,
+		}, nil
+	case "CAA":
+		return &DomainRecordCAA{ID: d.ID, Name: d.Name, TTL: d.TTL, Flags: d.Flags, Tag: d.Tag, Value: d.Data}, nil
+	case "NS":
+		return &DomainRecordNS{ID: d.ID, Name: d.Name, TTL: d.TTL, Host: d.Data}, nil
+	}
+	return nil, NewArgError("type", fmt.Sprintf("%q has no typed form", d.Type))
+}
+
+func validateRecordHeader(name string, ttl int) error {
+	if name != "@" && !isValidHostname(name, true) {
+		return NewArgError("name", "must be \"@\" or a valid relative hostname")
+	}
+	if ttl != 0 && (ttl < minDomainRecordTTL || ttl > maxDomainRecordTTL) {
+		return NewArgError("ttl", fmt.Sprintf("must be between %d and %d", minDomainRecordTTL, maxDomainRecordTTL))
+	}
+	return nil
+}
+
+// validateRecordHost checks hostname record data, which must be "@" or a
+// fully qualified name with a trailing dot.
+func validateRecordHost(arg, host string) error {
+	if host == "@" {
+		return nil
+	}
+	if !strings.HasSuffix(host, ".") {
+		return NewArgError(arg, "must be \"@\" or a fully qualified name ending in a dot")
+	}
+	if !isValidHostname(strings.TrimSuffix(host, "."), false) {
+		return NewArgError(arg, "must be a valid hostname")
+	}
+	return nil
+}
+
+// isValidHostname checks the labels of a name. Owner names may start with
+// a wildcard label and use underscores, as in _dmarc or _sip._tcp.
+func isValidHostname(name string, owner bool) bool {
+	if len(name) == 0 || len(name) > 253 {
+		return false
+	}
+	for i, label := range strings.Split(name, ".") {
+		if owner && i == 0 && label == "*" {
+			continue
+		}
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			case c == '_' && owner:
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
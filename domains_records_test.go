@@ -0,0 +1,120 @@
+package godo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDomainRecordConstructors(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   func() (TypedDomainRecord, error)
+		expected *DomainRecordEditRequest
+	}{
+		{
+			name:     "A",
+			record:   func() (TypedDomainRecord, error) { return ARecord("www", "192.0.2.1", 300) },
+			expected: &DomainRecordEditRequest{Type: "A", Name: "www", Data: "192.0.2.1", TTL: 300},
+		},
+		{
+			name:     "AAAA",
+			record:   func() (TypedDomainRecord, error) { return AAAARecord("@", "2001:db8::1", 0) },
+			expected: &DomainRecordEditRequest{Type: "AAAA", Name: "@", Data: "2001:db8::1"},
+		},
+		{
+			name:     "CNAME",
+			record:   func() (TypedDomainRecord, error) { return CNAMERecord("*.apps", "lb.example.com.", 60) },
+			expected: &DomainRecordEditRequest{Type: "CNAME", Name: "*.apps", Data: "lb.example.com.", TTL: 60},
+		},
+		{
+			name:     "MX",
+			record:   func() (TypedDomainRecord, error) { return MXRecord("@", "mail.example.com.", 10, 0) },
+			expected: &DomainRecordEditRequest{Type: "MX", Name: "@", Data: "mail.example.com.", Priority: 10},
+		},
+		{
+			name:     "TXT",
+			record:   func() (TypedDomainRecord, error) { return TXTRecord("_dmarc", "v=DMARC1; p=none", 0) },
+			expected: &DomainRecordEditRequest{Type: "TXT", Name: "_dmarc", Data: "v=DMARC1; p=none"},
+		},
+		{
+			name:     "SRV",
+			record:   func() (TypedDomainRecord, error) { return SRVRecord("_sip._tcp", "sip.example.com.", 10, 60, 0, 0) },
+			expected: &DomainRecordEditRequest{Type: "SRV", Name: "_sip._tcp", Data: "sip.example.com.", Priority: 10, Weight: 60},
+		},
+		{
+			name:     "CAA",
+			record:   func() (TypedDomainRecord, error) { return CAARecord("@", 128, "issue", "letsencrypt.org", 0) },
+			expected: &DomainRecordEditRequest{Type: "CAA", Name: "@", Data: "letsencrypt.org", Flags: 128, Tag: "issue"},
+		},
+		{
+			name:     "NS",
+			record:   func() (TypedDomainRecord, error) { return NSRecord("sub", "ns1.example.org.", 0) },
+			expected: &DomainRecordEditRequest{Type: "NS", Name: "sub", Data: "ns1.example.org."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := tt.record()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := r.EditRequest(); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("EditRequest\n got=%+v\nwant=%+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDomainRecordConstructors_Invalid(t *testing.T) {
+	tests := map[string]func() (TypedDomainRecord, error){
+		"A with IPv6":         func() (TypedDomainRecord, error) { return ARecord("www", "2001:db8::1", 0) },
+		"A with bad name":     func() (TypedDomainRecord, error) { return ARecord("bad name", "192.0.2.1", 0) },
+		"A with low TTL":      func() (TypedDomainRecord, error) { return ARecord("www", "192.0.2.1", 10) },
+		"AAAA with IPv4":      func() (TypedDomainRecord, error) { return AAAARecord("www", "192.0.2.1", 0) },
+		"CNAME at apex":       func() (TypedDomainRecord, error) { return CNAMERecord("@", "www.example.com.", 0) },
+		"MX without dot":      func() (TypedDomainRecord, error) { return MXRecord("@", "mail.example.com", 10, 0) },
+		"MX priority":         func() (TypedDomainRecord, error) { return MXRecord("@", "mail.example.com.", 70000, 0) },
+		"TXT empty":           func() (TypedDomainRecord, error) { return TXTRecord("@", "", 0) },
+		"TXT too long":        func() (TypedDomainRecord, error) { return TXTRecord("@", string(make([]byte, 513)), 0) },
+		"SRV without service": func() (TypedDomainRecord, error) { return SRVRecord("sip", "sip.example.com.", 0, 0, 5060, 0) },
+		"SRV port":            func() (TypedDomainRecord, error) { return SRVRecord("_sip._tcp", "sip.example.com.", 0, 0, -1, 0) },
+		"CAA flags":           func() (TypedDomainRecord, error) { return CAARecord("@", 1, "issue", "letsencrypt.org", 0) },
+		"CAA tag":             func() (TypedDomainRecord, error) { return CAARecord("@", 0, "issues", "letsencrypt.org", 0) },
+		"NS at @":             func() (TypedDomainRecord, error) { return NSRecord("sub", "@", 0) },
+		"NS bad host":         func() (TypedDomainRecord, error) { return NSRecord("sub", "ns_1.example.org.", 0) },
+	}
+
+	for name, record := range tests {
+		_, err := record()
+		if _, ok := err.(*ArgError); !ok {
+			t.Errorf("%s: expected ArgError, got %v", name, err)
+		}
+	}
+}
+
+func TestDomainRecord_Typed(t *testing.T) {
+	record := DomainRecord{ID: 7, Type: "SRV", Name: "_sip._tcp", Data: "sip.example.com", Priority: 10, Weight: 60, Port: 5060, TTL: 1800}
+
+	typed, err := record.Typed()
+	if err != nil {
+		t.Fatalf("Typed returned error: %v", err)
+	}
+
+	expected := &DomainRecordSRV{ID: 7, Name: "_sip._tcp", TTL: 1800, Target: "sip.example.com", Priority: 10, Weight: 60, Port: 5060}
+	if !reflect.DeepEqual(typed, expected) {
+		t.Errorf("Typed\n got=%+v\nwant=%+v", typed, expected)
+	}
+
+	a, err := DomainRecord{ID: 1, Type: "A", Name: "@", Data: "192.0.2.1"}.Typed()
+	if err != nil {
+		t.Fatalf("Typed returned error: %v", err)
+	}
+	if got := a.EditRequest().Data; got != "192.0.2.1" {
+		t.Errorf("Typed A record round trip returned data %q", got)
+	}
+
+	if _, err := (DomainRecord{Type: "SOA"}).Typed(); err == nil {
+		t.Error("Typed expected an error for SOA records")
+	}
+}
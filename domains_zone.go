@@ -0,0 +1,630 @@
+package godo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ZoneSkippedEntry describes a zone file entry that was not imported.
+type ZoneSkippedEntry struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+// ZoneImportReport describes the result of importing a zone file.
+type ZoneImportReport struct {
+	Created []DomainRecord
+	Skipped []ZoneSkippedEntry
+}
+
+// maxTXTChunk is the longest character-string allowed in a TXT record.
+const maxTXTChunk = 255
+
+// ExportZone renders all records of a domain as an RFC 1035 zone file. The
+// SOA record is taken from the domain's zone file and the domain TTL is
+// used as the default TTL.
+func (s *DomainsServiceOp) ExportZone(ctx context.Context, domain string) (string, *Response, error) {
+	d, resp, err := s.Get(ctx, domain)
+	if err != nil {
+		return "", resp, err
+	}
+
+	records, resp, err := s.allRecords(ctx, domain)
+	if err != nil {
+		return "", resp, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "$ORIGIN %s.\n", strings.TrimSuffix(d.Name, "."))
+	if d.TTL > 0 {
+		fmt.Fprintf(&b, "$TTL %d\n", d.TTL)
+	}
+	if soa := zoneSOA(d.ZoneFile); soa != "" {
+		fmt.Fprintln(&b, soa)
+	}
+	for _, r := range records {
+		if r.Type == "SOA" {
+			continue
+		}
+		fmt.Fprintln(&b, formatZoneRecord(&r))
+	}
+
+	return b.String(), resp, nil
+}
+
+// ImportZone parses a zone file for a domain and creates every record it
+// contains that does not already exist. Entries that cannot be represented
+// as DigitalOcean records are returned in the report instead of failing the
+// import.
+func (s *DomainsServiceOp) ImportZone(ctx context.Context, domain string, zone io.Reader) (*ZoneImportReport, *Response, error) {
+	if len(domain) < 1 {
+		return nil, nil, NewArgError("domain", "cannot be an empty string")
+	}
+
+	parsed, err := parseZone(zone, domain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing, resp, err := s.allRecords(ctx, domain)
+	if err != nil {
+		return nil, resp, err
+	}
+	present := make(map[string]bool, len(existing))
+	for _, r := range existing {
+		present[zoneRecordKey(r.Type, r.Name, r.Data)] = true
+	}
+
+	report := &ZoneImportReport{Skipped: parsed.skipped}
+	for i, r := range parsed.records {
+		if present[zoneRecordKey(r.Type, r.Name, r.Data)] {
+			report.Skipped = append(report.Skipped, ZoneSkippedEntry{
+				Line:   parsed.lines[i],
+				Text:   parsed.texts[i],
+				Reason: "record already exists",
+			})
+			continue
+		}
+
+		created, resp, err := s.CreateRecord(ctx, domain, &parsed.records[i])
+		if err != nil {
+			return report, resp, err
+		}
+		report.Created = append(report.Created, *created)
+	}
+
+	return report, resp, nil
+}
+
+// ParseZoneFile parses an RFC 1035 zone file for the given origin into
+// record requests. Entries that cannot be represented as DigitalOcean
+// records, such as SOA or unsupported types, are returned separately.
+func ParseZoneFile(zone io.Reader, origin string) ([]DomainRecordEditRequest, []ZoneSkippedEntry, error) {
+	parsed, err := parseZone(zone, origin)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsed.records, parsed.skipped, nil
+}
+
+func (s *DomainsServiceOp) allRecords(ctx context.Context, domain string) ([]DomainRecord, *Response, error) {
+	list := []DomainRecord{}
+	opt := &ListOptions{}
+	for {
+		records, resp, err := s.Records(ctx, domain, opt)
+		if err != nil {
+			return nil, resp, err
+		}
+
+		list = append(list, records...)
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			return list, resp, nil
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, resp, err
+		}
+
+		opt.Page = page + 1
+	}
+}
+
+func zoneRecordKey(typ, name, data string) string {
+	return strings.ToUpper(typ) + " " + strings.ToLower(name) + " " + strings.ToLower(strings.TrimSuffix(data, "."))
+}
+
+// formatZoneRecord renders a DomainRecord as a single zone file line.
+func formatZoneRecord(r *DomainRecord) string {
+	name := r.Name
+	if name == "" {
+		name = "@"
+	}
+	prefix := name
+	if r.TTL > 0 {
+		prefix += " " + strconv.Itoa(r.TTL)
+	}
+	prefix += " IN " + r.Type
+
+	switch r.Type {
+	case "CNAME", "NS":
+		return fmt.Sprintf("%s %s", prefix, zoneHostname(r.Data))
+	case "MX":
+		return fmt.Sprintf("%s %d %s", prefix, r.Priority, zoneHostname(r.Data))
+	case "SRV":
+		return fmt.Sprintf("%s %d %d %d %s", prefix, r.Priority, r.Weight, r.Port, zoneHostname(r.Data))
+	case "CAA":
+		return fmt.Sprintf("%s %d %s %s", prefix, r.Flags, r.Tag, quoteZoneString(r.Data))
+	case "TXT":
+		var chunks []string
+		data := r.Data
+		for len(data) > maxTXTChunk {
+			chunks = append(chunks, quoteZoneString(data[:maxTXTChunk]))
+			data = data[maxTXTChunk:]
+		}
+		chunks = append(chunks, quoteZoneString(data))
+		return fmt.Sprintf("%s %s", prefix, strings.Join(chunks, " "))
+	default:
+		return fmt.Sprintf("%s %s", prefix, r.Data)
+	}
+}
+
+// zoneHostname renders hostname record data. The API returns fully
+// qualified names without the trailing dot, so any name containing a dot
+// is treated as absolute and single labels as relative to the origin.
+func zoneHostname(data string) string {
+	if data == "@" || strings.HasSuffix(data, ".") || !strings.Contains(data, ".") {
+		return data
+	}
+	return data + "."
+}
+
+func quoteZoneString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+// zoneSOA extracts the SOA record of a zone file as a single line.
+func zoneSOA(zoneFile string) string {
+	entries, err := scanZone(strings.NewReader(zoneFile))
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		for i, t := range e.tokens {
+			if !t.quoted && strings.EqualFold(t.text, "SOA") && i > 0 {
+				var parts []string
+				for _, t := range e.tokens {
+					parts = append(parts, t.text)
+				}
+				return strings.Join(parts, " ")
+			}
+		}
+	}
+	return ""
+}
+
+type zoneToken struct {
+	text   string
+	quoted bool
+}
+
+// zoneEntry is a logical zone file entry, which may span several lines when
+// parentheses are used.
+type zoneEntry struct {
+	line int
+	text string
+
+	// continued is set when the entry starts with whitespace, meaning it
+	// uses the owner name of the previous entry.
+	continued bool
+	tokens    []zoneToken
+}
+
+// scanZone splits a zone file into logical entries, removing comments and
+// parentheses and unquoting character strings.
+func scanZone(r io.Reader) ([]zoneEntry, error) {
+	var entries []zoneEntry
+	var cur *zoneEntry
+	depth := 0
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		if depth == 0 {
+			if cur != nil && len(cur.tokens) > 0 {
+				entries = append(entries, *cur)
+			}
+			cur = &zoneEntry{
+				line:      lineNo,
+				continued: len(line) > 0 && (line[0] == ' ' || line[0] == '\t'),
+			}
+		}
+		cur.text = strings.TrimSpace(cur.text + " " + stripZoneComment(line))
+
+		for i := 0; i < len(line); {
+			c := line[i]
+			switch {
+			case c == ';':
+				i = len(line)
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case c == '(':
+				depth++
+				i++
+			case c == ')':
+				if depth == 0 {
+					return nil, fmt.Errorf("zone line %d: unbalanced parenthesis", lineNo)
+				}
+				depth--
+				i++
+			case c == '"':
+				s, n, err := unquoteZoneString(line[i:])
+				if err != nil {
+					return nil, fmt.Errorf("zone line %d: %v", lineNo, err)
+				}
+				cur.tokens = append(cur.tokens, zoneToken{text: s, quoted: true})
+				i += n
+			default:
+				j := i
+				for j < len(line) && !strings.ContainsRune(" \t\r;()\"", rune(line[j])) {
+					j++
+				}
+				cur.tokens = append(cur.tokens, zoneToken{text: line[i:j]})
+				i = j
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("zone line %d: unbalanced parenthesis", cur.line)
+	}
+	if cur != nil && len(cur.tokens) > 0 {
+		entries = append(entries, *cur)
+	}
+	return entries, nil
+}
+
+// stripZoneComment removes a trailing comment that is not inside quotes.
+func stripZoneComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// unquoteZoneString decodes the quoted string at the start of s and returns
+// it with the number of bytes consumed.
+func unquoteZoneString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+3 < len(s) && isDigits(s[i+1:i+4]) {
+				v, _ := strconv.Atoi(s[i+1 : i+4])
+				b.WriteByte(byte(v))
+				i += 3
+			} else if i+1 < len(s) {
+				b.WriteByte(s[i+1])
+				i++
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseZoneTTL parses a TTL in seconds or with BIND unit suffixes such as
+// 1h30m.
+func parseZoneTTL(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if v, err := strconv.Atoi(s); err == nil {
+		return v, v >= 0
+	}
+
+	total, n := 0, -1
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			if n < 0 {
+				n = 0
+			}
+			n = n*10 + int(c-'0')
+			continue
+		}
+		if n < 0 {
+			return 0, false
+		}
+		switch c {
+		case 's':
+		case 'm':
+			n *= 60
+		case 'h':
+			n *= 3600
+		case 'd':
+			n *= 86400
+		case 'w':
+			n *= 604800
+		default:
+			return 0, false
+		}
+		total += n
+		n = -1
+	}
+	if n >= 0 {
+		total += n
+	}
+	return total, true
+}
+
+type parsedZone struct {
+	records []DomainRecordEditRequest
+	lines   []int
+	texts   []string
+	skipped []ZoneSkippedEntry
+}
+
+// zoneParser holds the state carried between zone file entries.
+type zoneParser struct {
+	domain     string
+	origin     string
+	defaultTTL int
+	lastName   string
+}
+
+func parseZone(r io.Reader, domain string) (*parsedZone, error) {
+	entries, err := scanZone(r)
+	if err != nil {
+		return nil, err
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	p := &zoneParser{domain: domain, origin: domain}
+	out := &parsedZone{}
+	for _, e := range entries {
+		rec, reason, err := p.parseEntry(&e)
+		if err != nil {
+			return nil, fmt.Errorf("zone line %d: %v", e.line, err)
+		}
+		if reason != "" {
+			out.skipped = append(out.skipped, ZoneSkippedEntry{Line: e.line, Text: e.text, Reason: reason})
+			continue
+		}
+		if rec != nil {
+			out.records = append(out.records, *rec)
+			out.lines = append(out.lines, e.line)
+			out.texts = append(out.texts, e.text)
+		}
+	}
+	return out, nil
+}
+
+// parseEntry parses a single entry. It returns a record, a reason the entry
+// was skipped, or nil for both when the entry was a directive.
+func (p *zoneParser) parseEntry(e *zoneEntry) (*DomainRecordEditRequest, string, error) {
+	tokens := e.tokens
+	switch strings.ToUpper(tokens[0].text) {
+	case "$ORIGIN":
+		if len(tokens) != 2 {
+			return nil, "", fmt.Errorf("$ORIGIN takes one argument")
+		}
+		origin, err := p.absolute(tokens[1].text)
+		if err != nil {
+			return nil, "", err
+		}
+		p.origin = origin
+		return nil, "", nil
+	case "$TTL":
+		if len(tokens) != 2 {
+			return nil, "", fmt.Errorf("$TTL takes one argument")
+		}
+		ttl, ok := parseZoneTTL(tokens[1].text)
+		if !ok {
+			return nil, "", fmt.Errorf("invalid TTL %q", tokens[1].text)
+		}
+		p.defaultTTL = ttl
+		return nil, "", nil
+	case "$INCLUDE", "$GENERATE":
+		return nil, tokens[0].text + " is not supported", nil
+	}
+
+	name := p.lastName
+	if !e.continued {
+		var err error
+		name, err = p.absolute(tokens[0].text)
+		if err != nil {
+			return nil, "", err
+		}
+		tokens = tokens[1:]
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("no owner name")
+	}
+	p.lastName = name
+
+	ttl := p.defaultTTL
+	for len(tokens) > 0 {
+		t := strings.ToUpper(tokens[0].text)
+		if t == "CH" || t == "HS" || t == "CS" {
+			return nil, "class " + t + " is not supported", nil
+		}
+		if t != "IN" {
+			v, ok := parseZoneTTL(tokens[0].text)
+			if !ok {
+				break
+			}
+			ttl = v
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return nil, "", fmt.Errorf("missing record type")
+	}
+
+	typ := strings.ToUpper(tokens[0].text)
+	rdata := tokens[1:]
+
+	relName, ok := p.relative(name)
+	if !ok {
+		return nil, fmt.Sprintf("name %s is outside of zone %s", name, p.domain), nil
+	}
+
+	rec := &DomainRecordEditRequest{Type: typ, Name: relName, TTL: ttl}
+	switch typ {
+	case "SOA":
+		return nil, "SOA records are managed by DigitalOcean", nil
+	case "NS":
+		if relName == "@" {
+			return nil, "apex NS records are managed by DigitalOcean", nil
+		}
+		if err := p.hostData(rec, rdata); err != nil {
+			return nil, "", err
+		}
+	case "A", "AAAA":
+		if len(rdata) != 1 {
+			return nil, "", fmt.Errorf("%s record takes one address", typ)
+		}
+		ip := net.ParseIP(rdata[0].text)
+		if ip == nil || (typ == "A") != (ip.To4() != nil) {
+			return nil, "", fmt.Errorf("invalid %s address %q", typ, rdata[0].text)
+		}
+		rec.Data = rdata[0].text
+	case "CNAME":
+		if err := p.hostData(rec, rdata); err != nil {
+			return nil, "", err
+		}
+	case "MX":
+		if len(rdata) != 2 {
+			return nil, "", fmt.Errorf("MX record takes a preference and an exchange")
+		}
+		v, err := strconv.Atoi(rdata[0].text)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid MX preference %q", rdata[0].text)
+		}
+		rec.Priority = v
+		if err := p.hostData(rec, rdata[1:]); err != nil {
+			return nil, "", err
+		}
+	case "SRV":
+		if len(rdata) != 4 {
+			return nil, "", fmt.Errorf("SRV record takes priority, weight, port and target")
+		}
+		var fields [3]int
+		for i := range fields {
+			v, err := strconv.Atoi(rdata[i].text)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid SRV field %q", rdata[i].text)
+			}
+			fields[i] = v
+		}
+		rec.Priority, rec.Weight, rec.Port = fields[0], fields[1], fields[2]
+		if err := p.hostData(rec, rdata[3:]); err != nil {
+			return nil, "", err
+		}
+	case "TXT":
+		if len(rdata) == 0 {
+			return nil, "", fmt.Errorf("TXT record has no data")
+		}
+		var b strings.Builder
+		for _, t := range rdata {
+			b.WriteString(t.text)
+		}
+		rec.Data = b.String()
+	case "CAA":
+		if len(rdata) != 3 {
+			return nil, "", fmt.Errorf("CAA record takes flags, tag and value")
+		}
+		flags, err := strconv.Atoi(rdata[0].text)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid CAA flags %q", rdata[0].text)
+		}
+		rec.Flags = flags
+		rec.Tag = rdata[1].text
+		rec.Data = rdata[2].text
+	default:
+		return nil, "record type " + typ + " is not supported", nil
+	}
+
+	return rec, "", nil
+}
+
+// hostData sets the record data to a hostname, as a fully qualified name
+// with a trailing dot or "@" for the zone apex.
+func (p *zoneParser) hostData(rec *DomainRecordEditRequest, rdata []zoneToken) error {
+	if len(rdata) != 1 {
+		return fmt.Errorf("%s record takes one hostname", rec.Type)
+	}
+	host, err := p.absolute(rdata[0].text)
+	if err != nil {
+		return err
+	}
+	if host == p.domain {
+		rec.Data = "@"
+	} else {
+		rec.Data = host + "."
+	}
+	return nil
+}
+
+// absolute resolves a name against the current origin and returns it in
+// lower case without the trailing dot.
+func (p *zoneParser) absolute(name string) (string, error) {
+	switch {
+	case name == "":
+		return "", fmt.Errorf("empty name")
+	case name == "@":
+		return p.origin, nil
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(strings.TrimSuffix(name, ".")), nil
+	default:
+		return strings.ToLower(name) + "." + p.origin, nil
+	}
+}
+
+// relative converts an absolute name to the form used by the API.
+func (p *zoneParser) relative(name string) (string, bool) {
+	if name == p.domain {
+		return "@", true
+	}
+	if strings.HasSuffix(name, "."+p.domain) {
+		return strings.TrimSuffix(name, "."+p.domain), true
+	}
+	return "", false
+}
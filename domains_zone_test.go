@@ -0,0 +1,174 @@
+package godo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testZoneFile = `$ORIGIN example.com.
+$TTL 1h
+@	IN	SOA	ns1.digitalocean.com. hostmaster.example.com. (
+		1603000000 ; serial
+		10800 3600 604800 1800 )
+@		IN	NS	ns1.digitalocean.com.
+@	300	IN	A	192.0.2.1
+www		IN	CNAME	@
+		IN	TXT	"first ""half" "; second half"
+mail	IN	AAAA	2001:db8::1
+@	IN	MX	10 mail
+_sip._tcp	86400 IN	SRV	10 60 5060 sip.example.org.
+@	IN	CAA	0 issue "letsencrypt.org"
+$ORIGIN sub.example.com.
+api	IN	A	192.0.2.2
+other.org.	IN	A	192.0.2.3
+@	IN	HINFO	"PC" "Linux"
+`
+
+func TestParseZoneFile(t *testing.T) {
+	records, skipped, err := ParseZoneFile(strings.NewReader(testZoneFile), "example.com")
+	if err != nil {
+		t.Fatalf("ParseZoneFile returned error: %v", err)
+	}
+
+	expected := []DomainRecordEditRequest{
+		{Type: "A", Name: "@", Data: "192.0.2.1", TTL: 300},
+		{Type: "CNAME", Name: "www", Data: "@", TTL: 3600},
+		{Type: "TXT", Name: "www", Data: "first half; second half", TTL: 3600},
+		{Type: "AAAA", Name: "mail", Data: "2001:db8::1", TTL: 3600},
+		{Type: "MX", Name: "@", Data: "mail.example.com.", Priority: 10, TTL: 3600},
+		{Type: "SRV", Name: "_sip._tcp", Data: "sip.example.org.", Priority: 10, Weight: 60, Port: 5060, TTL: 86400},
+		{Type: "CAA", Name: "@", Data: "letsencrypt.org", Flags: 0, Tag: "issue", TTL: 3600},
+		{Type: "A", Name: "api.sub", Data: "192.0.2.2", TTL: 3600},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("ParseZoneFile records\n got=%+v\nwant=%+v", records, expected)
+	}
+
+	var reasons []string
+	for _, s := range skipped {
+		reasons = append(reasons, fmt.Sprintf("%d: %s", s.Line, s.Reason))
+	}
+	expectedReasons := []string{
+		"3: SOA records are managed by DigitalOcean",
+		"6: apex NS records are managed by DigitalOcean",
+		"16: name other.org is outside of zone example.com",
+		"17: record type HINFO is not supported",
+	}
+	if !reflect.DeepEqual(reasons, expectedReasons) {
+		t.Errorf("ParseZoneFile skipped\n got=%v\nwant=%v", reasons, expectedReasons)
+	}
+}
+
+func TestParseZoneFile_Errors(t *testing.T) {
+	tests := []string{
+		"@ IN A 2001:db8::1",
+		"@ IN MX mail",
+		"@ IN SOA ( 1 2",
+		"@ IN TXT \"unterminated",
+		"  IN A 192.0.2.1",
+	}
+	for _, zone := range tests {
+		if _, _, err := ParseZoneFile(strings.NewReader(zone), "example.com"); err == nil {
+			t.Errorf("ParseZoneFile(%q) expected an error", zone)
+		}
+	}
+}
+
+func TestDomains_ExportZone(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/domains/example.com", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"domain": {"name": "example.com", "ttl": 1800, "zone_file": "$ORIGIN example.com.\n$TTL 1800\nexample.com. IN SOA ns1.digitalocean.com. hostmaster.example.com. 1603000000 10800 3600 604800 1800\n"}}`)
+	})
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"domain_records": [
+				{"id": 5, "type": "CAA", "name": "@", "data": "letsencrypt.org", "flags": 0, "tag": "issue", "ttl": 3600},
+				{"id": 6, "type": "SRV", "name": "_sip._tcp", "data": "sip.example.org", "priority": 10, "weight": 60, "port": 5060, "ttl": 3600}
+			]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"domain_records": [
+			{"id": 1, "type": "SOA", "name": "@", "data": "1800", "ttl": 1800},
+			{"id": 2, "type": "A", "name": "@", "data": "192.0.2.1", "ttl": 300},
+			{"id": 3, "type": "MX", "name": "@", "data": "mail.example.com", "priority": 10, "ttl": 1800},
+			{"id": 4, "type": "TXT", "name": "www", "data": "say \"hi\" %s", "ttl": 1800}
+		], "links": {"pages": {"next": "http://example.com/v2/domains/example.com/records?page=2"}}}`, strings.Repeat("x", 260))
+	})
+
+	zone, _, err := client.Domains.ExportZone(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("Domains.ExportZone returned error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"$ORIGIN example.com.",
+		"$TTL 1800",
+		"example.com. IN SOA ns1.digitalocean.com. hostmaster.example.com. 1603000000 10800 3600 604800 1800",
+		"@ 300 IN A 192.0.2.1",
+		"@ 1800 IN MX 10 mail.example.com.",
+		`www 1800 IN TXT "say \"hi\" ` + strings.Repeat("x", 246) + `" "` + strings.Repeat("x", 14) + `"`,
+		`@ 3600 IN CAA 0 issue "letsencrypt.org"`,
+		"_sip._tcp 3600 IN SRV 10 60 5060 sip.example.org.",
+	}, "\n") + "\n"
+	if zone != expected {
+		t.Errorf("Domains.ExportZone\n got=%s\nwant=%s", zone, expected)
+	}
+
+	// The exported zone must parse back into the same records.
+	records, _, err := ParseZoneFile(strings.NewReader(zone), "example.com")
+	if err != nil {
+		t.Fatalf("ParseZoneFile returned error: %v", err)
+	}
+	if len(records) != 5 || records[2].Data != `say "hi" `+strings.Repeat("x", 260) {
+		t.Errorf("exported zone did not round trip: %+v", records)
+	}
+}
+
+func TestDomains_ImportZone(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var created []DomainRecordEditRequest
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"domain_records": [{"id": 1, "type": "A", "name": "@", "data": "192.0.2.1"}]}`)
+		case http.MethodPost:
+			v := DomainRecordEditRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				t.Fatalf("decode json: %v", err)
+			}
+			created = append(created, v)
+			fmt.Fprintf(w, `{"domain_record": {"id": %d, "type": %q, "name": %q, "data": %q}}`, len(created)+1, v.Type, v.Name, v.Data)
+		}
+	})
+
+	zone := "@ IN A 192.0.2.1\nwww IN A 192.0.2.2\n@ IN PTR example.org.\n"
+	report, _, err := client.Domains.ImportZone(ctx, "example.com", strings.NewReader(zone))
+	if err != nil {
+		t.Fatalf("Domains.ImportZone returned error: %v", err)
+	}
+
+	expected := []DomainRecordEditRequest{{Type: "A", Name: "www", Data: "192.0.2.2"}}
+	if !reflect.DeepEqual(created, expected) {
+		t.Errorf("Domains.ImportZone created\n got=%+v\nwant=%+v", created, expected)
+	}
+	if len(report.Created) != 1 || report.Created[0].ID != 2 {
+		t.Errorf("Domains.ImportZone report created %+v", report.Created)
+	}
+	expectedSkipped := []ZoneSkippedEntry{
+		{Line: 3, Text: "@ IN PTR example.org.", Reason: "record type PTR is not supported"},
+		{Line: 1, Text: "@ IN A 192.0.2.1", Reason: "record already exists"},
+	}
+	if !reflect.DeepEqual(report.Skipped, expectedSkipped) {
+		t.Errorf("Domains.ImportZone skipped\n got=%+v\nwant=%+v", report.Skipped, expectedSkipped)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"path"
 )
 
 const dropletBasePath = "v2/droplets"
@@ -18,6 +19,7 @@ var errNoNetworks = errors.New("no networks have been defined")
 type DropletsService interface {
 	List(context.Context, *ListOptions) ([]Droplet, *Response, error)
 	ListByTag(context.Context, string, *ListOptions) ([]Droplet, *Response, error)
+	ListWithFilter(context.Context, *DropletListOptions) ([]Droplet, *Response, error)
 	Get(context.Context, int) (*Droplet, *Response, error)
 	Create(context.Context, *DropletCreateRequest) (*Droplet, *Response, error)
 	CreateMultiple(context.Context, *DropletMultiCreateRequest) ([]Droplet, *Response, error)
@@ -255,6 +257,83 @@ func (d DropletMultiCreateRequest) String() string {
 	return Stringify(d)
 }
 
+// DropletListOptions filters the Droplets returned by ListWithFilter. Name
+// and a single tag are sent to the API, every other predicate is applied to
+// the Droplets as the pages are fetched.
+type DropletListOptions struct {
+	// Name only returns Droplets with exactly this name.
+	Name string `url:"name,omitempty"`
+
+	// NameGlob only returns Droplets whose name matches the pattern, using
+	// the syntax of path.Match.
+	NameGlob string `url:"-"`
+
+	// Tags only returns Droplets carrying any of the tags, or all of them
+	// when MatchAllTags is set.
+	Tags         []string `url:"-"`
+	MatchAllTags bool     `url:"-"`
+
+	Region  string `url:"-"`
+	Status  string `url:"-"`
+	Size    string `url:"-"`
+	VPCUUID string `url:"-"`
+
+	// PerPage sets the page size used while fetching Droplets.
+	PerPage int `url:"per_page,omitempty"`
+}
+
+// tagName returns the tag that can be filtered on by the API, if any. The
+// API does not accept a tag together with a name, so tags are filtered
+// client side when Name is set.
+func (o *DropletListOptions) tagName() string {
+	if o.Name != "" {
+		return ""
+	}
+	if len(o.Tags) == 1 || (len(o.Tags) > 1 && o.MatchAllTags) {
+		return o.Tags[0]
+	}
+	return ""
+}
+
+// matches reports whether a Droplet satisfies the client side predicates.
+func (o *DropletListOptions) matches(d *Droplet) (bool, error) {
+	if o.NameGlob != "" {
+		ok, err := path.Match(o.NameGlob, d.Name)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if o.Region != "" && (d.Region == nil || d.Region.Slug != o.Region) {
+		return false, nil
+	}
+	if o.Status != "" && d.Status != o.Status {
+		return false, nil
+	}
+	if o.Size != "" && d.SizeSlug != o.Size && (d.Size == nil || d.Size.Slug != o.Size) {
+		return false, nil
+	}
+	if o.VPCUUID != "" && d.VPCUUID != o.VPCUUID {
+		return false, nil
+	}
+
+	if len(o.Tags) == 0 {
+		return true, nil
+	}
+	tags := make(map[string]bool, len(d.Tags))
+	for _, t := range d.Tags {
+		tags[t] = true
+	}
+	for _, t := range o.Tags {
+		if tags[t] && !o.MatchAllTags {
+			return true, nil
+		}
+		if !tags[t] && o.MatchAllTags {
+			return false, nil
+		}
+	}
+	return o.MatchAllTags, nil
+}
+
 // Networks represents the Droplet's Networks.
 type Networks struct {
 	V4 []NetworkV4 `json:"v4,omitempty"`
@@ -329,6 +408,62 @@ func (s *DropletsServiceOp) ListByTag(ctx context.Context, tag string, opt *List
 	return s.list(ctx, path)
 }
 
+// ListWithFilter lists all Droplets matching the filter, fetching every page.
+// The returned Response is the one for the last page.
+func (s *DropletsServiceOp) ListWithFilter(ctx context.Context, opt *DropletListOptions) ([]Droplet, *Response, error) {
+	if opt == nil {
+		opt = &DropletListOptions{}
+	}
+	if opt.NameGlob != "" {
+		if _, err := path.Match(opt.NameGlob, ""); err != nil {
+			return nil, nil, NewArgError("opt.NameGlob", err.Error())
+		}
+	}
+
+	base := dropletBasePath
+	if tag := opt.tagName(); tag != "" {
+		base = fmt.Sprintf("%s?tag_name=%s", dropletBasePath, tag)
+	}
+	base, err := addOptions(base, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list := []Droplet{}
+	page := &ListOptions{}
+	for {
+		u, err := addOptions(base, page)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		droplets, resp, err := s.list(ctx, u)
+		if err != nil {
+			return nil, resp, err
+		}
+
+		for i := range droplets {
+			ok, err := opt.matches(&droplets[i])
+			if err != nil {
+				return nil, resp, err
+			}
+			if ok {
+				list = append(list, droplets[i])
+			}
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			return list, resp, nil
+		}
+
+		current, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, resp, err
+		}
+		page.Page = current + 1
+	}
+}
+
 // Get individual Droplet.
 func (s *DropletsServiceOp) Get(ctx context.Context, dropletID int) (*Droplet, *Response, error) {
 	if dropletID < 1 {
@@ -148,6 +148,129 @@ func TestDroplets_RetrievePageByNumber(t *testing.T) {
 	checkCurrentPage(t, resp, 2)
 }
 
+func TestDroplets_ListWithFilter(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if tag := r.URL.Query().Get("tag_name"); tag != "web" {
+			t.Errorf("Droplets.ListWithFilter requested tag_name %q, expected %q", tag, "web")
+		}
+
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{
+				"droplets": [
+					{"id": 3, "name": "web-3", "status": "active", "region": {"slug": "nyc3"}, "vpc_uuid": "vpc-1", "tags": ["web", "prod"]},
+					{"id": 4, "name": "db-1", "status": "active", "region": {"slug": "nyc3"}, "vpc_uuid": "vpc-1", "tags": ["web", "prod"]}
+				]
+			}`)
+			return
+		}
+
+		fmt.Fprint(w, `{
+			"droplets": [
+				{"id": 1, "name": "web-1", "status": "active", "region": {"slug": "nyc3"}, "vpc_uuid": "vpc-1", "tags": ["web", "prod"]},
+				{"id": 2, "name": "web-2", "status": "off", "region": {"slug": "nyc3"}, "vpc_uuid": "vpc-1", "tags": ["web", "prod"]},
+				{"id": 5, "name": "web-5", "status": "active", "region": {"slug": "sfo2"}, "vpc_uuid": "vpc-1", "tags": ["web", "prod"]},
+				{"id": 6, "name": "web-6", "status": "active", "region": {"slug": "nyc3"}, "vpc_uuid": "vpc-1", "tags": ["web"]}
+			],
+			"links": {"pages": {"next": "http://example.com/v2/droplets?page=2"}}
+		}`)
+	})
+
+	opt := &DropletListOptions{
+		NameGlob:     "web-*",
+		Tags:         []string{"web", "prod"},
+		MatchAllTags: true,
+		Region:       "nyc3",
+		Status:       "active",
+		VPCUUID:      "vpc-1",
+	}
+	droplets, _, err := client.Droplets.ListWithFilter(ctx, opt)
+	if err != nil {
+		t.Fatalf("Droplets.ListWithFilter returned error: %v", err)
+	}
+
+	var ids []int
+	for _, d := range droplets {
+		ids = append(ids, d.ID)
+	}
+	if expected := []int{1, 3}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Droplets.ListWithFilter returned droplets %v, expected %v", ids, expected)
+	}
+}
+
+func TestDroplets_ListWithFilterNameAndTag(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.Query().Get("tag_name") != "" {
+			t.Errorf("Droplets.ListWithFilter requested a tag_name together with a name")
+		}
+		if name := r.URL.Query().Get("name"); name != "web-1" {
+			t.Errorf("Droplets.ListWithFilter requested name %q, expected %q", name, "web-1")
+		}
+		fmt.Fprint(w, `{
+			"droplets": [
+				{"id": 1, "name": "web-1", "tags": ["blue"]},
+				{"id": 2, "name": "web-1", "tags": ["green"]}
+			]
+		}`)
+	})
+
+	opt := &DropletListOptions{Name: "web-1", Tags: []string{"blue"}}
+	droplets, _, err := client.Droplets.ListWithFilter(ctx, opt)
+	if err != nil {
+		t.Fatalf("Droplets.ListWithFilter returned error: %v", err)
+	}
+
+	expected := []Droplet{{ID: 1, Name: "web-1", Tags: []string{"blue"}}}
+	if !reflect.DeepEqual(droplets, expected) {
+		t.Errorf("Droplets.ListWithFilter\nDroplets: got=%#v\nwant=%#v", droplets, expected)
+	}
+}
+
+func TestDroplets_ListWithFilterAnyTag(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.Query().Get("tag_name") != "" {
+			t.Errorf("Droplets.ListWithFilter requested a tag_name for an OR filter")
+		}
+		if name := r.URL.Query().Get("name"); name != "web-1" {
+			t.Errorf("Droplets.ListWithFilter requested name %q, expected %q", name, "web-1")
+		}
+		fmt.Fprint(w, `{
+			"droplets": [
+				{"id": 1, "name": "web-1", "tags": ["blue"]},
+				{"id": 2, "name": "web-1", "tags": ["green"]},
+				{"id": 3, "name": "web-1"}
+			]
+		}`)
+	})
+
+	opt := &DropletListOptions{Name: "web-1", Tags: []string{"blue", "green"}}
+	droplets, _, err := client.Droplets.ListWithFilter(ctx, opt)
+	if err != nil {
+		t.Fatalf("Droplets.ListWithFilter returned error: %v", err)
+	}
+
+	expected := []Droplet{{ID: 1, Name: "web-1", Tags: []string{"blue"}}, {ID: 2, Name: "web-1", Tags: []string{"green"}}}
+	if !reflect.DeepEqual(droplets, expected) {
+		t.Errorf("Droplets.ListWithFilter\nDroplets: got=%#v\nwant=%#v", droplets, expected)
+	}
+
+	_, _, err = client.Droplets.ListWithFilter(ctx, &DropletListOptions{NameGlob: "["})
+	if _, ok := err.(*ArgError); !ok {
+		t.Errorf("expected ArgError for a malformed glob, got %v", err)
+	}
+}
+
 func TestDroplets_GetDroplet(t *testing.T) {
 	setup()
 	defer teardown()
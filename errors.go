@@ -1,6 +1,9 @@
 package godo
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // ArgError is an error that represents an error with an input to godo. It
 // identifies the argument and the cause (if possible).
@@ -22,3 +25,17 @@ func NewArgError(arg, reason string) *ArgError {
 func (e *ArgError) Error() string {
 	return fmt.Sprintf("%s is invalid because %s", e.arg, e.reason)
 }
+
+// ArgErrors collects several ArgErrors so that all problems with an input
+// can be reported at once.
+type ArgErrors []*ArgError
+
+var _ error = ArgErrors{}
+
+func (e ArgErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -9,3 +9,11 @@ func TestArgError(t *testing.T) {
 		t.Errorf("ArgError().Error() = %q; expected %q", got, expected)
 	}
 }
+
+func TestArgErrors(t *testing.T) {
+	expected := "foo is invalid because bar; baz is invalid because qux"
+	err := ArgErrors{NewArgError("foo", "bar"), NewArgError("baz", "qux")}
+	if got := err.Error(); got != expected {
+		t.Errorf("ArgErrors.Error() = %q; expected %q", got, expected)
+	}
+}
@@ -0,0 +1,265 @@
+package godo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Firewall rules can be written in a compact form, one rule per line:
+//
+//	in tcp 22 from 10.0.0.0/8,tag:bastion
+//	in tcp 8000-9000 from lb:4de7ac8b-495b-4884-9a69-1050c6793cd6
+//	in icmp from 0.0.0.0/0,::/0
+//	out udp 53 to 0.0.0.0/0,::/0
+//	out tcp all to droplet:8043964
+//
+// Ports are a single port, a range or "all", and are omitted for icmp.
+// Targets are IP addresses or CIDRs, or references prefixed with tag:,
+// droplet: or lb:.
+
+// ParseInboundRule parses an inbound rule in compact form.
+func ParseInboundRule(s string) (*InboundRule, error) {
+	r, err := parseFirewallRule(s)
+	if err != nil {
+		return nil, err
+	}
+	if r.direction != "in" {
+		return nil, NewArgError("rule", fmt.Sprintf("%q is not an inbound rule", s))
+	}
+	return &InboundRule{
+		Protocol:  r.protocol,
+		PortRange: r.ports,
+		Sources: &Sources{
+			Addresses:        r.addresses,
+			Tags:             r.tags,
+			DropletIDs:       r.dropletIDs,
+			LoadBalancerUIDs: r.loadBalancerUIDs,
+		},
+	}, nil
+}
+
+// ParseOutboundRule parses an outbound rule in compact form.
+func ParseOutboundRule(s string) (*OutboundRule, error) {
+	r, err := parseFirewallRule(s)
+	if err != nil {
+		return nil, err
+	}
+	if r.direction != "out" {
+		return nil, NewArgError("rule", fmt.Sprintf("%q is not an outbound rule", s))
+	}
+	return &OutboundRule{
+		Protocol:  r.protocol,
+		PortRange: r.ports,
+		Destinations: &Destinations{
+			Addresses:        r.addresses,
+			Tags:             r.tags,
+			DropletIDs:       r.dropletIDs,
+			LoadBalancerUIDs: r.loadBalancerUIDs,
+		},
+	}, nil
+}
+
+// ParseFirewallRules reads rules in compact form, one per line. Blank lines
+// and lines starting with # are ignored.
+func ParseFirewallRules(rd io.Reader) (*FirewallRulesRequest, error) {
+	rules := &FirewallRulesRequest{}
+
+	scanner := bufio.NewScanner(rd)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "in ") {
+			r, err := ParseInboundRule(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			rules.InboundRules = append(rules.InboundRules, *r)
+		} else {
+			r, err := ParseOutboundRule(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			rules.OutboundRules = append(rules.OutboundRules, *r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// FormatInboundRule renders an inbound rule in compact form.
+func FormatInboundRule(r InboundRule) string {
+	var targets []string
+	if r.Sources != nil {
+		targets = formatFirewallTargets(r.Sources.Addresses, r.Sources.Tags, r.Sources.DropletIDs, r.Sources.LoadBalancerUIDs)
+	}
+	return formatFirewallRule("in", r.Protocol, r.PortRange, "from", targets)
+}
+
+// FormatOutboundRule renders an outbound rule in compact form.
+func FormatOutboundRule(r OutboundRule) string {
+	var targets []string
+	if d := r.Destinations; d != nil {
+		targets = formatFirewallTargets(d.Addresses, d.Tags, d.DropletIDs, d.LoadBalancerUIDs)
+	}
+	return formatFirewallRule("out", r.Protocol, r.PortRange, "to", targets)
+}
+
+// FormatFirewallRules renders rules in compact form, one per line.
+func FormatFirewallRules(inbound []InboundRule, outbound []OutboundRule) string {
+	var b strings.Builder
+	for _, r := range inbound {
+		b.WriteString(FormatInboundRule(r))
+		b.WriteString("\n")
+	}
+	for _, r := range outbound {
+		b.WriteString(FormatOutboundRule(r))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func formatFirewallRule(direction, protocol, ports, preposition string, targets []string) string {
+	parts := []string{direction, protocol}
+	if protocol != "icmp" {
+		if ports == "" || ports == "0" {
+			ports = "all"
+		}
+		parts = append(parts, ports)
+	}
+	parts = append(parts, preposition)
+	if len(targets) > 0 {
+		parts = append(parts, strings.Join(targets, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatFirewallTargets(addresses, tags []string, dropletIDs []int, lbUIDs []string) []string {
+	targets := append([]string{}, addresses...)
+	for _, t := range tags {
+		targets = append(targets, "tag:"+t)
+	}
+	for _, id := range dropletIDs {
+		targets = append(targets, "droplet:"+strconv.Itoa(id))
+	}
+	for _, uid := range lbUIDs {
+		targets = append(targets, "lb:"+uid)
+	}
+	return targets
+}
+
+type compactFirewallRule struct {
+	direction        string
+	protocol         string
+	ports            string
+	addresses        []string
+	tags             []string
+	dropletIDs       []int
+	loadBalancerUIDs []string
+}
+
+func parseFirewallRule(s string) (*compactFirewallRule, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return nil, NewArgError("rule", fmt.Sprintf("%q is not of the form \"<in|out> <protocol> [ports] <from|to> <targets>\"", s))
+	}
+
+	r := &compactFirewallRule{direction: fields[0], protocol: strings.ToLower(fields[1])}
+
+	preposition := map[string]string{"in": "from", "out": "to"}[r.direction]
+	if preposition == "" {
+		return nil, NewArgError("direction", fmt.Sprintf("%q must be in or out", fields[0]))
+	}
+
+	rest := fields[2:]
+	switch r.protocol {
+	case "icmp":
+	case "tcp", "udp":
+		ports, err := parseFirewallPorts(rest[0])
+		if err != nil {
+			return nil, err
+		}
+		r.ports = ports
+		rest = rest[1:]
+	default:
+		return nil, NewArgError("protocol", fmt.Sprintf("%q must be tcp, udp or icmp", fields[1]))
+	}
+
+	if len(rest) == 0 || len(rest) > 2 || rest[0] != preposition {
+		return nil, NewArgError("rule", fmt.Sprintf("%q must end with \"%s <targets>\"", s, preposition))
+	}
+
+	// A rule without targets ends with the preposition.
+	if len(rest) == 1 {
+		return r, nil
+	}
+	for _, t := range strings.Split(rest[1], ",") {
+		if err := r.addTarget(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func parseFirewallPorts(s string) (string, error) {
+	if s == "all" {
+		return s, nil
+	}
+
+	bounds := strings.SplitN(s, "-", 2)
+	var ports [2]int
+	for i, b := range bounds {
+		p, err := strconv.Atoi(b)
+		if err != nil || p < 1 || p > 65535 {
+			return "", NewArgError("ports", fmt.Sprintf("%q must be all, a port or a range of ports between 1 and 65535", s))
+		}
+		ports[i] = p
+	}
+	if len(bounds) == 2 && ports[0] > ports[1] {
+		return "", NewArgError("ports", fmt.Sprintf("%q starts after it ends", s))
+	}
+	return s, nil
+}
+
+func (r *compactFirewallRule) addTarget(t string) error {
+	kind, value := "", t
+	if i := strings.Index(t, ":"); i > 0 && net.ParseIP(t) == nil && !strings.Contains(t, "/") {
+		kind, value = t[:i], t[i+1:]
+	}
+	if value == "" {
+		return NewArgError("target", fmt.Sprintf("%q is empty", t))
+	}
+
+	switch kind {
+	case "":
+		if ip := net.ParseIP(value); ip == nil {
+			if _, _, err := net.ParseCIDR(value); err != nil {
+				return NewArgError("target", fmt.Sprintf("%q is not an IP address or CIDR", t))
+			}
+		}
+		r.addresses = append(r.addresses, value)
+	case "tag":
+		r.tags = append(r.tags, value)
+	case "droplet":
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			return NewArgError("target", fmt.Sprintf("%q is not a droplet ID", t))
+		}
+		r.dropletIDs = append(r.dropletIDs, id)
+	case "lb":
+		r.loadBalancerUIDs = append(r.loadBalancerUIDs, value)
+	default:
+		return NewArgError("target", fmt.Sprintf("%q must be an address or start with tag:, droplet: or lb:", t))
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package godo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInboundRule(t *testing.T) {
+	rule, err := ParseInboundRule("in tcp 22 from 10.0.0.0/8,1.2.3.4,tag:bastion,droplet:8043964,lb:4de7ac8b-495b-4884-9a69-1050c6793cd6")
+	if err != nil {
+		t.Fatalf("ParseInboundRule returned error: %v", err)
+	}
+
+	expected := &InboundRule{
+		Protocol:  "tcp",
+		PortRange: "22",
+		Sources: &Sources{
+			Addresses:        []string{"10.0.0.0/8", "1.2.3.4"},
+			Tags:             []string{"bastion"},
+			DropletIDs:       []int{8043964},
+			LoadBalancerUIDs: []string{"4de7ac8b-495b-4884-9a69-1050c6793cd6"},
+		},
+	}
+	if !reflect.DeepEqual(rule, expected) {
+		t.Errorf("ParseInboundRule returned %+v, expected %+v", rule, expected)
+	}
+}
+
+func TestParseOutboundRule(t *testing.T) {
+	rule, err := ParseOutboundRule("out udp 53 to 0.0.0.0/0,::/0")
+	if err != nil {
+		t.Fatalf("ParseOutboundRule returned error: %v", err)
+	}
+
+	expected := &OutboundRule{
+		Protocol:     "udp",
+		PortRange:    "53",
+		Destinations: &Destinations{Addresses: []string{"0.0.0.0/0", "::/0"}},
+	}
+	if !reflect.DeepEqual(rule, expected) {
+		t.Errorf("ParseOutboundRule returned %+v, expected %+v", rule, expected)
+	}
+}
+
+func TestParseFirewallRule_Invalid(t *testing.T) {
+	tests := []string{
+		"in tcp 22",
+		"sideways tcp 22 from 10.0.0.0/8",
+		"in sctp 22 from 10.0.0.0/8",
+		"in tcp from 10.0.0.0/8",
+		"in tcp 0 from 10.0.0.0/8",
+		"in tcp 9000-8000 from 10.0.0.0/8",
+		"in tcp 65536 from 10.0.0.0/8",
+		"in tcp 22 to 10.0.0.0/8",
+		"in icmp 22 from 10.0.0.0/8",
+		"in tcp 22 from 10.0.0.0/33",
+		"in tcp 22 from tag:",
+		"in tcp 22 from droplet:abc",
+		"in tcp 22 from vpc:default",
+		"out tcp 22 to example.com",
+	}
+
+	for _, s := range tests {
+		var err error
+		if strings.HasPrefix(s, "out") {
+			_, err = ParseOutboundRule(s)
+		} else {
+			_, err = ParseInboundRule(s)
+		}
+		if err == nil {
+			t.Errorf("expected error parsing %q", s)
+			continue
+		}
+		if _, ok := err.(*ArgError); !ok {
+			t.Errorf("expected *ArgError parsing %q, got %T", s, err)
+		}
+	}
+
+	if _, err := ParseOutboundRule("in tcp 22 from 10.0.0.0/8"); err == nil {
+		t.Error("expected error parsing an inbound rule as outbound")
+	}
+}
+
+func TestParseFirewallRules(t *testing.T) {
+	config := `
+# web servers
+in tcp 80 from 0.0.0.0/0,::/0
+in tcp 8000-9000 from tag:frontend
+in icmp from 0.0.0.0/0
+
+out tcp all to 0.0.0.0/0,::/0
+`
+
+	rules, err := ParseFirewallRules(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseFirewallRules returned error: %v", err)
+	}
+
+	expected := &FirewallRulesRequest{
+		InboundRules: []InboundRule{
+			{Protocol: "tcp", PortRange: "80", Sources: &Sources{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+			{Protocol: "tcp", PortRange: "8000-9000", Sources: &Sources{Tags: []string{"frontend"}}},
+			{Protocol: "icmp", Sources: &Sources{Addresses: []string{"0.0.0.0/0"}}},
+		},
+		OutboundRules: []OutboundRule{
+			{Protocol: "tcp", PortRange: "all", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+		},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("ParseFirewallRules returned %+v, expected %+v", rules, expected)
+	}
+
+	_, err = ParseFirewallRules(strings.NewReader("in tcp 22 from 10.0.0.0/8\nin tcp ssh from 10.0.0.0/8\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+}
+
+func TestFormatFirewallRules(t *testing.T) {
+	inbound := []InboundRule{
+		{
+			Protocol:  "tcp",
+			PortRange: "8000-9000",
+			Sources: &Sources{
+				Addresses:        []string{"1.2.3.4", "18.0.0.0/8"},
+				Tags:             []string{"frontend"},
+				DropletIDs:       []int{123, 456},
+				LoadBalancerUIDs: []string{"lb-uid"},
+			},
+		},
+		{Protocol: "icmp", Sources: &Sources{Addresses: []string{"0.0.0.0/0"}}},
+	}
+	outbound := []OutboundRule{
+		{Protocol: "tcp", PortRange: "0", Destinations: &Destinations{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+	}
+
+	expected := `in tcp 8000-9000 from 1.2.3.4,18.0.0.0/8,tag:frontend,droplet:123,droplet:456,lb:lb-uid
+in icmp from 0.0.0.0/0
+out tcp all to 0.0.0.0/0,::/0
+`
+	formatted := FormatFirewallRules(inbound, outbound)
+	if formatted != expected {
+		t.Errorf("FormatFirewallRules returned\n%s\nexpected\n%s", formatted, expected)
+	}
+
+	rules, err := ParseFirewallRules(strings.NewReader(formatted))
+	if err != nil {
+		t.Fatalf("ParseFirewallRules returned error: %v", err)
+	}
+	if !reflect.DeepEqual(rules.InboundRules, inbound) {
+		t.Errorf("round trip returned %+v, expected %+v", rules.InboundRules, inbound)
+	}
+}
+
+func TestFormatFirewallRules_NoTargets(t *testing.T) {
+	inbound := []InboundRule{{Protocol: "tcp", PortRange: "22", Sources: &Sources{}}}
+	outbound := []OutboundRule{{Protocol: "icmp", Destinations: &Destinations{}}}
+
+	expected := "in tcp 22 from\nout icmp to\n"
+	formatted := FormatFirewallRules(inbound, outbound)
+	if formatted != expected {
+		t.Errorf("FormatFirewallRules returned %q, expected %q", formatted, expected)
+	}
+
+	rules, err := ParseFirewallRules(strings.NewReader(formatted))
+	if err != nil {
+		t.Fatalf("ParseFirewallRules returned error: %v", err)
+	}
+	if !reflect.DeepEqual(rules.InboundRules, inbound) || !reflect.DeepEqual(rules.OutboundRules, outbound) {
+		t.Errorf("round trip returned %+v, expected %+v and %+v", rules, inbound, outbound)
+	}
+}
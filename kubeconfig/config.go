@@ -0,0 +1,344 @@
+package kubeconfig
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// doksHostSuffix is the suffix of the API server hostname of every
+// DigitalOcean Kubernetes cluster. The hostname is prefixed with the cluster
+// ID.
+const doksHostSuffix = ".k8s.ondigitalocean.com"
+
+// Config is a kubeconfig file. Fields this package does not use are kept in
+// Extra so that they survive a round trip.
+type Config struct {
+	APIVersion     string                 `yaml:"apiVersion,omitempty"`
+	Kind           string                 `yaml:"kind,omitempty"`
+	Preferences    map[string]interface{} `yaml:"preferences"`
+	Clusters       []NamedCluster         `yaml:"clusters"`
+	Users          []NamedUser            `yaml:"users"`
+	Contexts       []NamedContext         `yaml:"contexts"`
+	CurrentContext string                 `yaml:"current-context"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// NamedCluster is a cluster entry.
+type NamedCluster struct {
+	Name    string  `yaml:"name"`
+	Cluster Cluster `yaml:"cluster"`
+}
+
+// Cluster holds how to reach an API server.
+type Cluster struct {
+	Server                   string `yaml:"server"`
+	CertificateAuthority     string `yaml:"certificate-authority,omitempty"`
+	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// NamedUser is a user entry.
+type NamedUser struct {
+	Name string   `yaml:"name"`
+	User AuthInfo `yaml:"user"`
+}
+
+// AuthInfo holds the credentials of a user.
+type AuthInfo struct {
+	ClientCertificateData string      `yaml:"client-certificate-data,omitempty"`
+	ClientKeyData         string      `yaml:"client-key-data,omitempty"`
+	Token                 string      `yaml:"token,omitempty"`
+	Exec                  *ExecConfig `yaml:"exec,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// ExecConfig runs a command to obtain credentials.
+type ExecConfig struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Command    string       `yaml:"command"`
+	Args       []string     `yaml:"args,omitempty"`
+	Env        []ExecEnvVar `yaml:"env,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// ExecEnvVar is an environment variable set for an exec command.
+type ExecEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// NamedContext is a context entry.
+type NamedContext struct {
+	Name    string  `yaml:"name"`
+	Context Context `yaml:"context"`
+}
+
+// Context pairs a cluster with a user.
+type Context struct {
+	Cluster   string `yaml:"cluster"`
+	AuthInfo  string `yaml:"user"`
+	Namespace string `yaml:"namespace,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// New returns an empty kubeconfig.
+func New() *Config {
+	return &Config{APIVersion: "v1", Kind: "Config", Preferences: map[string]interface{}{}}
+}
+
+// Parse parses a kubeconfig, such as the KubeconfigYAML returned by
+// Kubernetes.GetKubeConfig.
+func Parse(data []byte) (*Config, error) {
+	c := New()
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("kubeconfig: %v", err)
+	}
+	if c.Preferences == nil {
+		c.Preferences = map[string]interface{}{}
+	}
+	return c, nil
+}
+
+// Bytes encodes the kubeconfig as YAML.
+func (c *Config) Bytes() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// Cluster returns the cluster entry with the given name, or nil.
+func (c *Config) Cluster(name string) *NamedCluster {
+	for i := range c.Clusters {
+		if c.Clusters[i].Name == name {
+			return &c.Clusters[i]
+		}
+	}
+	return nil
+}
+
+// User returns the user entry with the given name, or nil.
+func (c *Config) User(name string) *NamedUser {
+	for i := range c.Users {
+		if c.Users[i].Name == name {
+			return &c.Users[i]
+		}
+	}
+	return nil
+}
+
+// Context returns the context entry with the given name, or nil.
+func (c *Config) Context(name string) *NamedContext {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i]
+		}
+	}
+	return nil
+}
+
+// UseContext makes the named context current.
+func (c *Config) UseContext(name string) error {
+	if c.Context(name) == nil {
+		return fmt.Errorf("kubeconfig: no context named %q", name)
+	}
+	c.CurrentContext = name
+	return nil
+}
+
+// SetCluster adds or replaces a cluster entry.
+func (c *Config) SetCluster(e NamedCluster) {
+	if existing := c.Cluster(e.Name); existing != nil {
+		*existing = e
+		return
+	}
+	c.Clusters = append(c.Clusters, e)
+}
+
+// SetUser adds or replaces a user entry.
+func (c *Config) SetUser(e NamedUser) {
+	if existing := c.User(e.Name); existing != nil {
+		*existing = e
+		return
+	}
+	c.Users = append(c.Users, e)
+}
+
+// SetContext adds or replaces a context entry.
+func (c *Config) SetContext(e NamedContext) {
+	if existing := c.Context(e.Name); existing != nil {
+		*existing = e
+		return
+	}
+	c.Contexts = append(c.Contexts, e)
+}
+
+// RemoveContext removes a context along with its cluster and user when no
+// other context refers to them. The current context is unset if it was
+// removed.
+func (c *Config) RemoveContext(name string) {
+	ctx := c.Context(name)
+	if ctx == nil {
+		return
+	}
+	cluster, user := ctx.Context.Cluster, ctx.Context.AuthInfo
+
+	contexts := c.Contexts[:0]
+	for _, e := range c.Contexts {
+		if e.Name != name {
+			contexts = append(contexts, e)
+		}
+	}
+	c.Contexts = contexts
+
+	if c.CurrentContext == name {
+		c.CurrentContext = ""
+	}
+
+	clusterUsed, userUsed := false, false
+	for _, e := range c.Contexts {
+		clusterUsed = clusterUsed || e.Context.Cluster == cluster
+		userUsed = userUsed || e.Context.AuthInfo == user
+	}
+	if !clusterUsed {
+		c.removeCluster(cluster)
+	}
+	if !userUsed {
+		c.removeUser(user)
+	}
+}
+
+func (c *Config) removeCluster(name string) {
+	clusters := c.Clusters[:0]
+	for _, e := range c.Clusters {
+		if e.Name != name {
+			clusters = append(clusters, e)
+		}
+	}
+	c.Clusters = clusters
+}
+
+func (c *Config) removeUser(name string) {
+	users := c.Users[:0]
+	for _, e := range c.Users {
+		if e.Name != name {
+			users = append(users, e)
+		}
+	}
+	c.Users = users
+}
+
+// ContextName returns the conventional name of the context, cluster and
+// user entries for a DigitalOcean Kubernetes cluster.
+func ContextName(region, clusterName string) string {
+	return "do-" + region + "-" + clusterName
+}
+
+// ClusterID returns the ID of the DigitalOcean Kubernetes cluster served at
+// an API server URL, if it is one.
+func ClusterID(server string) (string, bool) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", false
+	}
+	host := u.Hostname()
+	if !strings.HasSuffix(host, doksHostSuffix) {
+		return "", false
+	}
+	id := strings.TrimSuffix(host, doksHostSuffix)
+	if id == "" || strings.Contains(id, ".") {
+		return "", false
+	}
+	return id, true
+}
+
+// Merge adds the current context of src, with its cluster and user, under
+// name and returns the name used. Entries that already exist under name for
+// the same API server are replaced. When the name is taken by a different
+// cluster, a numeric suffix is added instead so that nothing is overwritten.
+// The user entry is named after the context with an "-admin" suffix.
+func (c *Config) Merge(src *Config, name string) (string, error) {
+	e, err := mergeSource(src)
+	if err != nil {
+		return "", err
+	}
+
+	candidate := name
+	for i := 2; !c.nameAvailable(candidate, e.cluster.Cluster.Server); i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	c.setMerged(e, candidate)
+	return candidate, nil
+}
+
+// mergeAs adds the current context of src like Merge, but under exactly
+// name, replacing whatever entries have it.
+func (c *Config) mergeAs(src *Config, name string) error {
+	e, err := mergeSource(src)
+	if err != nil {
+		return err
+	}
+	c.setMerged(e, name)
+	return nil
+}
+
+// mergeEntries are the entries of a source config that Merge adds.
+type mergeEntries struct {
+	context *NamedContext
+	cluster *NamedCluster
+	user    *NamedUser
+}
+
+func mergeSource(src *Config) (*mergeEntries, error) {
+	srcContext := src.Context(src.CurrentContext)
+	if srcContext == nil {
+		if len(src.Contexts) != 1 {
+			return nil, fmt.Errorf("kubeconfig: source has no current context")
+		}
+		srcContext = &src.Contexts[0]
+	}
+	srcCluster := src.Cluster(srcContext.Context.Cluster)
+	srcUser := src.User(srcContext.Context.AuthInfo)
+	if srcCluster == nil || srcUser == nil {
+		return nil, fmt.Errorf("kubeconfig: context %q refers to a missing cluster or user", srcContext.Name)
+	}
+	return &mergeEntries{context: srcContext, cluster: srcCluster, user: srcUser}, nil
+}
+
+func (c *Config) setMerged(e *mergeEntries, name string) {
+	c.SetCluster(NamedCluster{Name: name, Cluster: e.cluster.Cluster})
+	c.SetUser(NamedUser{Name: name + "-admin", User: e.user.User})
+	ctx := e.context.Context
+	ctx.Cluster = name
+	ctx.AuthInfo = name + "-admin"
+	c.SetContext(NamedContext{Name: name, Context: ctx})
+}
+
+// nameAvailable reports whether entries named name can be written for a
+// cluster served at server.
+func (c *Config) nameAvailable(name, server string) bool {
+	cluster := c.Cluster(name)
+	if cluster != nil {
+		return sameServer(cluster.Cluster.Server, server)
+	}
+	if ctx := c.Context(name); ctx != nil {
+		existing := c.Cluster(ctx.Context.Cluster)
+		return existing != nil && sameServer(existing.Cluster.Server, server)
+	}
+	return c.User(name+"-admin") == nil
+}
+
+func sameServer(a, b string) bool {
+	idA, okA := ClusterID(a)
+	idB, okB := ClusterID(b)
+	if okA && okB {
+		return idA == idB
+	}
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
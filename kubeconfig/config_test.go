@@ -0,0 +1,151 @@
+package kubeconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func doksConfig(id, name string) []byte {
+	return []byte(`apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: Q0EK
+    server: https://` + id + `.k8s.ondigitalocean.com
+  name: ` + name + `
+contexts:
+- context:
+    cluster: ` + name + `
+    user: ` + name + `-admin
+  name: ` + name + `
+current-context: ` + name + `
+kind: Config
+preferences: {}
+users:
+- name: ` + name + `-admin
+  user:
+    token: token-` + id + `
+`)
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	data := []byte(`apiVersion: v1
+kind: Config
+preferences:
+  colors: true
+clusters:
+- name: minikube
+  cluster:
+    server: https://192.168.99.100:8443
+    certificate-authority: /home/user/.minikube/ca.crt
+    proxy-url: http://proxy:3128
+contexts:
+- name: minikube
+  context:
+    cluster: minikube
+    user: minikube
+    namespace: dev
+users:
+- name: minikube
+  user:
+    client-certificate: /home/user/.minikube/client.crt
+current-context: minikube
+`)
+
+	c, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if c.Cluster("minikube").Cluster.Extra["proxy-url"] != "http://proxy:3128" {
+		t.Errorf("unknown cluster field was not kept: %+v", c.Cluster("minikube"))
+	}
+	if c.Context("minikube").Context.Namespace != "dev" {
+		t.Errorf("namespace = %q, expected dev", c.Context("minikube").Context.Namespace)
+	}
+
+	out, err := c.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes returned error: %v", err)
+	}
+	for _, want := range []string{"proxy-url: http://proxy:3128", "client-certificate: /home/user/.minikube/client.crt", "colors: true"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConfig_Merge(t *testing.T) {
+	c := New()
+
+	src, err := Parse(doksConfig("aaa", "do-nyc1-prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := c.Merge(src, ContextName("nyc1", "prod"))
+	if err != nil {
+		t.Fatalf("Merge returned error: %v", err)
+	}
+	if name != "do-nyc1-prod" {
+		t.Errorf("Merge returned %q, expected do-nyc1-prod", name)
+	}
+
+	// Merging the same cluster again replaces the entries.
+	src.Users[0].User.Token = "rotated"
+	if name, _ = c.Merge(src, "do-nyc1-prod"); name != "do-nyc1-prod" {
+		t.Errorf("Merge returned %q, expected do-nyc1-prod", name)
+	}
+	if len(c.Users) != 1 || c.Users[0].User.Token != "rotated" {
+		t.Errorf("users = %+v, expected one rotated user", c.Users)
+	}
+
+	// A different cluster with the same name gets a suffix.
+	other, _ := Parse(doksConfig("bbb", "do-nyc1-prod"))
+	if name, _ = c.Merge(other, "do-nyc1-prod"); name != "do-nyc1-prod-2" {
+		t.Errorf("Merge returned %q, expected do-nyc1-prod-2", name)
+	}
+
+	expected := &NamedContext{Name: "do-nyc1-prod-2", Context: Context{Cluster: "do-nyc1-prod-2", AuthInfo: "do-nyc1-prod-2-admin"}}
+	if got := c.Context("do-nyc1-prod-2"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("context = %+v, expected %+v", got, expected)
+	}
+	if c.Cluster("do-nyc1-prod").Cluster.Server != "https://aaa.k8s.ondigitalocean.com" {
+		t.Error("existing cluster was overwritten")
+	}
+}
+
+func TestConfig_RemoveContext(t *testing.T) {
+	c := New()
+	c.SetCluster(NamedCluster{Name: "shared", Cluster: Cluster{Server: "https://example.com"}})
+	c.SetUser(NamedUser{Name: "alice"})
+	c.SetUser(NamedUser{Name: "bob"})
+	c.SetContext(NamedContext{Name: "a", Context: Context{Cluster: "shared", AuthInfo: "alice"}})
+	c.SetContext(NamedContext{Name: "b", Context: Context{Cluster: "shared", AuthInfo: "bob"}})
+	c.CurrentContext = "a"
+
+	c.RemoveContext("a")
+
+	if c.CurrentContext != "" {
+		t.Errorf("current context = %q, expected it to be unset", c.CurrentContext)
+	}
+	if c.Cluster("shared") == nil {
+		t.Error("cluster still used by context b was removed")
+	}
+	if c.User("alice") != nil || c.User("bob") == nil {
+		t.Errorf("users = %+v, expected only bob", c.Users)
+	}
+}
+
+func TestClusterID(t *testing.T) {
+	tests := map[string]string{
+		"https://8d76f4a6-7d6c-4d5a-a9f7-7dd7a3b1d59b.k8s.ondigitalocean.com": "8d76f4a6-7d6c-4d5a-a9f7-7dd7a3b1d59b",
+		"https://abc.k8s.ondigitalocean.com:443":                              "abc",
+		"https://192.168.99.100:8443":                                         "",
+		"https://a.b.k8s.ondigitalocean.com":                                  "",
+	}
+	for server, expected := range tests {
+		id, ok := ClusterID(server)
+		if id != expected || ok != (expected != "") {
+			t.Errorf("ClusterID(%q) = %q, %v, expected %q", server, id, ok, expected)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package kubeconfig reads, merges and writes kubeconfig files for
+// DigitalOcean Kubernetes clusters without clobbering existing entries.
+package kubeconfig
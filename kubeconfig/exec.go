@@ -0,0 +1,157 @@
+package kubeconfig
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// ExecAPIVersion is the client.authentication.k8s.io version of the
+// ExecCredentials produced by this package.
+const ExecAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// DefaultRefreshBefore is how long before expiry cached credentials are
+// replaced.
+const DefaultRefreshBefore = 5 * time.Minute
+
+// ExecCredential is the object an exec credential plugin prints for kubectl.
+type ExecCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Status     *ExecCredentialStatus `json:"status"`
+}
+
+// ExecCredentialStatus holds the credentials.
+type ExecCredentialStatus struct {
+	ExpirationTimestamp   *time.Time `json:"expirationTimestamp,omitempty"`
+	Token                 string     `json:"token,omitempty"`
+	ClientCertificateData string     `json:"clientCertificateData,omitempty"`
+	ClientKeyData         string     `json:"clientKeyData,omitempty"`
+}
+
+// CredentialProvider produces ExecCredentials from Kubernetes.GetCredentials.
+// Credentials are cached on disk per cluster and only fetched again when
+// they are about to expire.
+type CredentialProvider struct {
+	Client *godo.Client
+
+	// CacheDir holds one file per cluster. Caching is disabled when it is
+	// empty.
+	CacheDir string
+
+	// RefreshBefore defaults to DefaultRefreshBefore.
+	RefreshBefore time.Duration
+}
+
+// DefaultCacheDir returns the per-user cache directory for credentials.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "doks-credentials")
+}
+
+// ExecCredential returns credentials for a cluster, from the cache when they
+// are still fresh.
+func (p *CredentialProvider) ExecCredential(ctx context.Context, clusterID string) (*ExecCredential, error) {
+	if clusterID == "" || strings.ContainsAny(clusterID, `/\.`) {
+		return nil, godo.NewArgError("clusterID", "must be a cluster ID")
+	}
+
+	refresh := p.RefreshBefore
+	if refresh == 0 {
+		refresh = DefaultRefreshBefore
+	}
+
+	creds := p.cached(clusterID)
+	if creds == nil || creds.ExpiresAt.IsZero() || time.Now().Add(refresh).After(creds.ExpiresAt) {
+		var err error
+		creds, _, err = p.Client.Kubernetes.GetCredentials(ctx, clusterID, &godo.KubernetesClusterCredentialsGetRequest{})
+		if err != nil {
+			return nil, err
+		}
+		if err := p.store(clusterID, creds); err != nil {
+			return nil, err
+		}
+	}
+
+	status := &ExecCredentialStatus{
+		Token:                 creds.Token,
+		ClientCertificateData: string(creds.ClientCertificateData),
+		ClientKeyData:         string(creds.ClientKeyData),
+	}
+	if !creds.ExpiresAt.IsZero() {
+		expires := creds.ExpiresAt.UTC()
+		status.ExpirationTimestamp = &expires
+	}
+	return &ExecCredential{APIVersion: ExecAPIVersion, Kind: "ExecCredential", Status: status}, nil
+}
+
+func (p *CredentialProvider) cachePath(clusterID string) string {
+	return filepath.Join(p.CacheDir, clusterID+".json")
+}
+
+// cached returns the cached credentials of a cluster, or nil. Unreadable
+// cache files are ignored and replaced on the next fetch.
+func (p *CredentialProvider) cached(clusterID string) *godo.KubernetesClusterCredentials {
+	if p.CacheDir == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(p.cachePath(clusterID))
+	if err != nil {
+		return nil
+	}
+	creds := new(godo.KubernetesClusterCredentials)
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil
+	}
+	return creds
+}
+
+func (p *CredentialProvider) store(clusterID string, creds *godo.KubernetesClusterCredentials) error {
+	if p.CacheDir == "" {
+		return nil
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p.cachePath(clusterID), data)
+}
+
+// ExecUser returns credentials that run command to obtain an ExecCredential
+// for a cluster. The cluster ID is passed with the --cluster-id flag.
+func ExecUser(command, clusterID string) AuthInfo {
+	return AuthInfo{
+		Exec: &ExecConfig{
+			APIVersion: ExecAPIVersion,
+			Command:    command,
+			Args:       []string{"--cluster-id", clusterID},
+		},
+	}
+}
+
+// ExecKubeconfig returns the kubeconfig of a cluster with the embedded
+// credentials replaced by an exec user that runs command, so that the
+// kubeconfig never holds a token that expires.
+func ExecKubeconfig(ctx context.Context, client *godo.Client, clusterID, command string) (*Config, error) {
+	config, _, err := client.Kubernetes.GetKubeConfig(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(config.KubeconfigYAML)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.Users {
+		c.Users[i].User = ExecUser(command, clusterID)
+	}
+	return c, nil
+}
@@ -0,0 +1,96 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCredentialProvider(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	fetches := 0
+	mux.HandleFunc("/v2/kubernetes/clusters/aaa/credentials", func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		fmt.Fprintf(w, `{"server": "https://aaa.k8s.ondigitalocean.com", "token": "token-%d", "expires_at": %q}`,
+			fetches, expires.Format(time.RFC3339))
+	})
+
+	p := &CredentialProvider{Client: client, CacheDir: dir}
+
+	cred, err := p.ExecCredential(ctx, "aaa")
+	if err != nil {
+		t.Fatalf("ExecCredential returned error: %v", err)
+	}
+	expected := &ExecCredential{
+		APIVersion: ExecAPIVersion,
+		Kind:       "ExecCredential",
+		Status:     &ExecCredentialStatus{Token: "token-1", ExpirationTimestamp: &expires},
+	}
+	if !reflect.DeepEqual(cred, expected) {
+		t.Errorf("ExecCredential returned %+v, expected %+v", cred.Status, expected.Status)
+	}
+
+	data, _ := json.Marshal(cred)
+	expectedJSON := fmt.Sprintf(`{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","status":{"expirationTimestamp":%q,"token":"token-1"}}`,
+		expires.Format(time.RFC3339))
+	if string(data) != expectedJSON {
+		t.Errorf("ExecCredential JSON = %s, expected %s", data, expectedJSON)
+	}
+
+	// Fresh credentials come from the cache.
+	if cred, _ = p.ExecCredential(ctx, "aaa"); cred.Status.Token != "token-1" || fetches != 1 {
+		t.Errorf("token = %q after %d fetches, expected cached token-1", cred.Status.Token, fetches)
+	}
+	if fi, err := os.Stat(p.cachePath("aaa")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("cache file: %v, %v", fi, err)
+	}
+
+	// Credentials that expire within RefreshBefore are fetched again.
+	p.RefreshBefore = 2 * time.Hour
+	if cred, _ = p.ExecCredential(ctx, "aaa"); cred.Status.Token != "token-2" || fetches != 2 {
+		t.Errorf("token = %q after %d fetches, expected refreshed token-2", cred.Status.Token, fetches)
+	}
+
+	if _, err := p.ExecCredential(ctx, "../aaa"); err == nil {
+		t.Error("expected error for a cluster ID containing a path")
+	}
+}
+
+func TestExecKubeconfig(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/kubernetes/clusters/aaa/kubeconfig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(doksConfig("aaa", "do-nyc1-prod"))
+	})
+
+	c, err := ExecKubeconfig(ctx, client, "aaa", "doks-credential")
+	if err != nil {
+		t.Fatalf("ExecKubeconfig returned error: %v", err)
+	}
+
+	expected := []NamedUser{{
+		Name: "do-nyc1-prod-admin",
+		User: AuthInfo{Exec: &ExecConfig{
+			APIVersion: ExecAPIVersion,
+			Command:    "doks-credential",
+			Args:       []string{"--cluster-id", "aaa"},
+		}},
+	}}
+	if !reflect.DeepEqual(c.Users, expected) {
+		t.Errorf("users = %+v, expected %+v", c.Users, expected)
+	}
+	if c.Cluster("do-nyc1-prod").Cluster.CertificateAuthorityData != "Q0EK" {
+		t.Error("cluster entry was not kept")
+	}
+}
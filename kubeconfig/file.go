@@ -0,0 +1,357 @@
+package kubeconfig
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/digitalocean/godo"
+)
+
+// Paths returns the kubeconfig files in use: the entries of the KUBECONFIG
+// environment variable, or ~/.kube/config when it is not set.
+func Paths() []string {
+	var paths []string
+	for _, p := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) > 0 {
+		return paths
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return []string{filepath.Join(home, ".kube", "config")}
+}
+
+// Load reads a kubeconfig file. A missing file yields an empty config.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// WriteFile writes a kubeconfig file atomically, readable only by its owner.
+// The file is written to a temporary file next to it and renamed into place,
+// so readers never see a partial file.
+func WriteFile(path string, c *Config) error {
+	data, err := c.Bytes()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file with mode 0600 and renames
+// it to path, creating the directory if needed.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Manager edits the kubeconfig files in Paths the way kubectl does: entries
+// are read from all files with the first definition of a name winning, an
+// entry is updated in the file that defines it, and new entries go to the
+// first file. Only files that change are written.
+type Manager struct {
+	Paths []string
+}
+
+// NewManager returns a Manager for the kubeconfig files in use.
+func NewManager() *Manager {
+	return &Manager{Paths: Paths()}
+}
+
+type configFile struct {
+	path   string
+	config *Config
+	dirty  bool
+}
+
+func (m *Manager) load() ([]*configFile, error) {
+	paths := m.Paths
+	if len(paths) == 0 {
+		paths = Paths()
+	}
+
+	files := make([]*configFile, 0, len(paths))
+	for _, p := range paths {
+		c, err := Load(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &configFile{path: p, config: c})
+	}
+	return files, nil
+}
+
+func (m *Manager) save(files []*configFile) error {
+	for _, f := range files {
+		if !f.dirty {
+			continue
+		}
+		if err := WriteFile(f.path, f.config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merged returns the combined view of all files.
+func merged(files []*configFile) *Config {
+	c := New()
+	for _, f := range files {
+		for _, e := range f.config.Clusters {
+			if c.Cluster(e.Name) == nil {
+				c.Clusters = append(c.Clusters, e)
+			}
+		}
+		for _, e := range f.config.Users {
+			if c.User(e.Name) == nil {
+				c.Users = append(c.Users, e)
+			}
+		}
+		for _, e := range f.config.Contexts {
+			if c.Context(e.Name) == nil {
+				c.Contexts = append(c.Contexts, e)
+			}
+		}
+		if c.CurrentContext == "" {
+			c.CurrentContext = f.config.CurrentContext
+		}
+	}
+	return c
+}
+
+// fileDefining returns the file that defines a context, or the first file.
+func fileDefining(files []*configFile, name string) *configFile {
+	for _, f := range files {
+		if f.config.Context(name) != nil || f.config.Cluster(name) != nil {
+			return f
+		}
+	}
+	return files[0]
+}
+
+// currentContextFile returns the file that sets the current context, or the
+// first file.
+func currentContextFile(files []*configFile) *configFile {
+	for _, f := range files {
+		if f.config.CurrentContext != "" {
+			return f
+		}
+	}
+	return files[0]
+}
+
+// Config returns the combined view of all kubeconfig files.
+func (m *Manager) Config() (*Config, error) {
+	files, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	return merged(files), nil
+}
+
+// Add merges a kubeconfig, such as the KubeconfigYAML returned by
+// Kubernetes.GetKubeConfig, under name. It returns the context name used,
+// which has a numeric suffix if name was taken by a different cluster.
+func (m *Manager) Add(kubeconfigYAML []byte, name string, setCurrent bool) (string, error) {
+	src, err := Parse(kubeconfigYAML)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := m.load()
+	if err != nil {
+		return "", err
+	}
+
+	// Pick a name that is free across all files, then write the entries
+	// under exactly that name to the file that already holds it.
+	name, err = merged(files).Merge(src, name)
+	if err != nil {
+		return "", err
+	}
+	target := fileDefining(files, name)
+	if err := target.config.mergeAs(src, name); err != nil {
+		return "", err
+	}
+	target.dirty = true
+
+	if setCurrent {
+		f := currentContextFile(files)
+		f.config.CurrentContext = name
+		f.dirty = true
+	}
+	return name, m.save(files)
+}
+
+// AddCluster fetches the kubeconfig of a DigitalOcean Kubernetes cluster
+// and merges it under the name do-<region>-<name>.
+func (m *Manager) AddCluster(ctx context.Context, client *godo.Client, clusterID string, setCurrent bool) (string, error) {
+	cluster, _, err := client.Kubernetes.Get(ctx, clusterID)
+	if err != nil {
+		return "", err
+	}
+	config, _, err := client.Kubernetes.GetKubeConfig(ctx, clusterID)
+	if err != nil {
+		return "", err
+	}
+	return m.Add(config.KubeconfigYAML, ContextName(cluster.RegionSlug, cluster.Name), setCurrent)
+}
+
+// UseContext makes the named context current.
+func (m *Manager) UseContext(name string) error {
+	files, err := m.load()
+	if err != nil {
+		return err
+	}
+	if merged(files).Context(name) == nil {
+		return godo.NewArgError("name", "no context named "+name)
+	}
+
+	f := currentContextFile(files)
+	f.config.CurrentContext = name
+	f.dirty = true
+	return m.save(files)
+}
+
+// UnsetCurrentContext clears the current context.
+func (m *Manager) UnsetCurrentContext() error {
+	files, err := m.load()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.config.CurrentContext != "" {
+			f.config.CurrentContext = ""
+			f.dirty = true
+		}
+	}
+	return m.save(files)
+}
+
+// Prune removes the contexts, clusters and users of DigitalOcean Kubernetes
+// clusters that Kubernetes.List no longer returns, and returns the names of
+// the removed contexts. Entries for other clusters are left alone.
+func (m *Manager) Prune(ctx context.Context, client *godo.Client) ([]string, error) {
+	live, err := listClusterIDs(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+
+	gone := func(cluster *NamedCluster) bool {
+		if cluster == nil {
+			return false
+		}
+		id, ok := ClusterID(cluster.Cluster.Server)
+		return ok && !live[id]
+	}
+
+	// Contexts may refer to clusters defined in another file, so resolve
+	// them against the combined view.
+	all := merged(files)
+
+	removed := make(map[string]bool)
+	for _, f := range files {
+		c := f.config
+		var stale []string
+		for _, e := range c.Contexts {
+			if gone(all.Cluster(e.Context.Cluster)) {
+				stale = append(stale, e.Name)
+			}
+		}
+		for _, name := range stale {
+			c.RemoveContext(name)
+			removed[name] = true
+			f.dirty = true
+		}
+
+		// Remove cluster entries that no context referred to.
+		for _, e := range append([]NamedCluster(nil), c.Clusters...) {
+			if gone(&e) {
+				c.removeCluster(e.Name)
+				f.dirty = true
+			}
+		}
+	}
+
+	for _, f := range files {
+		if removed[f.config.CurrentContext] {
+			f.config.CurrentContext = ""
+			f.dirty = true
+		}
+	}
+
+	names := make([]string, 0, len(removed))
+	for name := range removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, m.save(files)
+}
+
+func listClusterIDs(ctx context.Context, client *godo.Client) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	opt := &godo.ListOptions{}
+	for {
+		clusters, resp, err := client.Kubernetes.List(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range clusters {
+			ids[c.ID] = true
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			return ids, nil
+		}
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return nil, err
+		}
+		opt.Page = page + 1
+	}
+}
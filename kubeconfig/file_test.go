@@ -0,0 +1,287 @@
+package kubeconfig
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+var (
+	mux *http.ServeMux
+
+	ctx = context.TODO()
+
+	client *godo.Client
+
+	server *httptest.Server
+)
+
+func setup() {
+	mux = http.NewServeMux()
+	server = httptest.NewServer(mux)
+
+	client = godo.NewClient(nil)
+	url, _ := url.Parse(server.URL)
+	client.BaseURL = url
+}
+
+func teardown() {
+	server.Close()
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPaths(t *testing.T) {
+	old := os.Getenv("KUBECONFIG")
+	defer os.Setenv("KUBECONFIG", old)
+
+	os.Setenv("KUBECONFIG", "/a"+string(filepath.ListSeparator)+string(filepath.ListSeparator)+"/b")
+	if got := Paths(); !reflect.DeepEqual(got, []string{"/a", "/b"}) {
+		t.Errorf("Paths returned %v, expected [/a /b]", got)
+	}
+
+	os.Setenv("KUBECONFIG", "")
+	if got := Paths(); len(got) != 1 || filepath.Base(got[0]) != "config" {
+		t.Errorf("Paths returned %v, expected ~/.kube/config", got)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nested", "config")
+	if err := WriteFile(path, New()); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, expected 0600", fi.Mode().Perm())
+	}
+
+	entries, _ := ioutil.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the config file, found %d entries", len(entries))
+	}
+}
+
+func TestManager(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+
+	existing := New()
+	existing.SetCluster(NamedCluster{Name: "minikube", Cluster: Cluster{Server: "https://192.168.99.100:8443"}})
+	existing.SetUser(NamedUser{Name: "minikube"})
+	existing.SetContext(NamedContext{Name: "minikube", Context: Context{Cluster: "minikube", AuthInfo: "minikube"}})
+	existing.CurrentContext = "minikube"
+	if err := WriteFile(second, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{Paths: []string{first, second}}
+
+	name, err := m.Add(doksConfig("aaa", "do-nyc1-prod"), "do-nyc1-prod", false)
+	if err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+	if name != "do-nyc1-prod" {
+		t.Errorf("Add returned %q, expected do-nyc1-prod", name)
+	}
+
+	c, err := m.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CurrentContext != "minikube" {
+		t.Errorf("current context = %q, expected minikube", c.CurrentContext)
+	}
+	written, _ := Load(first)
+	if written.Context("do-nyc1-prod") == nil {
+		t.Error("new context was not written to the first file")
+	}
+
+	if err := m.UseContext("do-nyc1-prod"); err != nil {
+		t.Fatalf("UseContext returned error: %v", err)
+	}
+	if c, _ := Load(second); c.CurrentContext != "do-nyc1-prod" {
+		t.Errorf("current context in the file that set it = %q, expected do-nyc1-prod", c.CurrentContext)
+	}
+	if err := m.UseContext("missing"); err == nil {
+		t.Error("expected error using a missing context")
+	}
+
+	if err := m.UnsetCurrentContext(); err != nil {
+		t.Fatalf("UnsetCurrentContext returned error: %v", err)
+	}
+	if c, _ := m.Config(); c.CurrentContext != "" {
+		t.Errorf("current context = %q, expected it to be unset", c.CurrentContext)
+	}
+}
+
+func TestManager_AddSplitContext(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+
+	// The first file holds the context, the second file its cluster and
+	// a different cluster under the name a suffix would pick.
+	contexts := New()
+	contexts.SetContext(NamedContext{Name: "do-nyc1-prod", Context: Context{Cluster: "prod", AuthInfo: "prod"}})
+	if err := WriteFile(first, contexts); err != nil {
+		t.Fatal(err)
+	}
+	clusters := New()
+	clusters.SetCluster(NamedCluster{Name: "prod", Cluster: Cluster{Server: "https://aaa.k8s.ondigitalocean.com"}})
+	clusters.SetCluster(NamedCluster{Name: "do-nyc1-prod-2", Cluster: Cluster{Server: "https://bbb.k8s.ondigitalocean.com"}})
+	if err := WriteFile(second, clusters); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{Paths: []string{first, second}}
+	name, err := m.Add(doksConfig("aaa", "do-nyc1-prod"), "do-nyc1-prod", true)
+	if err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+	if name != "do-nyc1-prod" {
+		t.Errorf("Add returned %q, expected do-nyc1-prod", name)
+	}
+
+	c, _ := m.Config()
+	if c.CurrentContext != name || c.Context(name) == nil {
+		t.Errorf("current context = %q, expected the added context %q", c.CurrentContext, name)
+	}
+	if cluster := c.Cluster(c.Context(name).Context.Cluster); cluster == nil || cluster.Cluster.Server != "https://aaa.k8s.ondigitalocean.com" {
+		t.Errorf("added context points at %+v, expected the aaa cluster", cluster)
+	}
+	if cluster := c.Cluster("do-nyc1-prod-2"); cluster.Cluster.Server != "https://bbb.k8s.ondigitalocean.com" {
+		t.Errorf("do-nyc1-prod-2 was shadowed by %+v", cluster)
+	}
+}
+
+func TestManager_AddClusterAndPrune(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	mux.HandleFunc("/v2/kubernetes/clusters/aaa", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_cluster": {"id": "aaa", "name": "prod", "region": "nyc1"}}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/aaa/kubeconfig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(doksConfig("aaa", "do-nyc1-prod"))
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/bbb", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_cluster": {"id": "bbb", "name": "staging", "region": "ams3"}}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/bbb/kubeconfig", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(doksConfig("bbb", "do-ams3-staging"))
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_clusters": [{"id": "bbb"}], "links": {}}`)
+	})
+
+	path := filepath.Join(dir, "config")
+	existing := New()
+	existing.SetCluster(NamedCluster{Name: "minikube", Cluster: Cluster{Server: "https://192.168.99.100:8443"}})
+	existing.SetContext(NamedContext{Name: "minikube", Context: Context{Cluster: "minikube", AuthInfo: "minikube"}})
+	if err := WriteFile(path, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{Paths: []string{path}}
+	for _, id := range []string{"aaa", "bbb"} {
+		if _, err := m.AddCluster(ctx, client, id, id == "aaa"); err != nil {
+			t.Fatalf("AddCluster returned error: %v", err)
+		}
+	}
+
+	removed, err := m.Prune(ctx, client)
+	if err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"do-nyc1-prod"}) {
+		t.Errorf("Prune removed %v, expected [do-nyc1-prod]", removed)
+	}
+
+	c, _ := Load(path)
+	var contexts []string
+	for _, e := range c.Contexts {
+		contexts = append(contexts, e.Name)
+	}
+	if !reflect.DeepEqual(contexts, []string{"minikube", "do-ams3-staging"}) {
+		t.Errorf("contexts = %v, expected [minikube do-ams3-staging]", contexts)
+	}
+	if c.Cluster("do-nyc1-prod") != nil || c.User("do-nyc1-prod-admin") != nil {
+		t.Error("entries of the deleted cluster were kept")
+	}
+	if c.CurrentContext != "" {
+		t.Errorf("current context = %q, expected it to be unset", c.CurrentContext)
+	}
+}
+
+func TestManager_PruneSplitContext(t *testing.T) {
+	setup()
+	defer teardown()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	mux.HandleFunc("/v2/kubernetes/clusters", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_clusters": [], "links": {}}`)
+	})
+
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+
+	contexts := New()
+	contexts.SetContext(NamedContext{Name: "do-nyc1-prod", Context: Context{Cluster: "prod", AuthInfo: "prod"}})
+	contexts.CurrentContext = "do-nyc1-prod"
+	if err := WriteFile(first, contexts); err != nil {
+		t.Fatal(err)
+	}
+	clusters := New()
+	clusters.SetCluster(NamedCluster{Name: "prod", Cluster: Cluster{Server: "https://aaa.k8s.ondigitalocean.com"}})
+	if err := WriteFile(second, clusters); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{Paths: []string{first, second}}
+	removed, err := m.Prune(ctx, client)
+	if err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"do-nyc1-prod"}) {
+		t.Errorf("Prune removed %v, expected [do-nyc1-prod]", removed)
+	}
+
+	c, _ := m.Config()
+	if len(c.Contexts) != 0 || len(c.Clusters) != 0 || c.CurrentContext != "" {
+		t.Errorf("config after Prune = %+v, expected it to be empty", c)
+	}
+}
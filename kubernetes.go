@@ -34,6 +34,9 @@ type KubernetesService interface {
 	Update(context.Context, string, *KubernetesClusterUpdateRequest) (*KubernetesCluster, *Response, error)
 	Upgrade(context.Context, string, *KubernetesClusterUpgradeRequest) (*Response, error)
 	Delete(context.Context, string) (*Response, error)
+	DeleteSelective(context.Context, string, *KubernetesClusterDeleteSelectiveRequest) (*Response, error)
+	DeleteDangerous(context.Context, string) (*Response, error)
+	ListAssociatedResourcesForDeletion(context.Context, string) (*KubernetesAssociatedResources, *Response, error)
 
 	CreateNodePool(ctx context.Context, clusterID string, req *KubernetesNodePoolCreateRequest) (*KubernetesNodePool, *Response, error)
 	GetNodePool(ctx context.Context, clusterID, poolID string) (*KubernetesNodePool, *Response, error)
@@ -48,6 +51,9 @@ type KubernetesService interface {
 	GetOptions(context.Context) (*KubernetesOptions, *Response, error)
 	AddRegistry(ctx context.Context, req *KubernetesClusterRegistryRequest) (*Response, error)
 	RemoveRegistry(ctx context.Context, req *KubernetesClusterRegistryRequest) (*Response, error)
+
+	RunClusterlint(ctx context.Context, clusterID string, req *KubernetesRunClusterlintRequest) (string, *Response, error)
+	GetClusterlintResults(ctx context.Context, clusterID string, req *KubernetesGetClusterlintRequest) ([]*ClusterlintDiagnostic, *Response, error)
 }
 
 var _ KubernetesService = &KubernetesServiceOp{}
@@ -153,6 +159,65 @@ type KubernetesClusterRegistryRequest struct {
 	ClusterUUIDs []string `json:"cluster_uuids,omitempty"`
 }
 
+// KubernetesClusterDeleteSelectiveRequest is a request to delete a cluster
+// together with the chosen associated resources, given by ID.
+type KubernetesClusterDeleteSelectiveRequest struct {
+	Volumes         []string `json:"volumes"`
+	VolumeSnapshots []string `json:"volume_snapshots"`
+	LoadBalancers   []string `json:"load_balancers"`
+}
+
+// KubernetesAssociatedResources lists the resources created by a cluster
+// that can be deleted together with it.
+type KubernetesAssociatedResources struct {
+	Volumes         []*AssociatedResource `json:"volumes"`
+	VolumeSnapshots []*AssociatedResource `json:"volume_snapshots"`
+	LoadBalancers   []*AssociatedResource `json:"load_balancers"`
+}
+
+// AssociatedResource is a resource associated with a cluster.
+type AssociatedResource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// KubernetesRunClusterlintRequest selects the clusterlint checks to run,
+// by group or by name. An empty request runs the default checks.
+type KubernetesRunClusterlintRequest struct {
+	IncludeGroups []string `json:"include_groups"`
+	ExcludeGroups []string `json:"exclude_groups"`
+	IncludeChecks []string `json:"include_checks"`
+	ExcludeChecks []string `json:"exclude_checks"`
+}
+
+// KubernetesGetClusterlintRequest selects the clusterlint run to fetch the
+// diagnostics of. An empty RunId selects the latest run.
+type KubernetesGetClusterlintRequest struct {
+	RunId string `json:"run_id"`
+}
+
+// ClusterlintDiagnostic is a problem found by clusterlint.
+type ClusterlintDiagnostic struct {
+	CheckName string             `json:"check_name"`
+	Severity  string             `json:"severity"`
+	Message   string             `json:"message"`
+	Object    *ClusterlintObject `json:"object"`
+}
+
+// ClusterlintObject is the Kubernetes object a diagnostic is about.
+type ClusterlintObject struct {
+	Kind      string              `json:"kind"`
+	Name      string              `json:"name"`
+	Namespace string              `json:"namespace"`
+	Owners    []*ClusterlintOwner `json:"owners,omitempty"`
+}
+
+// ClusterlintOwner is an owner of a ClusterlintObject.
+type ClusterlintOwner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
 // KubernetesCluster represents a Kubernetes cluster.
 type KubernetesCluster struct {
 	ID            string   `json:"id,omitempty"`
@@ -436,6 +501,14 @@ type kubernetesUpgradesRoot struct {
 	AvailableUpgradeVersions []*KubernetesVersion `json:"available_upgrade_versions,omitempty"`
 }
 
+type clusterlintRunRoot struct {
+	RunID string `json:"run_id"`
+}
+
+type clusterlintDiagnosticsRoot struct {
+	Diagnostics []*ClusterlintDiagnostic `json:"diagnostics"`
+}
+
 // Get retrieves the details of a Kubernetes cluster.
 func (svc *KubernetesServiceOp) Get(ctx context.Context, clusterID string) (*KubernetesCluster, *Response, error) {
 	path := fmt.Sprintf("%s/%s", kubernetesClustersPath, clusterID)
@@ -512,6 +585,54 @@ func (svc *KubernetesServiceOp) Delete(ctx context.Context, clusterID string) (*
 	return resp, nil
 }
 
+// DeleteSelective deletes a Kubernetes cluster together with the associated
+// resources given in the request. Other associated resources are kept.
+func (svc *KubernetesServiceOp) DeleteSelective(ctx context.Context, clusterID string, request *KubernetesClusterDeleteSelectiveRequest) (*Response, error) {
+	path := fmt.Sprintf("%s/%s/destroy_with_associated_resources/selective", kubernetesClustersPath, clusterID)
+	req, err := svc.client.NewRequest(ctx, http.MethodDelete, path, request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := svc.client.Do(ctx, req, nil)
+	if err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// DeleteDangerous deletes a Kubernetes cluster together with all of its
+// associated resources. There is no way to recover the cluster or the
+// resources once they have been destroyed.
+func (svc *KubernetesServiceOp) DeleteDangerous(ctx context.Context, clusterID string) (*Response, error) {
+	path := fmt.Sprintf("%s/%s/destroy_with_associated_resources/dangerous", kubernetesClustersPath, clusterID)
+	req, err := svc.client.NewRequest(ctx, http.MethodDelete, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := svc.client.Do(ctx, req, nil)
+	if err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// ListAssociatedResourcesForDeletion lists the load balancers, volumes and
+// volume snapshots created by a cluster, which can be deleted together with
+// it using DeleteSelective or DeleteDangerous.
+func (svc *KubernetesServiceOp) ListAssociatedResourcesForDeletion(ctx context.Context, clusterID string) (*KubernetesAssociatedResources, *Response, error) {
+	path := fmt.Sprintf("%s/%s/destroy_with_associated_resources", kubernetesClustersPath, clusterID)
+	req, err := svc.client.NewRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := new(KubernetesAssociatedResources)
+	resp, err := svc.client.Do(ctx, req, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	return root, resp, nil
+}
+
 // List returns a list of the Kubernetes clusters visible with the caller's API token.
 func (svc *KubernetesServiceOp) List(ctx context.Context, opts *ListOptions) ([]*KubernetesCluster, *Response, error) {
 	path := kubernetesClustersPath
@@ -799,3 +920,40 @@ func (svc *KubernetesServiceOp) RemoveRegistry(ctx context.Context, req *Kuberne
 	}
 	return resp, nil
 }
+
+// RunClusterlint starts a clusterlint run on a cluster and returns the ID of
+// the run. Its diagnostics can be fetched using GetClusterlintResults.
+func (svc *KubernetesServiceOp) RunClusterlint(ctx context.Context, clusterID string, req *KubernetesRunClusterlintRequest) (string, *Response, error) {
+	path := fmt.Sprintf("%s/%s/clusterlint", kubernetesClustersPath, clusterID)
+	request, err := svc.client.NewRequest(ctx, http.MethodPost, path, req)
+	if err != nil {
+		return "", nil, err
+	}
+	root := new(clusterlintRunRoot)
+	resp, err := svc.client.Do(ctx, request, root)
+	if err != nil {
+		return "", resp, err
+	}
+	return root.RunID, resp, nil
+}
+
+// GetClusterlintResults fetches the diagnostics of a clusterlint run.
+func (svc *KubernetesServiceOp) GetClusterlintResults(ctx context.Context, clusterID string, req *KubernetesGetClusterlintRequest) ([]*ClusterlintDiagnostic, *Response, error) {
+	path := fmt.Sprintf("%s/%s/clusterlint", kubernetesClustersPath, clusterID)
+	if req != nil && req.RunId != "" {
+		v := make(url.Values)
+		v.Set("run_id", req.RunId)
+		path = path + "?" + v.Encode()
+	}
+
+	request, err := svc.client.NewRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := new(clusterlintDiagnosticsRoot)
+	resp, err := svc.client.Do(ctx, request, root)
+	if err != nil {
+		return nil, resp, err
+	}
+	return root.Diagnostics, resp, nil
+}
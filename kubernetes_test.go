@@ -961,6 +961,95 @@ func TestKubernetesClusters_Destroy(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestKubernetesClusters_DeleteSelective(t *testing.T) {
+	setup()
+	defer teardown()
+
+	kubeSvc := client.Kubernetes
+
+	deleteRequest := &KubernetesClusterDeleteSelectiveRequest{
+		Volumes:         []string{"2241"},
+		VolumeSnapshots: []string{"7258"},
+		LoadBalancers:   []string{"9873"},
+	}
+
+	mux.HandleFunc("/v2/kubernetes/clusters/deadbeef-dead-4aa5-beef-deadbeef347d/destroy_with_associated_resources/selective", func(w http.ResponseWriter, r *http.Request) {
+		v := new(KubernetesClusterDeleteSelectiveRequest)
+		err := json.NewDecoder(r.Body).Decode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testMethod(t, r, http.MethodDelete)
+		require.Equal(t, v, deleteRequest)
+	})
+
+	_, err := kubeSvc.DeleteSelective(ctx, "deadbeef-dead-4aa5-beef-deadbeef347d", deleteRequest)
+	require.NoError(t, err)
+}
+
+func TestKubernetesClusters_DeleteDangerous(t *testing.T) {
+	setup()
+	defer teardown()
+
+	kubeSvc := client.Kubernetes
+
+	mux.HandleFunc("/v2/kubernetes/clusters/deadbeef-dead-4aa5-beef-deadbeef347d/destroy_with_associated_resources/dangerous", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+	})
+
+	_, err := kubeSvc.DeleteDangerous(ctx, "deadbeef-dead-4aa5-beef-deadbeef347d")
+	require.NoError(t, err)
+}
+
+func TestKubernetesClusters_ListAssociatedResourcesForDeletion(t *testing.T) {
+	setup()
+	defer teardown()
+
+	kubeSvc := client.Kubernetes
+	want := &KubernetesAssociatedResources{
+		Volumes: []*AssociatedResource{
+			{ID: "2241", Name: "pvc-2241"},
+		},
+		VolumeSnapshots: []*AssociatedResource{
+			{ID: "7258", Name: "snapshot-7258"},
+		},
+		LoadBalancers: []*AssociatedResource{
+			{ID: "9873", Name: "lb-9873"},
+		},
+	}
+	jBlob := `
+{
+	"volumes": [
+		{
+			"id": "2241",
+			"name": "pvc-2241"
+		}
+	],
+	"volume_snapshots": [
+		{
+			"id": "7258",
+			"name": "snapshot-7258"
+		}
+	],
+	"load_balancers": [
+		{
+			"id": "9873",
+			"name": "lb-9873"
+		}
+	]
+}`
+
+	mux.HandleFunc("/v2/kubernetes/clusters/deadbeef-dead-4aa5-beef-deadbeef347d/destroy_with_associated_resources", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, jBlob)
+	})
+
+	got, _, err := kubeSvc.ListAssociatedResourcesForDeletion(ctx, "deadbeef-dead-4aa5-beef-deadbeef347d")
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
 func TestKubernetesClusters_CreateNodePool(t *testing.T) {
 	setup()
 	defer teardown()
@@ -1621,3 +1710,83 @@ func TestWeekday_MarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestKubernetesRunClusterlint(t *testing.T) {
+	setup()
+	defer teardown()
+
+	kubeSvc := client.Kubernetes
+	runRequest := &KubernetesRunClusterlintRequest{
+		IncludeGroups: []string{"doks"},
+		ExcludeChecks: []string{"bare-pods"},
+	}
+
+	mux.HandleFunc("/v2/kubernetes/clusters/8d91899c-0739-4a1a-acc5-deadbeefbb8f/clusterlint", func(w http.ResponseWriter, r *http.Request) {
+		v := new(KubernetesRunClusterlintRequest)
+		err := json.NewDecoder(r.Body).Decode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testMethod(t, r, http.MethodPost)
+		require.Equal(t, runRequest, v)
+		fmt.Fprint(w, `{"run_id": "1234"}`)
+	})
+
+	runID, _, err := kubeSvc.RunClusterlint(ctx, "8d91899c-0739-4a1a-acc5-deadbeefbb8f", runRequest)
+	require.NoError(t, err)
+	require.Equal(t, "1234", runID)
+}
+
+func TestKubernetesGetClusterlintResults(t *testing.T) {
+	setup()
+	defer teardown()
+
+	kubeSvc := client.Kubernetes
+	want := []*ClusterlintDiagnostic{
+		{
+			CheckName: "unused-config-map",
+			Severity:  "warning",
+			Message:   "Unused config map",
+			Object: &ClusterlintObject{
+				Kind:      "config map",
+				Name:      "foo",
+				Namespace: "kube-system",
+				Owners: []*ClusterlintOwner{
+					{Kind: "Deployment", Name: "bar"},
+				},
+			},
+		},
+	}
+	jBlob := `
+{
+	"diagnostics": [
+		{
+			"check_name": "unused-config-map",
+			"severity": "warning",
+			"message": "Unused config map",
+			"object": {
+				"kind": "config map",
+				"name": "foo",
+				"namespace": "kube-system",
+				"owners": [
+					{
+						"kind": "Deployment",
+						"name": "bar"
+					}
+				]
+			}
+		}
+	]
+}`
+
+	mux.HandleFunc("/v2/kubernetes/clusters/8d91899c-0739-4a1a-acc5-deadbeefbb8f/clusterlint", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		require.Equal(t, "run_id=1234", r.URL.Query().Encode())
+		fmt.Fprint(w, jBlob)
+	})
+
+	got, _, err := kubeSvc.GetClusterlintResults(ctx, "8d91899c-0739-4a1a-acc5-deadbeefbb8f", &KubernetesGetClusterlintRequest{RunId: "1234"})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
@@ -0,0 +1,250 @@
+package godo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var kubernetesTaintEffects = []string{"NoSchedule", "PreferNoSchedule", "NoExecute"}
+
+// KubernetesValidator checks Kubernetes requests locally against the
+// versions, regions and sizes returned by KubernetesService.GetOptions, and
+// against the sizes each region offers according to RegionsService.List.
+// Both are fetched on first use and cached.
+type KubernetesValidator struct {
+	svc     KubernetesService
+	regions RegionsService
+
+	mu          sync.Mutex
+	options     *KubernetesOptions
+	regionSizes map[string][]string
+}
+
+// NewKubernetesValidator returns a validator that fetches its options from
+// svc and the sizes of each region from regions. If regions is nil, node
+// sizes are not checked per region.
+func NewKubernetesValidator(svc KubernetesService, regions RegionsService) *KubernetesValidator {
+	return &KubernetesValidator{svc: svc, regions: regions}
+}
+
+// Options returns the cached options, fetching them if needed. A failed
+// fetch is retried on the next call.
+func (v *KubernetesValidator) Options(ctx context.Context) (*KubernetesOptions, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.options == nil {
+		options, _, err := v.svc.GetOptions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		v.options = options
+	}
+	return v.options, nil
+}
+
+// sizesByRegion returns the cached sizes offered by each region, fetching
+// them if needed. It returns nil if the validator has no RegionsService.
+func (v *KubernetesValidator) sizesByRegion(ctx context.Context) (map[string][]string, error) {
+	if v.regions == nil {
+		return nil, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.regionSizes == nil {
+		sizes := make(map[string][]string)
+		opt := &ListOptions{}
+		for {
+			regions, resp, err := v.regions.List(ctx, opt)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range regions {
+				sizes[r.Slug] = r.Sizes
+			}
+			if resp.Links == nil || resp.Links.IsLastPage() {
+				break
+			}
+			page, err := resp.Links.CurrentPage()
+			if err != nil {
+				return nil, err
+			}
+			opt.Page = page + 1
+		}
+		v.regionSizes = sizes
+	}
+	return v.regionSizes, nil
+}
+
+// ValidateClusterCreateRequest checks a cluster create request and its node
+// pools, and reports every problem found as ArgErrors. It returns nil if the
+// request is valid.
+func (v *KubernetesValidator) ValidateClusterCreateRequest(ctx context.Context, req *KubernetesClusterCreateRequest) error {
+	if req == nil {
+		return NewArgError("req", "cannot be nil")
+	}
+	options, err := v.Options(ctx)
+	if err != nil {
+		return err
+	}
+	regionSizes, err := v.sizesByRegion(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []*ArgError
+	if req.Name == "" {
+		errs = append(errs, NewArgError("name", "cannot be empty"))
+	}
+	switch {
+	case req.RegionSlug == "":
+		errs = append(errs, NewArgError("region", "cannot be empty"))
+	case !options.hasRegion(req.RegionSlug):
+		errs = append(errs, NewArgError("region", fmt.Sprintf("%q is not offered for Kubernetes", req.RegionSlug)))
+	}
+	switch {
+	case req.VersionSlug == "":
+		errs = append(errs, NewArgError("version", "cannot be empty"))
+	case !options.hasVersion(req.VersionSlug):
+		errs = append(errs, NewArgError("version", fmt.Sprintf("%q is not an available version", req.VersionSlug)))
+	}
+	if p := req.MaintenancePolicy; p != nil && p.StartTime != "" {
+		if !validStartTime(p.StartTime) {
+			errs = append(errs, NewArgError("maintenance_policy.start_time", "must be in HH:MM format"))
+		}
+	}
+
+	if len(req.NodePools) == 0 {
+		errs = append(errs, NewArgError("node_pools", "must contain at least one node pool"))
+	}
+	names := make(map[string]int)
+	for i, p := range req.NodePools {
+		prefix := fmt.Sprintf("node_pools[%d].", i)
+		if p == nil {
+			errs = append(errs, NewArgError(fmt.Sprintf("node_pools[%d]", i), "cannot be nil"))
+			continue
+		}
+		errs = append(errs, options.validateNodePool(prefix, req.RegionSlug, p, regionSizes)...)
+
+		if j, ok := names[p.Name]; ok && p.Name != "" {
+			errs = append(errs, NewArgError(prefix+"name", fmt.Sprintf("%q is already used by node_pools[%d]", p.Name, j)))
+		} else {
+			names[p.Name] = i
+		}
+	}
+
+	return argErrors(errs)
+}
+
+// ValidateNodePoolRequest checks a node pool create request for a cluster in
+// region and reports every problem found as ArgErrors. It returns nil if the
+// request is valid.
+func (v *KubernetesValidator) ValidateNodePoolRequest(ctx context.Context, region string, req *KubernetesNodePoolCreateRequest) error {
+	if req == nil {
+		return NewArgError("req", "cannot be nil")
+	}
+	if region == "" {
+		return NewArgError("region", "cannot be empty")
+	}
+	options, err := v.Options(ctx)
+	if err != nil {
+		return err
+	}
+	regionSizes, err := v.sizesByRegion(ctx)
+	if err != nil {
+		return err
+	}
+	return argErrors(options.validateNodePool("", region, req, regionSizes))
+}
+
+// validateNodePool checks a node pool of a cluster in region. The size is
+// checked against the sizes offered for Kubernetes and, if regionSizes is
+// known for the region, against the sizes the region offers.
+func (o *KubernetesOptions) validateNodePool(prefix, region string, p *KubernetesNodePoolCreateRequest, regionSizes map[string][]string) []*ArgError {
+	var errs []*ArgError
+
+	if p.Name == "" {
+		errs = append(errs, NewArgError(prefix+"name", "cannot be empty"))
+	}
+	offered, known := regionSizes[region]
+	switch {
+	case p.Size == "":
+		errs = append(errs, NewArgError(prefix+"size", "cannot be empty"))
+	case !o.hasSize(p.Size):
+		errs = append(errs, NewArgError(prefix+"size", fmt.Sprintf("%q is not offered for Kubernetes", p.Size)))
+	case known && !oneOf(p.Size, offered):
+		errs = append(errs, NewArgError(prefix+"size", fmt.Sprintf("%q is not available in %s", p.Size, region)))
+	}
+
+	if p.AutoScale {
+		if p.MinNodes < 0 {
+			errs = append(errs, NewArgError(prefix+"min_nodes", "cannot be negative"))
+		}
+		if p.MaxNodes < 1 {
+			errs = append(errs, NewArgError(prefix+"max_nodes", "must be at least 1"))
+		}
+		if p.MinNodes > p.MaxNodes {
+			errs = append(errs, NewArgError(prefix+"min_nodes", fmt.Sprintf("%d is greater than max_nodes %d", p.MinNodes, p.MaxNodes)))
+		}
+		if p.Count != 0 && (p.Count < p.MinNodes || p.Count > p.MaxNodes) {
+			errs = append(errs, NewArgError(prefix+"count", fmt.Sprintf("%d is outside of min_nodes and max_nodes", p.Count)))
+		}
+	} else {
+		if p.Count < 1 {
+			errs = append(errs, NewArgError(prefix+"count", "must be at least 1"))
+		}
+		if p.MinNodes != 0 || p.MaxNodes != 0 {
+			errs = append(errs, NewArgError(prefix+"auto_scale", "must be set to use min_nodes and max_nodes"))
+		}
+	}
+
+	for i, t := range p.Taints {
+		arg := fmt.Sprintf("%staints[%d]", prefix, i)
+		if t.Key == "" {
+			errs = append(errs, NewArgError(arg+".key", "cannot be empty"))
+		}
+		if !oneOf(t.Effect, kubernetesTaintEffects) {
+			errs = append(errs, NewArgError(arg+".effect", "must be one of "+strings.Join(kubernetesTaintEffects, ", ")))
+		}
+	}
+
+	return errs
+}
+
+func (o *KubernetesOptions) hasVersion(slug string) bool {
+	for _, v := range o.Versions {
+		if v.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *KubernetesOptions) hasRegion(slug string) bool {
+	for _, r := range o.Regions {
+		if r.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *KubernetesOptions) hasSize(slug string) bool {
+	for _, s := range o.Sizes {
+		if s.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+func validStartTime(s string) bool {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || len(s) != 5 {
+		return false
+	}
+	return h >= 0 && h < 24 && m >= 0 && m < 60
+}
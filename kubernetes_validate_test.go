@@ -0,0 +1,121 @@
+package godo
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func handleKubernetesOptions(t *testing.T) *int {
+	fetches := 0
+	mux.HandleFunc("/v2/kubernetes/options", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fetches++
+		fmt.Fprint(w, `{"options": {
+			"versions": [{"slug": "1.18.8-do.0"}],
+			"regions": [{"slug": "nyc1"}, {"slug": "sfo2"}],
+			"sizes": [{"slug": "s-1vcpu-2gb"}, {"slug": "s-2vcpu-4gb"}]
+		}}`)
+	})
+	return &fetches
+}
+
+func handleRegionSizes(t *testing.T) {
+	mux.HandleFunc("/v2/regions", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"regions": [
+			{"slug": "nyc1", "sizes": ["s-1vcpu-2gb", "s-2vcpu-4gb"]},
+			{"slug": "sfo2", "sizes": ["s-1vcpu-2gb"]}
+		]}`)
+	})
+}
+
+func TestKubernetesValidator_ValidateClusterCreateRequest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	fetches := handleKubernetesOptions(t)
+	handleRegionSizes(t)
+	v := NewKubernetesValidator(client.Kubernetes, client.Regions)
+
+	valid := &KubernetesClusterCreateRequest{
+		Name:        "prod",
+		RegionSlug:  "nyc1",
+		VersionSlug: "1.18.8-do.0",
+		NodePools: []*KubernetesNodePoolCreateRequest{
+			{Name: "workers", Size: "s-1vcpu-2gb", Count: 3},
+			{Name: "batch", Size: "s-2vcpu-4gb", AutoScale: true, MinNodes: 0, MaxNodes: 5,
+				Taints: []Taint{{Key: "batch", Effect: "NoSchedule"}}},
+		},
+		MaintenancePolicy: &KubernetesMaintenancePolicy{StartTime: "04:00"},
+	}
+	if err := v.ValidateClusterCreateRequest(ctx, valid); err != nil {
+		t.Fatalf("ValidateClusterCreateRequest returned error for a valid request: %v", err)
+	}
+
+	invalid := &KubernetesClusterCreateRequest{
+		Name:        "prod",
+		RegionSlug:  "ams9",
+		VersionSlug: "1.15.3-do.0",
+		NodePools: []*KubernetesNodePoolCreateRequest{
+			{Name: "workers", Size: "s-8vcpu-32gb", Count: 3},
+			{Name: "workers", Size: "s-1vcpu-2gb", AutoScale: true, MinNodes: 4, MaxNodes: 2,
+				Taints: []Taint{{Key: "batch", Effect: "NoEvict"}}},
+		},
+		MaintenancePolicy: &KubernetesMaintenancePolicy{StartTime: "25:00"},
+	}
+	err := v.ValidateClusterCreateRequest(ctx, invalid)
+	errs, ok := err.(ArgErrors)
+	if !ok {
+		t.Fatalf("expected ArgErrors, got %T: %v", err, err)
+	}
+
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	expected := []string{
+		`region is invalid because "ams9" is not offered for Kubernetes`,
+		`version is invalid because "1.15.3-do.0" is not an available version`,
+		"maintenance_policy.start_time is invalid because must be in HH:MM format",
+		`node_pools[0].size is invalid because "s-8vcpu-32gb" is not offered for Kubernetes`,
+		"node_pools[1].min_nodes is invalid because 4 is greater than max_nodes 2",
+		"node_pools[1].taints[0].effect is invalid because must be one of NoSchedule, PreferNoSchedule, NoExecute",
+		`node_pools[1].name is invalid because "workers" is already used by node_pools[0]`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ValidateClusterCreateRequest returned\n%q\nexpected\n%q", got, expected)
+	}
+
+	if *fetches != 1 {
+		t.Errorf("options were fetched %d times, expected 1", *fetches)
+	}
+}
+
+func TestKubernetesValidator_ValidateNodePoolRequest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleKubernetesOptions(t)
+	handleRegionSizes(t)
+	v := NewKubernetesValidator(client.Kubernetes, client.Regions)
+
+	if err := v.ValidateNodePoolRequest(ctx, "sfo2", &KubernetesNodePoolCreateRequest{Name: "a", Size: "s-1vcpu-2gb", Count: 1}); err != nil {
+		t.Errorf("ValidateNodePoolRequest returned error for a valid request: %v", err)
+	}
+
+	err := v.ValidateNodePoolRequest(ctx, "sfo2", &KubernetesNodePoolCreateRequest{Name: "a", Size: "s-2vcpu-4gb", Count: 1})
+	if expected := (ArgErrors{NewArgError("size", `"s-2vcpu-4gb" is not available in sfo2`)}); !reflect.DeepEqual(err, expected) {
+		t.Errorf("ValidateNodePoolRequest returned %v, expected %v", err, expected)
+	}
+
+	err = v.ValidateNodePoolRequest(ctx, "sfo2", &KubernetesNodePoolCreateRequest{Name: "a", Size: "s-1vcpu-2gb", MaxNodes: 3})
+	expected := ArgErrors{
+		NewArgError("count", "must be at least 1"),
+		NewArgError("auto_scale", "must be set to use min_nodes and max_nodes"),
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("ValidateNodePoolRequest returned %v, expected %v", err, expected)
+	}
+}
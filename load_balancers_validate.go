@@ -0,0 +1,314 @@
+package godo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Limits enforced by the API on load balancer health checks.
+const (
+	minHealthCheckSeconds   = 3
+	maxHealthCheckSeconds   = 300
+	minHealthCheckThreshold = 2
+	maxHealthCheckThreshold = 10
+)
+
+var (
+	lbAlgorithms     = []string{"round_robin", "least_connections"}
+	lbSizes          = []string{"lb-small", "lb-medium", "lb-large"}
+	lbProtocols      = []string{"http", "https", "http2", "tcp"}
+	lbCheckProtocols = []string{"http", "https", "tcp"}
+)
+
+// Validate checks a load balancer request locally and reports every problem
+// found as ArgErrors. It returns nil if the request is valid.
+func (l *LoadBalancerRequest) Validate() error {
+	var errs []*ArgError
+
+	if l.Name == "" {
+		errs = append(errs, NewArgError("name", "cannot be empty"))
+	}
+	if l.Region == "" {
+		errs = append(errs, NewArgError("region", "cannot be empty"))
+	}
+	if l.Algorithm != "" && !oneOf(l.Algorithm, lbAlgorithms) {
+		errs = append(errs, NewArgError("algorithm", "must be one of "+strings.Join(lbAlgorithms, ", ")))
+	}
+	if l.SizeSlug != "" && !oneOf(l.SizeSlug, lbSizes) {
+		errs = append(errs, NewArgError("size", "must be one of "+strings.Join(lbSizes, ", ")))
+	}
+	if len(l.DropletIDs) > 0 && l.Tag != "" {
+		errs = append(errs, NewArgError("droplet_ids", "cannot be set together with tag"))
+	}
+
+	if len(l.ForwardingRules) == 0 {
+		errs = append(errs, NewArgError("forwarding_rules", "must contain at least one rule"))
+	}
+	entryPorts := make(map[int]int)
+	hasTCP, hasHTTP, hasHTTPS := false, false, false
+	for i, r := range l.ForwardingRules {
+		errs = append(errs, r.validate(fmt.Sprintf("forwarding_rules[%d].", i))...)
+
+		if j, ok := entryPorts[r.EntryPort]; ok {
+			errs = append(errs, NewArgError(fmt.Sprintf("forwarding_rules[%d].entry_port", i),
+				fmt.Sprintf("%d is already used by forwarding_rules[%d]", r.EntryPort, j)))
+		} else {
+			entryPorts[r.EntryPort] = i
+		}
+
+		switch r.EntryProtocol {
+		case "tcp":
+			hasTCP = true
+		case "http":
+			hasHTTP = true
+		case "https", "http2":
+			hasHTTPS = true
+		}
+	}
+
+	if l.RedirectHttpToHttps && !(hasHTTP && hasHTTPS) {
+		errs = append(errs, NewArgError("redirect_http_to_https", "requires both an http and an https or http2 forwarding rule"))
+	}
+
+	if l.HealthCheck != nil {
+		errs = append(errs, l.HealthCheck.validate("health_check.")...)
+	}
+	if l.StickySessions != nil {
+		errs = append(errs, l.StickySessions.validate("sticky_sessions.")...)
+		if l.StickySessions.Type == "cookies" && hasTCP {
+			errs = append(errs, NewArgError("sticky_sessions.type", "cookies cannot be used with tcp forwarding rules"))
+		}
+	}
+
+	return argErrors(errs)
+}
+
+// Validate checks a forwarding rule locally and reports every problem found
+// as ArgErrors. It returns nil if the rule is valid.
+func (f ForwardingRule) Validate() error {
+	return argErrors(f.validate(""))
+}
+
+func (f ForwardingRule) validate(prefix string) []*ArgError {
+	var errs []*ArgError
+	protocols := "must be one of " + strings.Join(lbProtocols, ", ")
+
+	if !oneOf(f.EntryProtocol, lbProtocols) {
+		errs = append(errs, NewArgError(prefix+"entry_protocol", protocols))
+	}
+	if !oneOf(f.TargetProtocol, lbProtocols) {
+		errs = append(errs, NewArgError(prefix+"target_protocol", protocols))
+	}
+	if f.EntryPort < 1 || f.EntryPort > 65535 {
+		errs = append(errs, NewArgError(prefix+"entry_port", "must be between 1 and 65535"))
+	}
+	if f.TargetPort < 1 || f.TargetPort > 65535 {
+		errs = append(errs, NewArgError(prefix+"target_port", "must be between 1 and 65535"))
+	}
+
+	secure := f.EntryProtocol == "https" || f.EntryProtocol == "http2"
+	if f.TlsPassthrough && f.CertificateID != "" {
+		errs = append(errs, NewArgError(prefix+"tls_passthrough", "cannot be used with a certificate_id"))
+	}
+	if f.TlsPassthrough && !secure {
+		errs = append(errs, NewArgError(prefix+"tls_passthrough", "requires an https or http2 entry_protocol"))
+	}
+	if f.TlsPassthrough && f.TargetProtocol != f.EntryProtocol {
+		errs = append(errs, NewArgError(prefix+"target_protocol", "must match entry_protocol with tls_passthrough"))
+	}
+	if secure && !f.TlsPassthrough && f.CertificateID == "" {
+		errs = append(errs, NewArgError(prefix+"certificate_id", "is required for "+f.EntryProtocol+" unless tls_passthrough is set"))
+	}
+	if !secure && f.CertificateID != "" {
+		errs = append(errs, NewArgError(prefix+"certificate_id", "can only be used with an https or http2 entry_protocol"))
+	}
+
+	if (f.EntryProtocol == "tcp") != (f.TargetProtocol == "tcp") && f.TargetProtocol != "" && f.EntryProtocol != "" {
+		errs = append(errs, NewArgError(prefix+"target_protocol", "must be tcp if and only if entry_protocol is tcp"))
+	}
+	return errs
+}
+
+// Validate checks a health check locally and reports every problem found as
+// ArgErrors. Zero values are left to the API's defaults. It returns nil if
+// the health check is valid.
+func (h HealthCheck) Validate() error {
+	return argErrors(h.validate(""))
+}
+
+func (h HealthCheck) validate(prefix string) []*ArgError {
+	var errs []*ArgError
+
+	if h.Protocol != "" && !oneOf(h.Protocol, lbCheckProtocols) {
+		errs = append(errs, NewArgError(prefix+"protocol", "must be one of "+strings.Join(lbCheckProtocols, ", ")))
+	}
+	if h.Port != 0 && (h.Port < 1 || h.Port > 65535) {
+		errs = append(errs, NewArgError(prefix+"port", "must be between 1 and 65535"))
+	}
+	if h.Protocol == "tcp" && h.Path != "" {
+		errs = append(errs, NewArgError(prefix+"path", "cannot be used with the tcp protocol"))
+	}
+	if h.Path != "" && !strings.HasPrefix(h.Path, "/") {
+		errs = append(errs, NewArgError(prefix+"path", "must start with /"))
+	}
+
+	for _, f := range []struct {
+		name     string
+		value    int
+		min, max int
+	}{
+		{"check_interval_seconds", h.CheckIntervalSeconds, minHealthCheckSeconds, maxHealthCheckSeconds},
+		{"response_timeout_seconds", h.ResponseTimeoutSeconds, minHealthCheckSeconds, maxHealthCheckSeconds},
+		{"healthy_threshold", h.HealthyThreshold, minHealthCheckThreshold, maxHealthCheckThreshold},
+		{"unhealthy_threshold", h.UnhealthyThreshold, minHealthCheckThreshold, maxHealthCheckThreshold},
+	} {
+		if f.value != 0 && (f.value < f.min || f.value > f.max) {
+			errs = append(errs, NewArgError(prefix+f.name, fmt.Sprintf("must be between %d and %d", f.min, f.max)))
+		}
+	}
+	return errs
+}
+
+// Validate checks sticky session settings locally and reports every problem
+// found as ArgErrors. It returns nil if the settings are valid.
+func (s StickySessions) Validate() error {
+	return argErrors(s.validate(""))
+}
+
+func (s StickySessions) validate(prefix string) []*ArgError {
+	var errs []*ArgError
+
+	switch s.Type {
+	case "", "none":
+		if s.CookieName != "" || s.CookieTtlSeconds != 0 {
+			errs = append(errs, NewArgError(prefix+"type", "must be cookies when a cookie is configured"))
+		}
+	case "cookies":
+		if s.CookieName == "" {
+			errs = append(errs, NewArgError(prefix+"cookie_name", "is required for cookies"))
+		}
+		if s.CookieTtlSeconds < 1 {
+			errs = append(errs, NewArgError(prefix+"cookie_ttl_seconds", "must be positive for cookies"))
+		}
+	default:
+		errs = append(errs, NewArgError(prefix+"type", "must be none or cookies"))
+	}
+	return errs
+}
+
+// LoadBalancerChange is a field that an update would change.
+type LoadBalancerChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// String renders the change as "field: old -> new".
+func (c LoadBalancerChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// DiffLoadBalancer lists the fields that updating a load balancer with the
+// request would change. Forwarding rules and droplet IDs are compared
+// regardless of order. Fields left empty in the request, including a nil
+// HealthCheck or StickySessions, are not compared.
+func DiffLoadBalancer(live *LoadBalancer, req *LoadBalancerRequest) []LoadBalancerChange {
+	cur := live.AsRequest()
+	var changes []LoadBalancerChange
+
+	add := func(field string, old, new interface{}) {
+		o, n := fmt.Sprint(old), fmt.Sprint(new)
+		if o != n {
+			changes = append(changes, LoadBalancerChange{Field: field, Old: o, New: n})
+		}
+	}
+
+	addString := func(field, old, new string) {
+		if new != "" {
+			add(field, old, new)
+		}
+	}
+
+	addString("name", cur.Name, req.Name)
+	addString("algorithm", cur.Algorithm, req.Algorithm)
+	addString("region", cur.Region, req.Region)
+	addString("size", cur.SizeSlug, req.SizeSlug)
+	if len(req.ForwardingRules) > 0 {
+		add("forwarding_rules", formatForwardingRules(cur.ForwardingRules), formatForwardingRules(req.ForwardingRules))
+	}
+
+	if req.HealthCheck != nil {
+		old := HealthCheck{}
+		if cur.HealthCheck != nil {
+			old = *cur.HealthCheck
+		}
+		h := req.HealthCheck
+		add("health_check.protocol", old.Protocol, h.Protocol)
+		add("health_check.port", old.Port, h.Port)
+		add("health_check.path", old.Path, h.Path)
+		add("health_check.check_interval_seconds", old.CheckIntervalSeconds, h.CheckIntervalSeconds)
+		add("health_check.response_timeout_seconds", old.ResponseTimeoutSeconds, h.ResponseTimeoutSeconds)
+		add("health_check.healthy_threshold", old.HealthyThreshold, h.HealthyThreshold)
+		add("health_check.unhealthy_threshold", old.UnhealthyThreshold, h.UnhealthyThreshold)
+	}
+	if req.StickySessions != nil {
+		old := StickySessions{}
+		if cur.StickySessions != nil {
+			old = *cur.StickySessions
+		}
+		s := req.StickySessions
+		add("sticky_sessions.type", old.Type, s.Type)
+		add("sticky_sessions.cookie_name", old.CookieName, s.CookieName)
+		add("sticky_sessions.cookie_ttl_seconds", old.CookieTtlSeconds, s.CookieTtlSeconds)
+	}
+
+	if len(req.DropletIDs) > 0 {
+		add("droplet_ids", sortedIDs(cur.DropletIDs), sortedIDs(req.DropletIDs))
+	}
+	addString("tag", cur.Tag, req.Tag)
+	add("redirect_http_to_https", cur.RedirectHttpToHttps, req.RedirectHttpToHttps)
+	add("enable_proxy_protocol", cur.EnableProxyProtocol, req.EnableProxyProtocol)
+	add("enable_backend_keepalive", cur.EnableBackendKeepalive, req.EnableBackendKeepalive)
+	addString("vpc_uuid", cur.VPCUUID, req.VPCUUID)
+	return changes
+}
+
+func formatForwardingRules(rules []ForwardingRule) string {
+	formatted := make([]string, len(rules))
+	for i, r := range rules {
+		s := fmt.Sprintf("%s:%d->%s:%d", r.EntryProtocol, r.EntryPort, r.TargetProtocol, r.TargetPort)
+		if r.CertificateID != "" {
+			s += " certificate=" + r.CertificateID
+		}
+		if r.TlsPassthrough {
+			s += " tls_passthrough"
+		}
+		formatted[i] = s
+	}
+	sort.Strings(formatted)
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
+
+func sortedIDs(ids []int) []int {
+	out := append([]int{}, ids...)
+	sort.Ints(out)
+	return out
+}
+
+func oneOf(s string, values []string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// argErrors returns nil for an empty list, so that callers see a nil error.
+func argErrors(errs []*ArgError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return ArgErrors(errs)
+}
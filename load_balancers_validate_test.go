@@ -0,0 +1,193 @@
+package godo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func validLoadBalancerRequest() *LoadBalancerRequest {
+	return &LoadBalancerRequest{
+		Name:      "example-lb-01",
+		Algorithm: "round_robin",
+		Region:    "nyc3",
+		ForwardingRules: []ForwardingRule{
+			{EntryProtocol: "http", EntryPort: 80, TargetProtocol: "http", TargetPort: 80},
+			{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "http", TargetPort: 80, CertificateID: "cert-1"},
+		},
+		HealthCheck: &HealthCheck{
+			Protocol:               "http",
+			Port:                   80,
+			Path:                   "/index.html",
+			CheckIntervalSeconds:   10,
+			ResponseTimeoutSeconds: 5,
+			HealthyThreshold:       5,
+			UnhealthyThreshold:     3,
+		},
+		StickySessions:      &StickySessions{Type: "cookies", CookieName: "DO-LB", CookieTtlSeconds: 5},
+		DropletIDs:          []int{2, 21},
+		RedirectHttpToHttps: true,
+	}
+}
+
+func TestLoadBalancerRequest_Validate(t *testing.T) {
+	if err := validLoadBalancerRequest().Validate(); err != nil {
+		t.Fatalf("Validate returned error for a valid request: %v", err)
+	}
+
+	req := validLoadBalancerRequest()
+	req.Region = ""
+	req.Tag = "web"
+	req.ForwardingRules = []ForwardingRule{
+		{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "http", TargetPort: 80},
+		{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "https", TargetPort: 443, TlsPassthrough: true, CertificateID: "cert-1"},
+		{EntryProtocol: "tcp", EntryPort: 5432, TargetProtocol: "tcp", TargetPort: 70000},
+	}
+	req.HealthCheck.CheckIntervalSeconds = 1
+	req.HealthCheck.HealthyThreshold = 11
+
+	err := req.Validate()
+	errs, ok := err.(ArgErrors)
+	if !ok {
+		t.Fatalf("expected ArgErrors, got %T: %v", err, err)
+	}
+
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	expected := []string{
+		"region is invalid because cannot be empty",
+		"droplet_ids is invalid because cannot be set together with tag",
+		"forwarding_rules[0].certificate_id is invalid because is required for https unless tls_passthrough is set",
+		"forwarding_rules[1].tls_passthrough is invalid because cannot be used with a certificate_id",
+		"forwarding_rules[1].entry_port is invalid because 443 is already used by forwarding_rules[0]",
+		"forwarding_rules[2].target_port is invalid because must be between 1 and 65535",
+		"redirect_http_to_https is invalid because requires both an http and an https or http2 forwarding rule",
+		"health_check.check_interval_seconds is invalid because must be between 3 and 300",
+		"health_check.healthy_threshold is invalid because must be between 2 and 10",
+		"sticky_sessions.type is invalid because cookies cannot be used with tcp forwarding rules",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Validate returned\n%q\nexpected\n%q", got, expected)
+	}
+}
+
+func TestForwardingRule_Validate(t *testing.T) {
+	tests := []struct {
+		rule  ForwardingRule
+		valid bool
+	}{
+		{ForwardingRule{EntryProtocol: "http2", EntryPort: 443, TargetProtocol: "http", TargetPort: 80, CertificateID: "c"}, true},
+		{ForwardingRule{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "https", TargetPort: 443, TlsPassthrough: true}, true},
+		{ForwardingRule{EntryProtocol: "http", EntryPort: 80, TargetProtocol: "http", TargetPort: 80, CertificateID: "c"}, false},
+		{ForwardingRule{EntryProtocol: "tcp", EntryPort: 80, TargetProtocol: "http", TargetPort: 80}, false},
+		{ForwardingRule{EntryProtocol: "udp", EntryPort: 53, TargetProtocol: "udp", TargetPort: 53}, false},
+		{ForwardingRule{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "http", TargetPort: 80, TlsPassthrough: true}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%v) returned %v, expected valid = %v", tt.rule, err, tt.valid)
+		}
+	}
+}
+
+func TestForwardingRule_ValidateReportsEveryTLSProblem(t *testing.T) {
+	rule := ForwardingRule{EntryProtocol: "http", EntryPort: 80, TargetProtocol: "http", TargetPort: 80, TlsPassthrough: true, CertificateID: "c"}
+	errs, ok := rule.Validate().(ArgErrors)
+	if !ok {
+		t.Fatalf("expected ArgErrors, got %v", rule.Validate())
+	}
+
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	expected := []string{
+		"tls_passthrough is invalid because cannot be used with a certificate_id",
+		"tls_passthrough is invalid because requires an https or http2 entry_protocol",
+		"certificate_id is invalid because can only be used with an https or http2 entry_protocol",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Validate returned\n%q\nexpected\n%q", got, expected)
+	}
+}
+
+func TestStickySessions_Validate(t *testing.T) {
+	if err := (StickySessions{Type: "none"}).Validate(); err != nil {
+		t.Errorf("Validate returned error: %v", err)
+	}
+	err := (StickySessions{Type: "cookies"}).Validate()
+	if errs, ok := err.(ArgErrors); !ok || len(errs) != 2 {
+		t.Errorf("expected two ArgErrors, got %v", err)
+	}
+}
+
+func TestDiffLoadBalancer(t *testing.T) {
+	live := &LoadBalancer{
+		ID:        "lb-1",
+		Name:      "example-lb-01",
+		Algorithm: "round_robin",
+		Region:    &Region{Slug: "nyc3"},
+		ForwardingRules: []ForwardingRule{
+			{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "http", TargetPort: 80, CertificateID: "cert-1"},
+			{EntryProtocol: "http", EntryPort: 80, TargetProtocol: "http", TargetPort: 80},
+		},
+		HealthCheck:         &HealthCheck{Protocol: "http", Port: 80, Path: "/", CheckIntervalSeconds: 10, ResponseTimeoutSeconds: 5, HealthyThreshold: 5, UnhealthyThreshold: 3},
+		StickySessions:      &StickySessions{Type: "none"},
+		DropletIDs:          []int{21, 2},
+		RedirectHttpToHttps: true,
+	}
+
+	if changes := DiffLoadBalancer(live, live.AsRequest()); len(changes) != 0 {
+		t.Errorf("DiffLoadBalancer of unchanged request returned %v", changes)
+	}
+
+	req := live.AsRequest()
+	req.ForwardingRules = []ForwardingRule{
+		{EntryProtocol: "http", EntryPort: 80, TargetProtocol: "http", TargetPort: 80},
+		{EntryProtocol: "https", EntryPort: 443, TargetProtocol: "http", TargetPort: 80, CertificateID: "cert-2"},
+	}
+	req.HealthCheck.Path = "/health"
+	req.DropletIDs = []int{2, 21, 22}
+	req.StickySessions = nil
+
+	var got []string
+	for _, c := range DiffLoadBalancer(live, req) {
+		got = append(got, c.String())
+	}
+	expected := []string{
+		"forwarding_rules: [http:80->http:80, https:443->http:80 certificate=cert-1] -> [http:80->http:80, https:443->http:80 certificate=cert-2]",
+		"health_check.path: / -> /health",
+		"droplet_ids: [2 21] -> [2 21 22]",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("DiffLoadBalancer returned\n%q\nexpected\n%q", got, expected)
+	}
+}
+
+func TestDiffLoadBalancer_MinimalRequest(t *testing.T) {
+	live := &LoadBalancer{
+		ID:        "lb-1",
+		Name:      "example-lb-01",
+		Algorithm: "least_connections",
+		Region:    &Region{Slug: "nyc3"},
+		SizeSlug:  "lb-medium",
+		ForwardingRules: []ForwardingRule{
+			{EntryProtocol: "http", EntryPort: 80, TargetProtocol: "http", TargetPort: 80},
+		},
+		DropletIDs: []int{2, 21},
+		VPCUUID:    "vpc-1",
+	}
+
+	req := &LoadBalancerRequest{Name: "example-lb-02"}
+
+	var got []string
+	for _, c := range DiffLoadBalancer(live, req) {
+		got = append(got, c.String())
+	}
+	expected := []string{"name: example-lb-01 -> example-lb-02"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("DiffLoadBalancer returned\n%q\nexpected\n%q", got, expected)
+	}
+}
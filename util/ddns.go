@@ -0,0 +1,280 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+const (
+	defaultMetadataURL = "http://169.254.169.254/metadata/v1"
+
+	defaultDDNSInterval   = 5 * time.Minute
+	defaultDDNSMaxBackoff = 10 * time.Minute
+	minDDNSBackoff        = 5 * time.Second
+
+	// rateLimitReserve is the number of API requests left unused before
+	// the updater waits for the rate limit to reset.
+	rateLimitReserve = 10
+)
+
+// IPSource discovers the current public address of a host.
+type IPSource interface {
+	CurrentIP(ctx context.Context) (net.IP, error)
+}
+
+// MetadataIPSource reads the public address of a droplet from the droplet
+// metadata service.
+type MetadataIPSource struct {
+	// BaseURL of the metadata service. The link-local address of the
+	// service is used when it is empty.
+	BaseURL string
+
+	// IPv6 selects the droplet's public IPv6 address.
+	IPv6 bool
+
+	HTTPClient *http.Client
+}
+
+// CurrentIP implements IPSource.
+func (s *MetadataIPSource) CurrentIP(ctx context.Context) (net.IP, error) {
+	base := s.BaseURL
+	if base == "" {
+		base = defaultMetadataURL
+	}
+	family := "ipv4"
+	if s.IPv6 {
+		family = "ipv6"
+	}
+	return fetchIP(ctx, s.HTTPClient, fmt.Sprintf("%s/interfaces/public/0/%s/address", strings.TrimSuffix(base, "/"), family))
+}
+
+// HTTPIPSource asks an HTTP echo service, which responds with the caller's
+// address as plain text.
+type HTTPIPSource struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// CurrentIP implements IPSource.
+func (s *HTTPIPSource) CurrentIP(ctx context.Context) (net.IP, error) {
+	return fetchIP(ctx, s.HTTPClient, s.URL)
+}
+
+// InterfaceIPSource uses the first global unicast address of a network
+// interface.
+type InterfaceIPSource struct {
+	Name string
+	IPv6 bool
+}
+
+// CurrentIP implements IPSource.
+func (s *InterfaceIPSource) CurrentIP(ctx context.Context) (net.IP, error) {
+	iface, err := net.InterfaceByName(s.Name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if (ipnet.IP.To4() == nil) == s.IPv6 {
+			return ipnet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no global unicast address", s.Name)
+}
+
+func fetchIP(ctx context.Context, client *http.Client, url string) (net.IP, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := godo.DoRequestWithClient(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("GET %s: response is not an IP address", url)
+	}
+	return ip, nil
+}
+
+// DDNSUpdater keeps an A or AAAA record pointed at the address reported by
+// an IPSource. The record type follows the address family.
+type DDNSUpdater struct {
+	Client *godo.Client
+	Source IPSource
+
+	// Domain and Name identify the record. Name is relative to the
+	// domain, or "@" for the domain itself.
+	Domain string
+	Name   string
+
+	// TTL of the record when it is created. Zero uses the API default.
+	TTL int
+
+	// Interval between checks. MaxBackoff caps the wait between retries
+	// after errors.
+	Interval   time.Duration
+	MaxBackoff time.Duration
+
+	mu         sync.Mutex
+	lastUpdate time.Time
+	lastIP     net.IP
+}
+
+// LastUpdate returns when the record was last created or changed, and the
+// address it was set to. The time is zero when no change was made yet.
+func (u *DDNSUpdater) LastUpdate() (time.Time, net.IP) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.lastUpdate, u.lastIP
+}
+
+// Update checks the current address once and changes the record when it
+// differs. It reports whether the record was changed.
+func (u *DDNSUpdater) Update(ctx context.Context) (bool, error) {
+	if u.Domain == "" {
+		return false, godo.NewArgError("Domain", "cannot be empty")
+	}
+	if u.Source == nil {
+		return false, godo.NewArgError("Source", "cannot be nil")
+	}
+
+	ip, err := u.Source.CurrentIP(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	typ := "AAAA"
+	if ip.To4() != nil {
+		typ = "A"
+	}
+
+	name := u.Name
+	if name == "" {
+		name = "@"
+	}
+	fqdn := u.Domain
+	if name != "@" {
+		fqdn = name + "." + u.Domain
+	}
+
+	records, _, err := u.Client.Domains.RecordsByTypeAndName(ctx, u.Domain, typ, fqdn, nil)
+	if err != nil {
+		return false, err
+	}
+
+	if len(records) == 0 {
+		_, _, err = u.Client.Domains.CreateRecord(ctx, u.Domain, &godo.DomainRecordEditRequest{
+			Type: typ,
+			Name: name,
+			Data: ip.String(),
+			TTL:  u.TTL,
+		})
+	} else {
+		current := net.ParseIP(records[0].Data)
+		if current != nil && current.Equal(ip) {
+			return false, nil
+		}
+		_, _, err = u.Client.Domains.EditRecord(ctx, u.Domain, records[0].ID, &godo.DomainRecordEditRequest{
+			Type: typ,
+			Name: name,
+			Data: ip.String(),
+			TTL:  records[0].TTL,
+		})
+	}
+	if err != nil {
+		return false, err
+	}
+
+	u.mu.Lock()
+	u.lastUpdate = time.Now()
+	u.lastIP = ip
+	u.mu.Unlock()
+	return true, nil
+}
+
+// Run calls Update every Interval until the context is done. Errors are
+// retried with exponential backoff, and the updater waits for the rate
+// limit to reset when few requests are left.
+func (u *DDNSUpdater) Run(ctx context.Context) error {
+	interval := u.Interval
+	if interval == 0 {
+		interval = defaultDDNSInterval
+	}
+	maxBackoff := u.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = defaultDDNSMaxBackoff
+	}
+
+	backoff := time.Duration(0)
+	for {
+		wait := interval
+		if _, err := u.Update(ctx); err != nil {
+			if _, ok := err.(*godo.ArgError); ok {
+				return err
+			}
+			if backoff == 0 {
+				backoff = minDDNSBackoff
+			} else {
+				backoff *= 2
+			}
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			wait = backoff
+		} else {
+			backoff = 0
+		}
+
+		if w := rateLimitWait(u.Client.GetRate(), time.Now()); w > wait {
+			wait = w
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// rateLimitWait returns how long to wait before the next request so that
+// the rate limit is not exhausted.
+func rateLimitWait(rate godo.Rate, now time.Time) time.Duration {
+	if rate.Limit == 0 || rate.Remaining > rateLimitReserve {
+		return 0
+	}
+	if reset := rate.Reset.Time; reset.After(now) {
+		return reset.Sub(now)
+	}
+	return 0
+}
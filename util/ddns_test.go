@@ -0,0 +1,159 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestDDNSUpdater_Update(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var mu sync.Mutex
+	currentIP := "192.0.2.1"
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintln(w, currentIP)
+	}))
+	defer echo.Close()
+
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		q := r.URL.Query()
+		if q.Get("type") != "A" || q.Get("name") != "home.example.com" {
+			t.Errorf("unexpected record filter %q", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"domain_records": [{"id": 5, "type": "A", "name": "home", "data": "192.0.2.1", "ttl": 60}]}`)
+	})
+	var edits []godo.DomainRecordEditRequest
+	mux.HandleFunc("/v2/domains/example.com/records/5", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPut)
+		v := godo.DomainRecordEditRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		edits = append(edits, v)
+		fmt.Fprint(w, `{"domain_record": {"id": 5}}`)
+	})
+
+	u := &DDNSUpdater{
+		Client: client,
+		Source: &HTTPIPSource{URL: echo.URL},
+		Domain: "example.com",
+		Name:   "home",
+	}
+
+	changed, err := u.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	if changed || len(edits) != 0 {
+		t.Errorf("Update changed an up to date record")
+	}
+	if last, _ := u.LastUpdate(); !last.IsZero() {
+		t.Errorf("LastUpdate = %v, expected zero time", last)
+	}
+
+	mu.Lock()
+	currentIP = "192.0.2.2"
+	mu.Unlock()
+
+	changed, err = u.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update returned error: %v", err)
+	}
+	if !changed {
+		t.Errorf("Update did not change an outdated record")
+	}
+	expected := godo.DomainRecordEditRequest{Type: "A", Name: "home", Data: "192.0.2.2", TTL: 60}
+	if len(edits) != 1 || edits[0] != expected {
+		t.Errorf("Update sent %+v, expected %+v", edits, expected)
+	}
+	if last, ip := u.LastUpdate(); last.IsZero() || !ip.Equal(net.ParseIP("192.0.2.2")) {
+		t.Errorf("LastUpdate = %v, %v", last, ip)
+	}
+}
+
+func TestDDNSUpdater_RunCreatesRecord(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/metadata/v1/interfaces/public/0/ipv6/address", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "2001:db8::1")
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if q := r.URL.Query(); q.Get("type") != "AAAA" || q.Get("name") != "example.com" {
+				t.Errorf("unexpected record filter %q", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"domain_records": []}`)
+		case http.MethodPost:
+			v := godo.DomainRecordEditRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				t.Fatalf("decode json: %v", err)
+			}
+			expected := godo.DomainRecordEditRequest{Type: "AAAA", Name: "@", Data: "2001:db8::1", TTL: 300}
+			if v != expected {
+				t.Errorf("Request body\n got=%+v\nwant=%+v", v, expected)
+			}
+			fmt.Fprint(w, `{"domain_record": {"id": 1}}`)
+		}
+	})
+
+	u := &DDNSUpdater{
+		Client:   client,
+		Source:   &MetadataIPSource{BaseURL: server.URL + "/metadata/v1", IPv6: true},
+		Domain:   "example.com",
+		TTL:      300,
+		Interval: time.Millisecond,
+	}
+
+	go func() {
+		for {
+			if last, _ := u.LastUpdate(); !last.IsZero() {
+				cancel()
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := u.Run(ctx); err != context.Canceled {
+		t.Errorf("Run returned %v, expected context.Canceled", err)
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Date(2020, 10, 19, 12, 0, 0, 0, time.UTC)
+	reset := godo.Timestamp{Time: now.Add(time.Minute)}
+
+	tests := []struct {
+		rate     godo.Rate
+		expected time.Duration
+	}{
+		{godo.Rate{}, 0},
+		{godo.Rate{Limit: 5000, Remaining: 4000, Reset: reset}, 0},
+		{godo.Rate{Limit: 5000, Remaining: 3, Reset: reset}, time.Minute},
+		{godo.Rate{Limit: 5000, Remaining: 0, Reset: godo.Timestamp{Time: now.Add(-time.Minute)}}, 0},
+	}
+	for _, tt := range tests {
+		if got := rateLimitWait(tt.rate, now); got != tt.expected {
+			t.Errorf("rateLimitWait(%+v) = %v, expected %v", tt.rate, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/digitalocean/godo"
+)
+
+// AssociatedResourcePolicy decides what happens to a resource associated
+// with a droplet when the droplet is destroyed.
+type AssociatedResourcePolicy int
+
+const (
+	// KeepAssociated leaves the resource alone. Volumes and floating IPs
+	// are released by the platform when the droplet is deleted.
+	KeepAssociated AssociatedResourcePolicy = iota
+
+	// DetachAndKeep detaches volumes and unassigns floating IPs before
+	// the droplet is deleted, and keeps them. Snapshots are kept.
+	DetachAndKeep
+
+	// DestroyAssociated deletes the resource along with the droplet.
+	DestroyAssociated
+)
+
+// DropletDestroyRequest selects droplets to destroy and what to do with
+// their associated resources. Either DropletIDs or Tag selects the
+// droplets, and at least one of ProtectionTag or ExpectedCount must be set.
+type DropletDestroyRequest struct {
+	DropletIDs []int
+	Tag        string
+
+	// ProtectionTag aborts the destroy when any selected droplet carries
+	// the tag.
+	ProtectionTag string
+
+	// ExpectedCount aborts the destroy when the number of selected
+	// droplets differs.
+	ExpectedCount int
+
+	Volumes     AssociatedResourcePolicy
+	Snapshots   AssociatedResourcePolicy
+	FloatingIPs AssociatedResourcePolicy
+
+	// DryRun lists what would be destroyed without changing anything.
+	DryRun bool
+}
+
+// DropletAssociations lists the resources associated with a droplet.
+type DropletAssociations struct {
+	Droplet     godo.Droplet
+	VolumeIDs   []string
+	SnapshotIDs []int
+	FloatingIPs []string
+}
+
+// DestroyRecord lists what a destroy removed or released.
+type DestroyRecord struct {
+	Associations []DropletAssociations
+
+	DeletedDroplets    []int
+	DeletedVolumes     []string
+	DeletedSnapshots   []int
+	DeletedFloatingIPs []string
+
+	DetachedVolumes       []string
+	UnassignedFloatingIPs []string
+}
+
+// DestroyAbortedError is returned when a destroy fails its safety checks.
+type DestroyAbortedError struct {
+	Reason string
+}
+
+func (e *DestroyAbortedError) Error() string {
+	return fmt.Sprintf("destroy aborted: %s", e.Reason)
+}
+
+// ListDropletAssociations returns the volumes, snapshots and floating IPs
+// associated with each of the given droplets.
+func ListDropletAssociations(ctx context.Context, client *godo.Client, droplets []godo.Droplet) ([]DropletAssociations, error) {
+	ips, err := listFloatingIPs(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]DropletAssociations, 0, len(droplets))
+	for _, d := range droplets {
+		a := DropletAssociations{
+			Droplet:     d,
+			VolumeIDs:   d.VolumeIDs,
+			SnapshotIDs: d.SnapshotIDs,
+		}
+		for _, ip := range ips {
+			if ip.Droplet != nil && ip.Droplet.ID == d.ID {
+				a.FloatingIPs = append(a.FloatingIPs, ip.IP)
+			}
+		}
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+// SafeDestroyDroplets destroys droplets after checking them against the
+// request's protection tag and expected count, handling their associated
+// resources as requested. The record holds everything removed so far, even
+// when an error is returned part way through.
+func SafeDestroyDroplets(ctx context.Context, client *godo.Client, req *DropletDestroyRequest) (*DestroyRecord, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+
+	droplets, err := req.droplets(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ExpectedCount > 0 && len(droplets) != req.ExpectedCount {
+		return nil, &DestroyAbortedError{
+			Reason: fmt.Sprintf("expected %d droplets, found %d", req.ExpectedCount, len(droplets)),
+		}
+	}
+	if req.ProtectionTag != "" {
+		for _, d := range droplets {
+			if hasTag(d.Tags, req.ProtectionTag) {
+				return nil, &DestroyAbortedError{
+					Reason: fmt.Sprintf("droplet %d (%s) carries protection tag %q", d.ID, d.Name, req.ProtectionTag),
+				}
+			}
+		}
+	}
+
+	associations, err := ListDropletAssociations(ctx, client, droplets)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &DestroyRecord{Associations: associations}
+	if req.DryRun {
+		return record, nil
+	}
+
+	for _, a := range associations {
+		if err := req.destroy(ctx, client, a, record); err != nil {
+			return record, err
+		}
+	}
+	return record, nil
+}
+
+func (r *DropletDestroyRequest) validate() error {
+	if r == nil {
+		return godo.NewArgError("req", "cannot be nil")
+	}
+	if (len(r.DropletIDs) == 0) == (r.Tag == "") {
+		return godo.NewArgError("req", "must set exactly one of DropletIDs or Tag")
+	}
+	if r.ProtectionTag == "" && r.ExpectedCount < 1 {
+		return godo.NewArgError("req", "must set ProtectionTag or ExpectedCount")
+	}
+	return nil
+}
+
+func (r *DropletDestroyRequest) droplets(ctx context.Context, client *godo.Client) ([]godo.Droplet, error) {
+	if r.Tag != "" {
+		return listDropletsByTag(ctx, client, r.Tag)
+	}
+
+	droplets := make([]godo.Droplet, 0, len(r.DropletIDs))
+	for _, id := range r.DropletIDs {
+		d, _, err := client.Droplets.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		droplets = append(droplets, *d)
+	}
+	return droplets, nil
+}
+
+// destroy removes a single droplet. Volumes and floating IPs are released
+// first so that they can be deleted or kept once the droplet is gone.
+func (r *DropletDestroyRequest) destroy(ctx context.Context, client *godo.Client, a DropletAssociations, record *DestroyRecord) error {
+	dropletID := a.Droplet.ID
+
+	if r.Volumes != KeepAssociated {
+		for _, id := range a.VolumeIDs {
+			action, _, err := client.StorageActions.DetachByDropletID(ctx, id, dropletID)
+			if err != nil {
+				return err
+			}
+			if err := waitForVolumeAction(ctx, client, id, action); err != nil {
+				return err
+			}
+			if r.Volumes == DetachAndKeep {
+				record.DetachedVolumes = append(record.DetachedVolumes, id)
+			}
+		}
+	}
+	if r.FloatingIPs != KeepAssociated {
+		for _, ip := range a.FloatingIPs {
+			action, _, err := client.FloatingIPActions.Unassign(ctx, ip)
+			if err != nil {
+				return err
+			}
+			if err := waitForFloatingIPAction(ctx, client, ip, action); err != nil {
+				return err
+			}
+			if r.FloatingIPs == DetachAndKeep {
+				record.UnassignedFloatingIPs = append(record.UnassignedFloatingIPs, ip)
+			}
+		}
+	}
+
+	if _, err := client.Droplets.Delete(ctx, dropletID); err != nil {
+		return err
+	}
+	record.DeletedDroplets = append(record.DeletedDroplets, dropletID)
+
+	if r.Volumes == DestroyAssociated {
+		for _, id := range a.VolumeIDs {
+			if _, err := client.Storage.DeleteVolume(ctx, id); err != nil {
+				return err
+			}
+			record.DeletedVolumes = append(record.DeletedVolumes, id)
+		}
+	}
+	if r.FloatingIPs == DestroyAssociated {
+		for _, ip := range a.FloatingIPs {
+			if _, err := client.FloatingIPs.Delete(ctx, ip); err != nil {
+				return err
+			}
+			record.DeletedFloatingIPs = append(record.DeletedFloatingIPs, ip)
+		}
+	}
+	if r.Snapshots == DestroyAssociated {
+		for _, id := range a.SnapshotIDs {
+			if _, err := client.Snapshots.Delete(ctx, strconv.Itoa(id)); err != nil {
+				return err
+			}
+			record.DeletedSnapshots = append(record.DeletedSnapshots, id)
+		}
+	}
+	return nil
+}
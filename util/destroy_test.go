@@ -0,0 +1,120 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestSafeDestroyDroplets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	record := func(r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+	}
+
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"droplets": [
+			{"id": 1, "name": "web-1", "volume_ids": ["vol-1"], "snapshot_ids": [11]}
+		]}`)
+	})
+	mux.HandleFunc("/v2/floating_ips", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"floating_ips": [
+			{"ip": "192.0.2.1", "droplet": {"id": 1}},
+			{"ip": "192.0.2.2", "droplet": {"id": 2}},
+			{"ip": "192.0.2.3"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/volumes/vol-1/actions", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		fmt.Fprint(w, `{"action": {"id": 1, "status": "in-progress"}}`)
+	})
+	mux.HandleFunc("/v2/volumes/vol-1/actions/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"action": {"id": 1, "status": "completed"}}`)
+	})
+	mux.HandleFunc("/v2/floating_ips/192.0.2.1/actions", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		fmt.Fprint(w, `{"action": {"id": 2, "status": "completed"}}`)
+	})
+	for _, path := range []string{"/v2/droplets/1", "/v2/volumes/vol-1", "/v2/snapshots/11"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, http.MethodDelete)
+			record(r)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	req := &DropletDestroyRequest{
+		Tag:           "web",
+		ExpectedCount: 1,
+		Volumes:       DestroyAssociated,
+		Snapshots:     DestroyAssociated,
+		FloatingIPs:   DetachAndKeep,
+	}
+
+	rec, err := SafeDestroyDroplets(ctx, client, req)
+	if err != nil {
+		t.Fatalf("SafeDestroyDroplets returned error: %v", err)
+	}
+
+	expectedCalls := []string{
+		"POST /v2/volumes/vol-1/actions",
+		"POST /v2/floating_ips/192.0.2.1/actions",
+		"DELETE /v2/droplets/1",
+		"DELETE /v2/volumes/vol-1",
+		"DELETE /v2/snapshots/11",
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("calls\n got=%v\nwant=%v", calls, expectedCalls)
+	}
+
+	expected := &DestroyRecord{
+		Associations: []DropletAssociations{{
+			Droplet:     godo.Droplet{ID: 1, Name: "web-1", VolumeIDs: []string{"vol-1"}, SnapshotIDs: []int{11}},
+			VolumeIDs:   []string{"vol-1"},
+			SnapshotIDs: []int{11},
+			FloatingIPs: []string{"192.0.2.1"},
+		}},
+		DeletedDroplets:       []int{1},
+		DeletedVolumes:        []string{"vol-1"},
+		DeletedSnapshots:      []int{11},
+		UnassignedFloatingIPs: []string{"192.0.2.1"},
+	}
+	if !reflect.DeepEqual(rec, expected) {
+		t.Errorf("record\n got=%+v\nwant=%+v", rec, expected)
+	}
+}
+
+func TestSafeDestroyDroplets_Aborts(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"droplets": [{"id": 1}, {"id": 2, "tags": ["web", "protected"]}]}`)
+	})
+	mux.HandleFunc("/v2/droplets/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	})
+
+	tests := []*DropletDestroyRequest{
+		{Tag: "web", ExpectedCount: 1},
+		{Tag: "web", ProtectionTag: "protected"},
+	}
+	for _, req := range tests {
+		_, err := SafeDestroyDroplets(ctx, client, req)
+		if _, ok := err.(*DestroyAbortedError); !ok {
+			t.Errorf("expected DestroyAbortedError for %+v, got %v", req, err)
+		}
+	}
+
+	if _, err := SafeDestroyDroplets(ctx, client, &DropletDestroyRequest{Tag: "web"}); err == nil {
+		t.Error("expected an error when no safety check is set")
+	}
+}
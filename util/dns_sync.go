@@ -0,0 +1,431 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// dnsOwnerPrefix is the label under which ownership markers are stored. The
+// marker for records named "www" is a TXT record named "_dnssync.www", and
+// it lists the data of the records it owns.
+const dnsOwnerPrefix = "_dnssync"
+
+// DNSChangeType is the kind of change in a DNSPlan.
+type DNSChangeType string
+
+// Changes made by DNSSync.
+const (
+	DNSCreate DNSChangeType = "create"
+	DNSUpdate DNSChangeType = "update"
+	DNSDelete DNSChangeType = "delete"
+)
+
+// DNSChange is a single operation in a DNSPlan.
+type DNSChange struct {
+	Type DNSChangeType
+
+	// ID is the record being updated or deleted.
+	ID int
+
+	// Record holds the desired values for creates and updates, and the
+	// current values for deletes.
+	Record godo.DomainRecordEditRequest
+
+	// Marker is set for changes to ownership markers.
+	Marker bool
+}
+
+// DNSConflict is a desired record that cannot be applied safely.
+type DNSConflict struct {
+	Record godo.DomainRecordEditRequest
+	Reason string
+}
+
+// DNSPlan lists the changes needed to converge a domain to a desired
+// record set.
+type DNSPlan struct {
+	Domain    string
+	Changes   []DNSChange
+	Conflicts []DNSConflict
+}
+
+// String renders the plan for review.
+func (p *DNSPlan) String() string {
+	var b bytes.Buffer
+	for _, c := range p.Changes {
+		r := c.Record
+		fmt.Fprintf(&b, "%-6s %s %s %s", c.Type, r.Type, r.Name, r.Data)
+		if c.ID != 0 {
+			fmt.Fprintf(&b, " (id %d)", c.ID)
+		}
+		b.WriteString("\n")
+	}
+	for _, c := range p.Conflicts {
+		fmt.Fprintf(&b, "skip   %s %s %s: %s\n", c.Record.Type, c.Record.Name, c.Record.Data, c.Reason)
+	}
+	return b.String()
+}
+
+// DNSSync converges the records of a domain to a desired set. Records are
+// matched on type, name and data; priority, port, weight, TTL, flags and tag
+// are updated in place. Only the records listed in this sync's ownership
+// marker for their name and type are ever updated or deleted, so records
+// added by others under the same name are left alone. The apex NS and SOA
+// records are never touched.
+type DNSSync struct {
+	Client *godo.Client
+	Domain string
+
+	// Owner identifies this sync in its ownership markers, so that several
+	// syncs can share a domain.
+	Owner string
+
+	// AdoptExisting claims ownership of a name and type that already has
+	// records without a marker. Otherwise desired records for it are
+	// reported as conflicts.
+	AdoptExisting bool
+}
+
+type dnsKey struct {
+	typ, name string
+}
+
+// Plan compares the desired records with the live ones and returns the
+// changes needed. Nothing is changed.
+func (s *DNSSync) Plan(ctx context.Context, desired []godo.DomainRecordEditRequest) (*DNSPlan, error) {
+	if s.Domain == "" {
+		return nil, godo.NewArgError("Domain", "cannot be empty")
+	}
+	if s.Owner == "" {
+		return nil, godo.NewArgError("Owner", "cannot be empty")
+	}
+
+	live, err := listDomainRecords(ctx, s.Client, s.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DNSPlan{Domain: s.Domain}
+
+	// Sort live records into ownership markers and everything else.
+	markers := make(map[dnsKey]godo.DomainRecord)
+	ownedData := make(map[dnsKey]map[string]bool)
+	existing := make(map[dnsKey][]godo.DomainRecord)
+	for _, r := range live {
+		if k, data, ok := s.parseMarker(&r); ok {
+			markers[k] = r
+			ownedData[k] = data
+			continue
+		}
+		k := dnsKey{strings.ToUpper(r.Type), normalizeDNSName(r.Name)}
+		existing[k] = append(existing[k], r)
+	}
+
+	wanted := make(map[dnsKey][]godo.DomainRecordEditRequest)
+	var order []dnsKey
+	for _, r := range desired {
+		r.Type = strings.ToUpper(r.Type)
+		r.Name = normalizeDNSName(r.Name)
+		if reason := protectedDNSRecord(r.Type, r.Name); reason != "" {
+			plan.Conflicts = append(plan.Conflicts, DNSConflict{Record: r, Reason: reason})
+			continue
+		}
+		k := dnsKey{r.Type, r.Name}
+		if singleValuedDNSType(r.Type) && len(wanted[k]) > 0 {
+			plan.Conflicts = append(plan.Conflicts, DNSConflict{Record: r, Reason: "only one " + r.Type + " record is allowed per name"})
+			continue
+		}
+		if _, ok := wanted[k]; !ok {
+			order = append(order, k)
+		}
+		wanted[k] = append(wanted[k], r)
+	}
+
+	for _, k := range order {
+		marker, owned := markers[k]
+
+		// Split the live records into the ones this sync owns and the ones
+		// others added under the same name and type.
+		var current, foreign []godo.DomainRecord
+		for _, r := range existing[k] {
+			if s.AdoptExisting || ownedData[k][normalizeDNSData(r.Data)] {
+				current = append(current, r)
+			} else {
+				foreign = append(foreign, r)
+			}
+		}
+		if !owned && len(foreign) > 0 {
+			for _, r := range wanted[k] {
+				plan.Conflicts = append(plan.Conflicts, DNSConflict{Record: r, Reason: "records exist that are not owned by " + s.Owner})
+			}
+			continue
+		}
+
+		var wants []godo.DomainRecordEditRequest
+		for _, want := range wanted[k] {
+			if reason := s.foreignConflict(k.typ, foreign, &want); reason != "" {
+				plan.Conflicts = append(plan.Conflicts, DNSConflict{Record: want, Reason: reason})
+				continue
+			}
+			wants = append(wants, want)
+		}
+
+		data := make([]string, 0, len(wants))
+		for _, want := range wants {
+			data = append(data, normalizeDNSData(want.Data))
+		}
+		m := s.marker(k, data)
+		if !owned && len(wants) > 0 {
+			plan.Changes = append(plan.Changes, DNSChange{Type: DNSCreate, Record: m, Marker: true})
+		}
+
+		matched := make([]bool, len(current))
+		var unmatched []godo.DomainRecordEditRequest
+		for _, want := range wants {
+			found := false
+			for i, have := range current {
+				if matched[i] || !sameDNSData(have.Data, want.Data) {
+					continue
+				}
+				matched[i], found = true, true
+				if dnsFieldsDiffer(&have, &want) {
+					plan.Changes = append(plan.Changes, DNSChange{Type: DNSUpdate, ID: have.ID, Record: want})
+				}
+				break
+			}
+			if !found {
+				unmatched = append(unmatched, want)
+			}
+		}
+		for _, want := range unmatched {
+			// A name can only hold one record of a single-valued type, so
+			// a new value replaces the old one in place.
+			if singleValuedDNSType(k.typ) {
+				if i := firstUnmatched(matched); i >= 0 {
+					matched[i] = true
+					plan.Changes = append(plan.Changes, DNSChange{Type: DNSUpdate, ID: current[i].ID, Record: want})
+					continue
+				}
+			}
+			plan.Changes = append(plan.Changes, DNSChange{Type: DNSCreate, Record: want})
+		}
+		for i, have := range current {
+			if !matched[i] {
+				plan.Changes = append(plan.Changes, DNSChange{Type: DNSDelete, ID: have.ID, Record: editRequestFor(&have)})
+			}
+		}
+		if owned && marker.Data != m.Data {
+			plan.Changes = append(plan.Changes, DNSChange{Type: DNSUpdate, ID: marker.ID, Record: m, Marker: true})
+		}
+	}
+
+	// Owned names and types that are no longer wanted are removed along
+	// with their marker.
+	var released []dnsKey
+	for k := range markers {
+		if _, ok := wanted[k]; !ok {
+			released = append(released, k)
+		}
+	}
+	sort.Slice(released, func(i, j int) bool {
+		return released[i].name+" "+released[i].typ < released[j].name+" "+released[j].typ
+	})
+	for _, k := range released {
+		for _, have := range existing[k] {
+			if protectedDNSRecord(k.typ, k.name) != "" || !ownedData[k][normalizeDNSData(have.Data)] {
+				continue
+			}
+			plan.Changes = append(plan.Changes, DNSChange{Type: DNSDelete, ID: have.ID, Record: editRequestFor(&have)})
+		}
+		m := markers[k]
+		plan.Changes = append(plan.Changes, DNSChange{Type: DNSDelete, ID: m.ID, Record: editRequestFor(&m), Marker: true})
+	}
+
+	return plan, nil
+}
+
+// Apply executes a plan. Creates run first so that names never go without
+// records, and markers are removed last.
+func (s *DNSSync) Apply(ctx context.Context, plan *DNSPlan) error {
+	if plan == nil {
+		return godo.NewArgError("plan", "cannot be nil")
+	}
+
+	for _, pass := range []func(*DNSChange) bool{
+		func(c *DNSChange) bool { return c.Type == DNSCreate },
+		func(c *DNSChange) bool { return c.Type == DNSUpdate },
+		func(c *DNSChange) bool { return c.Type == DNSDelete && !c.Marker },
+		func(c *DNSChange) bool { return c.Type == DNSDelete && c.Marker },
+	} {
+		for i := range plan.Changes {
+			c := &plan.Changes[i]
+			if !pass(c) {
+				continue
+			}
+
+			var err error
+			switch c.Type {
+			case DNSCreate:
+				_, _, err = s.Client.Domains.CreateRecord(ctx, plan.Domain, &c.Record)
+			case DNSUpdate:
+				_, _, err = s.Client.Domains.EditRecord(ctx, plan.Domain, c.ID, &c.Record)
+			case DNSDelete:
+				_, err = s.Client.Domains.DeleteRecord(ctx, plan.Domain, c.ID)
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s %s: %v", c.Type, c.Record.Type, c.Record.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Sync plans and applies the desired record set in one step.
+func (s *DNSSync) Sync(ctx context.Context, desired []godo.DomainRecordEditRequest) (*DNSPlan, error) {
+	plan, err := s.Plan(ctx, desired)
+	if err != nil {
+		return nil, err
+	}
+	return plan, s.Apply(ctx, plan)
+}
+
+// markerData renders a marker claiming the records of a type with the given
+// data, such as "owner=team,type=A,data=192.0.2.1,data=192.0.2.2".
+func (s *DNSSync) markerData(typ string, data []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "owner=%s,type=%s", s.Owner, typ)
+	for _, d := range sortedStrings(data) {
+		b.WriteString(",data=" + url.QueryEscape(d))
+	}
+	return b.String()
+}
+
+func (s *DNSSync) marker(k dnsKey, data []string) godo.DomainRecordEditRequest {
+	name := dnsOwnerPrefix
+	if k.name != "@" {
+		name += "." + k.name
+	}
+	return godo.DomainRecordEditRequest{Type: "TXT", Name: name, Data: s.markerData(k.typ, data)}
+}
+
+// parseMarker reports whether a record is one of this sync's ownership
+// markers, which name and type it claims and the normalized data of the
+// records it owns.
+func (s *DNSSync) parseMarker(r *godo.DomainRecord) (dnsKey, map[string]bool, bool) {
+	if r.Type != "TXT" {
+		return dnsKey{}, nil, false
+	}
+	name := normalizeDNSName(r.Name)
+	if name != dnsOwnerPrefix && !strings.HasPrefix(name, dnsOwnerPrefix+".") {
+		return dnsKey{}, nil, false
+	}
+
+	prefix := fmt.Sprintf("owner=%s,type=", s.Owner)
+	if !strings.HasPrefix(r.Data, prefix) {
+		return dnsKey{}, nil, false
+	}
+	fields := strings.Split(strings.TrimPrefix(r.Data, prefix), ",")
+	data := make(map[string]bool)
+	for _, f := range fields[1:] {
+		d, err := url.QueryUnescape(strings.TrimPrefix(f, "data="))
+		if err != nil || !strings.HasPrefix(f, "data=") {
+			return dnsKey{}, nil, false
+		}
+		data[d] = true
+	}
+
+	owned := "@"
+	if name != dnsOwnerPrefix {
+		owned = strings.TrimPrefix(name, dnsOwnerPrefix+".")
+	}
+	return dnsKey{strings.ToUpper(fields[0]), owned}, data, true
+}
+
+// foreignConflict returns why a desired record cannot be written next to
+// records owned by others, if it cannot.
+func (s *DNSSync) foreignConflict(typ string, foreign []godo.DomainRecord, want *godo.DomainRecordEditRequest) string {
+	if singleValuedDNSType(typ) && len(foreign) > 0 {
+		return "a " + typ + " record exists that is not owned by " + s.Owner
+	}
+	for _, r := range foreign {
+		if sameDNSData(r.Data, want.Data) {
+			return "the record exists but is not owned by " + s.Owner
+		}
+	}
+	return ""
+}
+
+// protectedDNSRecord returns why a record must never be changed, if it must
+// not.
+func protectedDNSRecord(typ, name string) string {
+	switch {
+	case typ == "SOA":
+		return "SOA records are managed by DigitalOcean"
+	case typ == "NS" && name == "@":
+		return "apex NS records are managed by DigitalOcean"
+	}
+	return ""
+}
+
+// singleValuedDNSType reports whether a name can hold at most one record of
+// the type.
+func singleValuedDNSType(typ string) bool {
+	return typ == "CNAME"
+}
+
+func firstUnmatched(matched []bool) int {
+	for i, m := range matched {
+		if !m {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalizeDNSName(name string) string {
+	if name == "" {
+		return "@"
+	}
+	return strings.ToLower(name)
+}
+
+func sameDNSData(a, b string) bool {
+	return normalizeDNSData(a) == normalizeDNSData(b)
+}
+
+// normalizeDNSData returns the form of record data that markers list and
+// that records are matched on.
+func normalizeDNSData(data string) string {
+	return strings.ToLower(strings.TrimSuffix(data, "."))
+}
+
+// dnsFieldsDiffer reports whether any updateable field differs. A desired
+// TTL of zero leaves the TTL alone.
+func dnsFieldsDiffer(have *godo.DomainRecord, want *godo.DomainRecordEditRequest) bool {
+	return have.Priority != want.Priority ||
+		have.Port != want.Port ||
+		have.Weight != want.Weight ||
+		have.Flags != want.Flags ||
+		have.Tag != want.Tag ||
+		(want.TTL != 0 && have.TTL != want.TTL)
+}
+
+func editRequestFor(r *godo.DomainRecord) godo.DomainRecordEditRequest {
+	return godo.DomainRecordEditRequest{
+		Type:     r.Type,
+		Name:     r.Name,
+		Data:     r.Data,
+		Priority: r.Priority,
+		Port:     r.Port,
+		TTL:      r.TTL,
+		Weight:   r.Weight,
+		Flags:    r.Flags,
+		Tag:      r.Tag,
+	}
+}
@@ -0,0 +1,175 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+const dnsSyncRecords = `{"domain_records": [
+	{"id": 1, "type": "SOA", "name": "@", "data": "1800"},
+	{"id": 2, "type": "NS", "name": "@", "data": "ns1.digitalocean.com"},
+	{"id": 3, "type": "TXT", "name": "_dnssync.www", "data": "owner=team,type=A,data=192.0.2.1,data=192.0.2.2"},
+	{"id": 4, "type": "A", "name": "www", "data": "192.0.2.1", "ttl": 1800},
+	{"id": 5, "type": "A", "name": "www", "data": "192.0.2.2", "ttl": 1800},
+	{"id": 6, "type": "MX", "name": "@", "data": "mail.example.com", "priority": 10},
+	{"id": 7, "type": "TXT", "name": "_dnssync.legacy", "data": "owner=team,type=CNAME,data=%40"},
+	{"id": 8, "type": "CNAME", "name": "legacy", "data": "@"},
+	{"id": 9, "type": "TXT", "name": "_dnssync.other", "data": "owner=someone-else,type=A"},
+	{"id": 10, "type": "A", "name": "other", "data": "192.0.2.9"},
+	{"id": 11, "type": "A", "name": "www", "data": "192.0.2.50"},
+	{"id": 12, "type": "A", "name": "www", "data": "192.0.2.60"}
+]}`
+
+func TestDNSSync(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, dnsSyncRecords)
+		case http.MethodPost:
+			v := godo.DomainRecordEditRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				t.Fatalf("decode json: %v", err)
+			}
+			calls = append(calls, fmt.Sprintf("create %s %s %s", v.Type, v.Name, v.Data))
+			fmt.Fprint(w, `{"domain_record": {"id": 100}}`)
+		}
+	})
+	mux.HandleFunc("/v2/domains/example.com/records/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v2/domains/example.com/records/")
+		switch r.Method {
+		case http.MethodPut:
+			v := godo.DomainRecordEditRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				t.Fatalf("decode json: %v", err)
+			}
+			calls = append(calls, fmt.Sprintf("update %s %s ttl=%d", id, v.Data, v.TTL))
+			fmt.Fprint(w, `{"domain_record": {"id": 4}}`)
+		case http.MethodDelete:
+			calls = append(calls, "delete "+id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	sync := &DNSSync{Client: client, Domain: "example.com", Owner: "team"}
+	desired := []godo.DomainRecordEditRequest{
+		{Type: "A", Name: "www", Data: "192.0.2.1", TTL: 60},
+		{Type: "A", Name: "www", Data: "192.0.2.3"},
+		{Type: "a", Name: "API", Data: "192.0.2.4"},
+		{Type: "MX", Name: "@", Data: "mx.example.org.", Priority: 5},
+		{Type: "NS", Name: "@", Data: "ns.example.org."},
+		{Type: "A", Name: "other", Data: "192.0.2.10"},
+		{Type: "A", Name: "www", Data: "192.0.2.60"},
+	}
+
+	plan, err := sync.Plan(ctx, desired)
+	if err != nil {
+		t.Fatalf("DNSSync.Plan returned error: %v", err)
+	}
+
+	var reasons []string
+	for _, c := range plan.Conflicts {
+		reasons = append(reasons, c.Record.Type+" "+c.Record.Name+": "+c.Reason)
+	}
+	expectedReasons := []string{
+		"NS @: apex NS records are managed by DigitalOcean",
+		"A www: the record exists but is not owned by team",
+		"MX @: records exist that are not owned by team",
+		"A other: records exist that are not owned by team",
+	}
+	if !reflect.DeepEqual(reasons, expectedReasons) {
+		t.Errorf("DNSSync.Plan conflicts\n got=%v\nwant=%v", reasons, expectedReasons)
+	}
+
+	if err := sync.Apply(ctx, plan); err != nil {
+		t.Fatalf("DNSSync.Apply returned error: %v", err)
+	}
+
+	// Records 11 and 12 were added by someone else under an owned name and
+	// are left alone.
+	expectedCalls := []string{
+		"create A www 192.0.2.3",
+		"create TXT _dnssync.api owner=team,type=A,data=192.0.2.4",
+		"create A api 192.0.2.4",
+		"update 4 192.0.2.1 ttl=60",
+		"update 3 owner=team,type=A,data=192.0.2.1,data=192.0.2.3 ttl=0",
+		"delete 5",
+		"delete 8",
+		"delete 7",
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("DNSSync.Apply calls\n got=%v\nwant=%v", calls, expectedCalls)
+	}
+}
+
+func TestDNSSync_AdoptExisting(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"domain_records": [{"id": 6, "type": "MX", "name": "@", "data": "mail.example.com", "priority": 10}]}`)
+	})
+
+	sync := &DNSSync{Client: client, Domain: "example.com", Owner: "team", AdoptExisting: true}
+	plan, err := sync.Plan(ctx, []godo.DomainRecordEditRequest{
+		{Type: "MX", Name: "@", Data: "mail.example.com.", Priority: 10},
+	})
+	if err != nil {
+		t.Fatalf("DNSSync.Plan returned error: %v", err)
+	}
+
+	expected := []DNSChange{{
+		Type:   DNSCreate,
+		Record: godo.DomainRecordEditRequest{Type: "TXT", Name: "_dnssync", Data: "owner=team,type=MX,data=mail.example.com"},
+		Marker: true,
+	}}
+	if !reflect.DeepEqual(plan.Changes, expected) {
+		t.Errorf("DNSSync.Plan changes\n got=%+v\nwant=%+v", plan.Changes, expected)
+	}
+}
+
+func TestDNSSync_ChangeCNAME(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/domains/example.com/records", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, dnsSyncRecords)
+	})
+
+	sync := &DNSSync{Client: client, Domain: "example.com", Owner: "team"}
+	plan, err := sync.Plan(ctx, []godo.DomainRecordEditRequest{
+		{Type: "A", Name: "www", Data: "192.0.2.1"},
+		{Type: "A", Name: "www", Data: "192.0.2.2"},
+		{Type: "CNAME", Name: "legacy", Data: "www.example.com."},
+		{Type: "CNAME", Name: "legacy", Data: "api.example.com."},
+	})
+	if err != nil {
+		t.Fatalf("DNSSync.Plan returned error: %v", err)
+	}
+
+	expected := []DNSChange{{
+		Type:   DNSUpdate,
+		ID:     8,
+		Record: godo.DomainRecordEditRequest{Type: "CNAME", Name: "legacy", Data: "www.example.com."},
+	}, {
+		Type:   DNSUpdate,
+		ID:     7,
+		Record: godo.DomainRecordEditRequest{Type: "TXT", Name: "_dnssync.legacy", Data: "owner=team,type=CNAME,data=www.example.com"},
+		Marker: true,
+	}}
+	if !reflect.DeepEqual(plan.Changes, expected) {
+		t.Errorf("DNSSync.Plan changes\n got=%+v\nwant=%+v", plan.Changes, expected)
+	}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Record.Data != "api.example.com." {
+		t.Errorf("DNSSync.Plan conflicts = %+v, expected the second CNAME", plan.Conflicts)
+	}
+}
@@ -15,6 +15,10 @@ const (
 	activeFailure = 3
 )
 
+// pollInterval is how long the helpers in this package wait between
+// checks on a resource they are waiting for.
+var pollInterval = 5 * time.Second
+
 // WaitForActive waits for a droplet to become active
 func WaitForActive(ctx context.Context, client *godo.Client, monitorURI string) error {
 	if len(monitorURI) == 0 {
@@ -42,7 +46,7 @@ func WaitForActive(ctx context.Context, client *godo.Client, monitorURI string)
 		switch action.Status {
 		case godo.ActionInProgress:
 			select {
-			case <-time.After(5 * time.Second):
+			case <-time.After(pollInterval):
 			case <-ctx.Done():
 				return err
 			}
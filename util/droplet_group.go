@@ -0,0 +1,337 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// maxCreateBatch is the maximum number of droplets a single
+// CreateMultiple request accepts.
+const maxCreateBatch = 10
+
+// ScaleDownPolicy decides which droplets are deleted when a group has more
+// droplets than desired.
+type ScaleDownPolicy int
+
+const (
+	// ScaleDownOldestFirst deletes the oldest droplets first.
+	ScaleDownOldestFirst ScaleDownPolicy = iota
+
+	// ScaleDownSpreadHosts deletes droplets from the hosts that carry the
+	// most members of the group, oldest first, so the remaining droplets
+	// stay spread evenly across hypervisors.
+	ScaleDownSpreadHosts
+)
+
+// DropletGroup describes a fleet of identical droplets identified by a tag.
+type DropletGroup struct {
+	// Template is used for every droplet in the group. Its Name is used as
+	// the prefix of generated droplet names.
+	Template *godo.DropletCreateRequest
+
+	// Tag identifies the members of the group. It is added to every
+	// droplet the reconciler creates.
+	Tag string
+
+	// Count is the desired number of droplets.
+	Count int
+
+	// ScaleDown selects which surplus droplets are deleted.
+	ScaleDown ScaleDownPolicy
+}
+
+// DropletReplacement records a droplet that was replaced because its image
+// no longer matched the template.
+type DropletReplacement struct {
+	Old godo.Droplet
+	New godo.Droplet
+}
+
+// DropletGroupResult lists the changes made by ReconcileDropletGroup.
+type DropletGroupResult struct {
+	Created  []godo.Droplet
+	Deleted  []godo.Droplet
+	Replaced []DropletReplacement
+}
+
+// ReconcileDropletGroup converges the droplets tagged with group.Tag to
+// group.Count droplets built from group.Template. Missing droplets are
+// created in batches, surplus droplets are deleted according to the group's
+// ScaleDown policy and droplets running an outdated image are replaced one
+// at a time. The result holds every change made, even when an error is
+// returned part way through.
+func ReconcileDropletGroup(ctx context.Context, client *godo.Client, group *DropletGroup) (*DropletGroupResult, error) {
+	if err := group.validate(); err != nil {
+		return nil, err
+	}
+
+	current, err := listDropletsByTag(ctx, client, group.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DropletGroupResult{}
+	names := make(map[string]bool, len(current))
+	for _, d := range current {
+		names[d.Name] = true
+	}
+
+	var stale, fresh []godo.Droplet
+	for _, d := range current {
+		if group.imageMatches(&d) {
+			fresh = append(fresh, d)
+		} else {
+			stale = append(stale, d)
+		}
+	}
+
+	// Surplus droplets running an outdated image are removed before any
+	// up-to-date ones.
+	surplus := len(current) - group.Count
+	for surplus > 0 && len(stale) > 0 {
+		sortOldestFirst(stale)
+		if _, err := client.Droplets.Delete(ctx, stale[0].ID); err != nil {
+			return result, err
+		}
+		result.Deleted = append(result.Deleted, stale[0])
+		stale = stale[1:]
+		surplus--
+	}
+	if surplus > 0 {
+		victims, err := group.selectSurplus(ctx, client, fresh, surplus)
+		if err != nil {
+			return result, err
+		}
+		for _, d := range victims {
+			if _, err := client.Droplets.Delete(ctx, d.ID); err != nil {
+				return result, err
+			}
+			result.Deleted = append(result.Deleted, d)
+		}
+	}
+
+	for missing := group.Count - len(current); missing > 0; missing -= maxCreateBatch {
+		batch := missing
+		if batch > maxCreateBatch {
+			batch = maxCreateBatch
+		}
+
+		req := group.multiCreateRequest()
+		for i := 0; i < batch; i++ {
+			name, err := uniqueName(group.namePrefix(), names)
+			if err != nil {
+				return result, err
+			}
+			req.Names = append(req.Names, name)
+		}
+
+		droplets, _, err := client.Droplets.CreateMultiple(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		result.Created = append(result.Created, droplets...)
+	}
+
+	sortOldestFirst(stale)
+	for _, old := range stale {
+		name, err := uniqueName(group.namePrefix(), names)
+		if err != nil {
+			return result, err
+		}
+
+		req := group.createRequest(name)
+		created, _, err := client.Droplets.Create(ctx, req)
+		if err != nil {
+			return result, err
+		}
+
+		replacement, err := waitForDropletStatus(ctx, client, created.ID, "active")
+		if err != nil {
+			return result, err
+		}
+
+		if _, err := client.Droplets.Delete(ctx, old.ID); err != nil {
+			return result, err
+		}
+		result.Replaced = append(result.Replaced, DropletReplacement{Old: old, New: *replacement})
+	}
+
+	return result, nil
+}
+
+func (g *DropletGroup) validate() error {
+	if g == nil {
+		return godo.NewArgError("group", "cannot be nil")
+	}
+	if g.Template == nil {
+		return godo.NewArgError("group.Template", "cannot be nil")
+	}
+	if g.Tag == "" {
+		return godo.NewArgError("group.Tag", "cannot be empty")
+	}
+	if g.Count < 0 {
+		return godo.NewArgError("group.Count", "cannot be less than 0")
+	}
+	return nil
+}
+
+func (g *DropletGroup) namePrefix() string {
+	if g.Template.Name != "" {
+		return g.Template.Name
+	}
+	return g.Tag
+}
+
+// imageMatches reports whether a droplet runs the template's image. Slugs
+// are compared when the template uses one, IDs otherwise.
+func (g *DropletGroup) imageMatches(d *godo.Droplet) bool {
+	if d.Image == nil {
+		return false
+	}
+	if g.Template.Image.Slug != "" {
+		return d.Image.Slug == g.Template.Image.Slug
+	}
+	return d.Image.ID == g.Template.Image.ID
+}
+
+func (g *DropletGroup) tags() []string {
+	tags := []string{g.Tag}
+	for _, t := range g.Template.Tags {
+		if !hasTag(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func (g *DropletGroup) createRequest(name string) *godo.DropletCreateRequest {
+	req := *g.Template
+	req.Name = name
+	req.Tags = g.tags()
+	return &req
+}
+
+func (g *DropletGroup) multiCreateRequest() *godo.DropletMultiCreateRequest {
+	t := g.Template
+	return &godo.DropletMultiCreateRequest{
+		Region:            t.Region,
+		Size:              t.Size,
+		Image:             t.Image,
+		SSHKeys:           t.SSHKeys,
+		Backups:           t.Backups,
+		IPv6:              t.IPv6,
+		PrivateNetworking: t.PrivateNetworking,
+		Monitoring:        t.Monitoring,
+		UserData:          t.UserData,
+		Tags:              g.tags(),
+		VPCUUID:           t.VPCUUID,
+	}
+}
+
+// selectSurplus picks n droplets to delete according to the group's policy.
+func (g *DropletGroup) selectSurplus(ctx context.Context, client *godo.Client, droplets []godo.Droplet, n int) ([]godo.Droplet, error) {
+	switch g.ScaleDown {
+	case ScaleDownOldestFirst:
+		sortOldestFirst(droplets)
+		return droplets[:n], nil
+	case ScaleDownSpreadHosts:
+		hosts, err := groupByHost(ctx, client, droplets)
+		if err != nil {
+			return nil, err
+		}
+
+		victims := make([]godo.Droplet, 0, n)
+		for len(victims) < n {
+			// Take the oldest droplet from the most crowded host.
+			sort.SliceStable(hosts, func(i, j int) bool {
+				return len(hosts[i]) > len(hosts[j])
+			})
+			victims = append(victims, hosts[0][0])
+			hosts[0] = hosts[0][1:]
+		}
+		return victims, nil
+	default:
+		return nil, fmt.Errorf("unknown scale down policy: %d", g.ScaleDown)
+	}
+}
+
+// groupByHost partitions droplets by the physical host they run on, using
+// Neighbors to discover which droplets share a host. Each host's droplets
+// are sorted oldest first.
+func groupByHost(ctx context.Context, client *godo.Client, droplets []godo.Droplet) ([][]godo.Droplet, error) {
+	host := make(map[int]int, len(droplets))
+	var hosts [][]godo.Droplet
+	for _, d := range droplets {
+		if idx, ok := host[d.ID]; ok {
+			hosts[idx] = append(hosts[idx], d)
+			continue
+		}
+
+		neighbors, _, err := client.Droplets.Neighbors(ctx, d.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// A neighbor that was already placed means this droplet joins
+		// that neighbor's host.
+		idx := len(hosts)
+		for _, n := range neighbors {
+			if i, ok := host[n.ID]; ok {
+				idx = i
+				break
+			}
+		}
+		if idx == len(hosts) {
+			hosts = append(hosts, nil)
+		}
+		host[d.ID] = idx
+		hosts[idx] = append(hosts[idx], d)
+		for _, n := range neighbors {
+			if _, ok := host[n.ID]; !ok {
+				host[n.ID] = idx
+			}
+		}
+	}
+
+	for _, h := range hosts {
+		sortOldestFirst(h)
+	}
+	return hosts, nil
+}
+
+func sortOldestFirst(droplets []godo.Droplet) {
+	sort.SliceStable(droplets, func(i, j int) bool {
+		return createdAt(droplets[i].Created).Before(createdAt(droplets[j].Created))
+	})
+}
+
+// createdAt parses a resource creation time. Unparseable values sort as
+// the zero time.
+func createdAt(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// uniqueName generates a name with the given prefix that is not in taken,
+// and records it there.
+func uniqueName(prefix string, taken map[string]bool) (string, error) {
+	for i := 0; i < 10; i++ {
+		b := make([]byte, 3)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		name := prefix + "-" + hex.EncodeToString(b)
+		if !taken[name] {
+			taken[name] = true
+			return name, nil
+		}
+	}
+	return "", errors.New("unable to generate a unique droplet name")
+}
@@ -0,0 +1,214 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestReconcileDropletGroup_ScaleUp(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var created []string
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("tag_name") != "workers" {
+				t.Errorf("expected tag_name=workers, got %q", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"droplets": [{"id": 1, "name": "worker-aaaaaa", "image": {"slug": "ubuntu-20-04-x64"}}]}`)
+		case http.MethodPost:
+			var req struct {
+				Names []string
+				Image string
+				Tags  []string
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode json: %v", err)
+			}
+			if !reflect.DeepEqual(req.Tags, []string{"workers", "env:prod"}) {
+				t.Errorf("unexpected tags %v", req.Tags)
+			}
+			if req.Image != "ubuntu-20-04-x64" {
+				t.Errorf("unexpected image %v", req.Image)
+			}
+			var droplets []string
+			for i, name := range req.Names {
+				if !strings.HasPrefix(name, "worker-") {
+					t.Errorf("unexpected name %q", name)
+				}
+				created = append(created, name)
+				droplets = append(droplets, fmt.Sprintf(`{"id": %d, "name": %q}`, 100+len(created)+i, name))
+			}
+			fmt.Fprintf(w, `{"droplets": [%s]}`, strings.Join(droplets, ","))
+		default:
+			t.Errorf("unexpected method %s", r.Method)
+		}
+	})
+
+	group := &DropletGroup{
+		Template: &godo.DropletCreateRequest{
+			Name:   "worker",
+			Region: "nyc3",
+			Size:   "s-1vcpu-1gb",
+			Image:  godo.DropletCreateImage{Slug: "ubuntu-20-04-x64"},
+			Tags:   []string{"env:prod"},
+		},
+		Tag:   "workers",
+		Count: 13,
+	}
+
+	result, err := ReconcileDropletGroup(ctx, client, group)
+	if err != nil {
+		t.Fatalf("ReconcileDropletGroup returned error: %v", err)
+	}
+
+	if len(result.Created) != 12 {
+		t.Errorf("expected 12 droplets to be created, got %d", len(result.Created))
+	}
+	if len(result.Deleted) != 0 || len(result.Replaced) != 0 {
+		t.Errorf("expected no deletions or replacements, got %+v", result)
+	}
+
+	seen := map[string]bool{"worker-aaaaaa": true}
+	for _, name := range created {
+		if seen[name] {
+			t.Errorf("duplicate name %q", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestReconcileDropletGroup_ScaleDownSpreadHosts(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Droplets 1, 2 and 3 share a host, 4 and 5 share another.
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"droplets": [
+			{"id": 1, "created_at": "2020-01-05T00:00:00Z", "image": {"id": 7}},
+			{"id": 2, "created_at": "2020-01-01T00:00:00Z", "image": {"id": 7}},
+			{"id": 3, "created_at": "2020-01-03T00:00:00Z", "image": {"id": 7}},
+			{"id": 4, "created_at": "2020-01-02T00:00:00Z", "image": {"id": 7}},
+			{"id": 5, "created_at": "2020-01-04T00:00:00Z", "image": {"id": 7}}
+		]}`)
+	})
+	neighbors := map[string]string{
+		"1": `[{"id": 2}, {"id": 3}]`,
+		"4": `[{"id": 5}]`,
+	}
+	var mu sync.Mutex
+	var deleted []int
+	mux.HandleFunc("/v2/droplets/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/droplets/"), "/")
+		if len(parts) == 2 && parts[1] == "neighbors" {
+			n, ok := neighbors[parts[0]]
+			if !ok {
+				t.Errorf("unexpected neighbors request for %s", parts[0])
+				n = "[]"
+			}
+			fmt.Fprintf(w, `{"droplets": %s}`, n)
+			return
+		}
+
+		testMethod(t, r, http.MethodDelete)
+		var id int
+		fmt.Sscanf(parts[0], "%d", &id)
+		mu.Lock()
+		deleted = append(deleted, id)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	group := &DropletGroup{
+		Template:  &godo.DropletCreateRequest{Name: "worker", Image: godo.DropletCreateImage{ID: 7}},
+		Tag:       "workers",
+		Count:     3,
+		ScaleDown: ScaleDownSpreadHosts,
+	}
+
+	result, err := ReconcileDropletGroup(ctx, client, group)
+	if err != nil {
+		t.Fatalf("ReconcileDropletGroup returned error: %v", err)
+	}
+
+	sort.Ints(deleted)
+	if !reflect.DeepEqual(deleted, []int{2, 3}) {
+		t.Errorf("expected droplets [2 3] to be deleted, got %v", deleted)
+	}
+	if len(result.Deleted) != 2 {
+		t.Errorf("expected 2 deleted droplets in result, got %d", len(result.Deleted))
+	}
+}
+
+func TestReconcileDropletGroup_ReplaceStale(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var events []string
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			fmt.Fprint(w, `{"droplets": [
+				{"id": 1, "image": {"slug": "app-v1"}},
+				{"id": 2, "image": {"slug": "app-v2"}}
+			]}`)
+		case http.MethodPost:
+			var req struct {
+				Image string
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("decode json: %v", err)
+			}
+			if req.Image != "app-v2" {
+				t.Errorf("unexpected image %v", req.Image)
+			}
+			events = append(events, "create")
+			fmt.Fprint(w, `{"droplet": {"id": 3, "status": "new"}}`)
+		}
+	})
+	mux.HandleFunc("/v2/droplets/3", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		events = append(events, "get")
+		fmt.Fprint(w, `{"droplet": {"id": 3, "status": "active", "image": {"slug": "app-v2"}}}`)
+	})
+	mux.HandleFunc("/v2/droplets/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		events = append(events, "delete")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	group := &DropletGroup{
+		Template: &godo.DropletCreateRequest{Name: "app", Image: godo.DropletCreateImage{Slug: "app-v2"}},
+		Tag:      "app",
+		Count:    2,
+	}
+
+	result, err := ReconcileDropletGroup(ctx, client, group)
+	if err != nil {
+		t.Fatalf("ReconcileDropletGroup returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(events, []string{"create", "get", "delete"}) {
+		t.Errorf("unexpected call order %v", events)
+	}
+	if len(result.Replaced) != 1 || result.Replaced[0].Old.ID != 1 || result.Replaced[0].New.ID != 3 {
+		t.Errorf("unexpected replacements %+v", result.Replaced)
+	}
+}
+
+func TestReconcileDropletGroup_InvalidGroup(t *testing.T) {
+	_, err := ReconcileDropletGroup(ctx, nil, &DropletGroup{Template: &godo.DropletCreateRequest{}})
+	if _, ok := err.(*godo.ArgError); !ok {
+		t.Errorf("expected ArgError, got %v", err)
+	}
+}
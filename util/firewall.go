@@ -0,0 +1,384 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// FirewallDiff lists the changes needed to bring a firewall to a desired
+// configuration.
+type FirewallDiff struct {
+	AddRules    godo.FirewallRulesRequest
+	RemoveRules godo.FirewallRulesRequest
+
+	AddDroplets    []int
+	RemoveDroplets []int
+
+	AddTags    []string
+	RemoveTags []string
+}
+
+// Empty reports whether the diff has no changes.
+func (d *FirewallDiff) Empty() bool {
+	return len(d.AddRules.InboundRules) == 0 && len(d.AddRules.OutboundRules) == 0 &&
+		len(d.RemoveRules.InboundRules) == 0 && len(d.RemoveRules.OutboundRules) == 0 &&
+		len(d.AddDroplets) == 0 && len(d.RemoveDroplets) == 0 &&
+		len(d.AddTags) == 0 && len(d.RemoveTags) == 0
+}
+
+// String renders the diff with rules in the compact rule syntax.
+func (d *FirewallDiff) String() string {
+	var b bytes.Buffer
+	for _, r := range d.AddRules.InboundRules {
+		fmt.Fprintf(&b, "+ %s\n", godo.FormatInboundRule(r))
+	}
+	for _, r := range d.AddRules.OutboundRules {
+		fmt.Fprintf(&b, "+ %s\n", godo.FormatOutboundRule(r))
+	}
+	for _, r := range d.RemoveRules.InboundRules {
+		fmt.Fprintf(&b, "- %s\n", godo.FormatInboundRule(r))
+	}
+	for _, r := range d.RemoveRules.OutboundRules {
+		fmt.Fprintf(&b, "- %s\n", godo.FormatOutboundRule(r))
+	}
+	for _, id := range d.AddDroplets {
+		fmt.Fprintf(&b, "+ droplet %d\n", id)
+	}
+	for _, id := range d.RemoveDroplets {
+		fmt.Fprintf(&b, "- droplet %d\n", id)
+	}
+	for _, t := range d.AddTags {
+		fmt.Fprintf(&b, "+ tag %s\n", t)
+	}
+	for _, t := range d.RemoveTags {
+		fmt.Fprintf(&b, "- tag %s\n", t)
+	}
+	return b.String()
+}
+
+// DiffFirewall compares a live firewall with a desired configuration. Rules
+// are compared after normalising protocol case, port formats and the order
+// of their sources and destinations. The name is not compared.
+func DiffFirewall(live *godo.Firewall, desired *godo.FirewallRequest) *FirewallDiff {
+	d := &FirewallDiff{}
+
+	liveIn := inboundRuleKeys(live.InboundRules)
+	wantIn := inboundRuleKeys(desired.InboundRules)
+	for _, r := range desired.InboundRules {
+		if k := godo.FormatInboundRule(normalizeInboundRule(r)); !liveIn[k] {
+			d.AddRules.InboundRules = append(d.AddRules.InboundRules, r)
+			liveIn[k] = true
+		}
+	}
+	for _, r := range live.InboundRules {
+		if k := godo.FormatInboundRule(normalizeInboundRule(r)); !wantIn[k] {
+			d.RemoveRules.InboundRules = append(d.RemoveRules.InboundRules, r)
+			wantIn[k] = true
+		}
+	}
+
+	liveOut := outboundRuleKeys(live.OutboundRules)
+	wantOut := outboundRuleKeys(desired.OutboundRules)
+	for _, r := range desired.OutboundRules {
+		if k := godo.FormatOutboundRule(normalizeOutboundRule(r)); !liveOut[k] {
+			d.AddRules.OutboundRules = append(d.AddRules.OutboundRules, r)
+			liveOut[k] = true
+		}
+	}
+	for _, r := range live.OutboundRules {
+		if k := godo.FormatOutboundRule(normalizeOutboundRule(r)); !wantOut[k] {
+			d.RemoveRules.OutboundRules = append(d.RemoveRules.OutboundRules, r)
+			wantOut[k] = true
+		}
+	}
+
+	d.AddDroplets, d.RemoveDroplets = diffInts(live.DropletIDs, desired.DropletIDs)
+	d.AddTags, d.RemoveTags = diffStrings(live.Tags, desired.Tags)
+	return d
+}
+
+// FirewallReconcileResult describes a reconciliation.
+type FirewallReconcileResult struct {
+	// Changes are the changes that were applied.
+	Changes *FirewallDiff
+
+	// Drift lists the changes that would restore the previously applied
+	// configuration, and so shows what others changed since. It is nil
+	// when no previous configuration was given or nothing drifted.
+	Drift *FirewallDiff
+
+	// Firewall is the firewall after all changes have settled.
+	Firewall *godo.Firewall
+}
+
+// FirewallChangedError is returned when the firewall did not match the
+// desired configuration after reconciling, because it was changed
+// concurrently.
+type FirewallChangedError struct {
+	FirewallID string
+	Diff       *FirewallDiff
+}
+
+func (e *FirewallChangedError) Error() string {
+	return fmt.Sprintf("firewall %s was changed during reconciliation:\n%s", e.FirewallID, e.Diff)
+}
+
+// ReconcileFirewall brings a firewall to the desired configuration by
+// applying only the difference through the rule, droplet and tag endpoints,
+// so that concurrent edits by other tools are not overwritten wholesale.
+// Additions are made before removals so that traffic allowed by both the old
+// and new configuration is never interrupted. It then waits for the firewall
+// to have no pending changes and a succeeded status.
+//
+// previous is the configuration applied by the last reconciliation, if any.
+// It is used to report drift.
+func ReconcileFirewall(ctx context.Context, client *godo.Client, firewallID string, desired, previous *godo.FirewallRequest) (*FirewallReconcileResult, error) {
+	if desired == nil {
+		return nil, godo.NewArgError("desired", "cannot be nil")
+	}
+
+	live, _, err := client.Firewalls.Get(ctx, firewallID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &FirewallReconcileResult{Changes: DiffFirewall(live, desired)}
+	if previous != nil {
+		if drift := DiffFirewall(live, previous); !drift.Empty() {
+			result.Drift = drift
+		}
+	}
+
+	if err := applyFirewallDiff(ctx, client, firewallID, result.Changes); err != nil {
+		return result, err
+	}
+
+	result.Firewall, err = waitForFirewall(ctx, client, firewallID)
+	if err != nil {
+		return result, err
+	}
+
+	if remaining := DiffFirewall(result.Firewall, desired); !remaining.Empty() {
+		return result, &FirewallChangedError{FirewallID: firewallID, Diff: remaining}
+	}
+	return result, nil
+}
+
+func applyFirewallDiff(ctx context.Context, client *godo.Client, firewallID string, d *FirewallDiff) error {
+	fw := client.Firewalls
+
+	if len(d.AddRules.InboundRules) > 0 || len(d.AddRules.OutboundRules) > 0 {
+		if _, err := fw.AddRules(ctx, firewallID, &d.AddRules); err != nil {
+			return fmt.Errorf("add rules: %v", err)
+		}
+	}
+	if len(d.AddDroplets) > 0 {
+		if _, err := fw.AddDroplets(ctx, firewallID, d.AddDroplets...); err != nil {
+			return fmt.Errorf("add droplets: %v", err)
+		}
+	}
+	if len(d.AddTags) > 0 {
+		if _, err := fw.AddTags(ctx, firewallID, d.AddTags...); err != nil {
+			return fmt.Errorf("add tags: %v", err)
+		}
+	}
+	if len(d.RemoveRules.InboundRules) > 0 || len(d.RemoveRules.OutboundRules) > 0 {
+		if _, err := fw.RemoveRules(ctx, firewallID, &d.RemoveRules); err != nil {
+			return fmt.Errorf("remove rules: %v", err)
+		}
+	}
+	if len(d.RemoveDroplets) > 0 {
+		if _, err := fw.RemoveDroplets(ctx, firewallID, d.RemoveDroplets...); err != nil {
+			return fmt.Errorf("remove droplets: %v", err)
+		}
+	}
+	if len(d.RemoveTags) > 0 {
+		if _, err := fw.RemoveTags(ctx, firewallID, d.RemoveTags...); err != nil {
+			return fmt.Errorf("remove tags: %v", err)
+		}
+	}
+	return nil
+}
+
+// waitForFirewall polls a firewall until its changes have been applied to
+// all droplets.
+func waitForFirewall(ctx context.Context, client *godo.Client, firewallID string) (*godo.Firewall, error) {
+	for {
+		fw, _, err := client.Firewalls.Get(ctx, firewallID)
+		if err != nil {
+			return nil, err
+		}
+		if fw.Status == "failed" {
+			return fw, fmt.Errorf("firewall %s failed to apply changes", firewallID)
+		}
+		if fw.Status == "succeeded" && len(fw.PendingChanges) == 0 {
+			return fw, nil
+		}
+		if err := sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func inboundRuleKeys(rules []godo.InboundRule) map[string]bool {
+	keys := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		keys[godo.FormatInboundRule(normalizeInboundRule(r))] = true
+	}
+	return keys
+}
+
+func outboundRuleKeys(rules []godo.OutboundRule) map[string]bool {
+	keys := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		keys[godo.FormatOutboundRule(normalizeOutboundRule(r))] = true
+	}
+	return keys
+}
+
+func normalizeInboundRule(r godo.InboundRule) godo.InboundRule {
+	r.Protocol = strings.ToLower(r.Protocol)
+	r.PortRange = normalizePorts(r.Protocol, r.PortRange)
+	if r.Sources != nil {
+		r.Sources = &godo.Sources{
+			Addresses:        normalizeAddresses(r.Sources.Addresses),
+			Tags:             sortedStrings(r.Sources.Tags),
+			DropletIDs:       sortedInts(r.Sources.DropletIDs),
+			LoadBalancerUIDs: sortedStrings(r.Sources.LoadBalancerUIDs),
+		}
+	}
+	return r
+}
+
+func normalizeOutboundRule(r godo.OutboundRule) godo.OutboundRule {
+	r.Protocol = strings.ToLower(r.Protocol)
+	r.PortRange = normalizePorts(r.Protocol, r.PortRange)
+	if d := r.Destinations; d != nil {
+		r.Destinations = &godo.Destinations{
+			Addresses:        normalizeAddresses(d.Addresses),
+			Tags:             sortedStrings(d.Tags),
+			DropletIDs:       sortedInts(d.DropletIDs),
+			LoadBalancerUIDs: sortedStrings(d.LoadBalancerUIDs),
+		}
+	}
+	return r
+}
+
+// normalizePorts maps the spellings of "all ports" to one, and collapses
+// single-port ranges.
+func normalizePorts(protocol, ports string) string {
+	if protocol == "icmp" {
+		return ""
+	}
+	switch ports {
+	case "", "0", "all", "1-65535":
+		return "all"
+	}
+	if bounds := strings.SplitN(ports, "-", 2); len(bounds) == 2 && bounds[0] == bounds[1] {
+		return bounds[0]
+	}
+	return ports
+}
+
+// normalizeAddresses canonicalises CIDRs, treats single-host CIDRs as plain
+// addresses and sorts the result.
+func normalizeAddresses(addrs []string) []string {
+	out := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if ip, ipnet, err := net.ParseCIDR(a); err == nil {
+			if ones, bits := ipnet.Mask.Size(); ones == bits {
+				a = ip.String()
+			} else {
+				a = ipnet.String()
+			}
+		} else if ip := net.ParseIP(a); ip != nil {
+			a = ip.String()
+		}
+		out = append(out, a)
+	}
+	return sortedStrings(out)
+}
+
+func sortedStrings(s []string) []string {
+	out := dedupeStrings(s)
+	sort.Strings(out)
+	return out
+}
+
+func sortedInts(s []int) []int {
+	seen := make(map[int]bool, len(s))
+	out := []int{}
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+func dedupeStrings(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	out := []string{}
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// diffInts returns the values of want missing from have, and the values of
+// have missing from want.
+func diffInts(have, want []int) (add, remove []int) {
+	in := func(s []int, v int) bool {
+		for _, x := range s {
+			if x == v {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range sortedInts(want) {
+		if !in(have, v) {
+			add = append(add, v)
+		}
+	}
+	for _, v := range sortedInts(have) {
+		if !in(want, v) {
+			remove = append(remove, v)
+		}
+	}
+	return add, remove
+}
+
+// diffStrings is diffInts for strings.
+func diffStrings(have, want []string) (add, remove []string) {
+	in := func(s []string, v string) bool {
+		for _, x := range s {
+			if x == v {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range sortedStrings(want) {
+		if !in(have, v) {
+			add = append(add, v)
+		}
+	}
+	for _, v := range sortedStrings(have) {
+		if !in(want, v) {
+			remove = append(remove, v)
+		}
+	}
+	return add, remove
+}
@@ -0,0 +1,210 @@
+package util
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/godo"
+)
+
+// FirewallPeer is the remote end of a connection: the source of inbound
+// traffic or the destination of outbound traffic. Any combination of fields
+// may be set; a rule matches if it allows any of them.
+type FirewallPeer struct {
+	Address         net.IP
+	DropletID       int
+	Tags            []string
+	LoadBalancerUID string
+}
+
+// FirewallConnection describes traffic to check against a policy. Port is
+// ignored for icmp.
+type FirewallConnection struct {
+	Protocol string
+	Port     int
+	Peer     FirewallPeer
+}
+
+// FirewallMatch names the rule that allowed a connection.
+type FirewallMatch struct {
+	FirewallID   string
+	FirewallName string
+
+	// Rule is the matching rule in the compact rule syntax.
+	Rule string
+}
+
+// FirewallPolicy is the merged policy of all firewalls applied to a
+// droplet, either directly or through its tags.
+type FirewallPolicy struct {
+	DropletID int
+	Firewalls []godo.Firewall
+}
+
+// LoadFirewallPolicy collects the firewalls that apply to a droplet. It
+// combines those listed for the droplet with those applied to any of its
+// tags.
+func LoadFirewallPolicy(ctx context.Context, client *godo.Client, dropletID int) (*FirewallPolicy, error) {
+	if dropletID < 1 {
+		return nil, godo.NewArgError("dropletID", "cannot be less than 1")
+	}
+
+	droplet, _, err := client.Droplets.Get(ctx, dropletID)
+	if err != nil {
+		return nil, err
+	}
+
+	byDroplet, err := listFirewallsByDroplet(ctx, client, dropletID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &FirewallPolicy{DropletID: dropletID}
+	seen := make(map[string]bool)
+	for _, fw := range byDroplet {
+		if !seen[fw.ID] {
+			seen[fw.ID] = true
+			policy.Firewalls = append(policy.Firewalls, fw)
+		}
+	}
+
+	if len(droplet.Tags) > 0 {
+		all, err := listFirewalls(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		for _, fw := range all {
+			if !seen[fw.ID] && hasTag(fw.Tags, droplet.Tags...) {
+				seen[fw.ID] = true
+				policy.Firewalls = append(policy.Firewalls, fw)
+			}
+		}
+	}
+
+	sort.Slice(policy.Firewalls, func(i, j int) bool {
+		return policy.Firewalls[i].Name < policy.Firewalls[j].Name
+	})
+	return policy, nil
+}
+
+// Inbound returns the inbound rules of all applied firewalls in the compact
+// rule syntax, each prefixed with the firewall name.
+func (p *FirewallPolicy) Inbound() []string {
+	var rules []string
+	for _, fw := range p.Firewalls {
+		for _, r := range fw.InboundRules {
+			rules = append(rules, fw.Name+": "+godo.FormatInboundRule(r))
+		}
+	}
+	return rules
+}
+
+// Outbound returns the outbound rules of all applied firewalls in the
+// compact rule syntax, each prefixed with the firewall name.
+func (p *FirewallPolicy) Outbound() []string {
+	var rules []string
+	for _, fw := range p.Firewalls {
+		for _, r := range fw.OutboundRules {
+			rules = append(rules, fw.Name+": "+godo.FormatOutboundRule(r))
+		}
+	}
+	return rules
+}
+
+// AllowsInbound reports whether the policy allows a connection to the
+// droplet from the peer, and which rule allowed it. When no firewall applies
+// to the droplet all traffic is allowed and the match is nil.
+func (p *FirewallPolicy) AllowsInbound(c FirewallConnection) (*FirewallMatch, bool) {
+	if len(p.Firewalls) == 0 {
+		return nil, true
+	}
+	for _, fw := range p.Firewalls {
+		for _, r := range fw.InboundRules {
+			if r.Sources != nil && ruleAllows(r.Protocol, r.PortRange, c) &&
+				peerMatches(c.Peer, r.Sources.Addresses, r.Sources.Tags, r.Sources.DropletIDs, r.Sources.LoadBalancerUIDs) {
+				return &FirewallMatch{FirewallID: fw.ID, FirewallName: fw.Name, Rule: godo.FormatInboundRule(r)}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// AllowsOutbound reports whether the policy allows a connection from the
+// droplet to the peer, and which rule allowed it. When no firewall applies
+// to the droplet all traffic is allowed and the match is nil.
+func (p *FirewallPolicy) AllowsOutbound(c FirewallConnection) (*FirewallMatch, bool) {
+	if len(p.Firewalls) == 0 {
+		return nil, true
+	}
+	for _, fw := range p.Firewalls {
+		for _, r := range fw.OutboundRules {
+			d := r.Destinations
+			if d != nil && ruleAllows(r.Protocol, r.PortRange, c) &&
+				peerMatches(c.Peer, d.Addresses, d.Tags, d.DropletIDs, d.LoadBalancerUIDs) {
+				return &FirewallMatch{FirewallID: fw.ID, FirewallName: fw.Name, Rule: godo.FormatOutboundRule(r)}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func ruleAllows(protocol, ports string, c FirewallConnection) bool {
+	if !strings.EqualFold(protocol, c.Protocol) {
+		return false
+	}
+	if strings.EqualFold(protocol, "icmp") {
+		return true
+	}
+
+	ports = normalizePorts(strings.ToLower(protocol), ports)
+	if ports == "all" {
+		return true
+	}
+	bounds := strings.SplitN(ports, "-", 2)
+	low, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return false
+	}
+	high := low
+	if len(bounds) == 2 {
+		if high, err = strconv.Atoi(bounds[1]); err != nil {
+			return false
+		}
+	}
+	return c.Port >= low && c.Port <= high
+}
+
+func peerMatches(peer FirewallPeer, addresses, tags []string, dropletIDs []int, lbUIDs []string) bool {
+	if peer.Address != nil {
+		for _, a := range addresses {
+			if _, ipnet, err := net.ParseCIDR(a); err == nil {
+				if ipnet.Contains(peer.Address) {
+					return true
+				}
+			} else if ip := net.ParseIP(a); ip != nil && ip.Equal(peer.Address) {
+				return true
+			}
+		}
+	}
+	if hasTag(tags, peer.Tags...) {
+		return true
+	}
+	if peer.DropletID != 0 {
+		for _, id := range dropletIDs {
+			if id == peer.DropletID {
+				return true
+			}
+		}
+	}
+	if peer.LoadBalancerUID != "" {
+		for _, uid := range lbUIDs {
+			if uid == peer.LoadBalancerUID {
+				return true
+			}
+		}
+	}
+	return false
+}
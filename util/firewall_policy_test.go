@@ -0,0 +1,98 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestFirewallPolicy(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets/10", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"droplet": {"id": 10, "tags": ["web"]}}`)
+	})
+	mux.HandleFunc("/v2/droplets/10/firewalls", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"firewalls": [{
+			"id": "fw-ssh", "name": "ssh", "droplet_ids": [10],
+			"inbound_rules": [{"protocol": "tcp", "ports": "22", "sources": {"addresses": ["10.0.0.0/8"], "tags": ["bastion"]}}],
+			"outbound_rules": []
+		}]}`)
+	})
+	mux.HandleFunc("/v2/firewalls", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"firewalls": [
+			{"id": "fw-ssh", "name": "ssh", "droplet_ids": [10]},
+			{"id": "fw-web", "name": "web", "tags": ["web"],
+				"inbound_rules": [
+					{"protocol": "tcp", "ports": "8000-9000", "sources": {"load_balancer_uids": ["lb-1"]}},
+					{"protocol": "icmp", "sources": {"addresses": ["0.0.0.0/0"]}}
+				],
+				"outbound_rules": [{"protocol": "udp", "ports": "0", "destinations": {"addresses": ["0.0.0.0/0"]}}]
+			},
+			{"id": "fw-db", "name": "db", "tags": ["db"],
+				"inbound_rules": [{"protocol": "tcp", "ports": "5432", "sources": {"tags": ["web"]}}]
+			}
+		]}`)
+	})
+
+	policy, err := LoadFirewallPolicy(ctx, client, 10)
+	if err != nil {
+		t.Fatalf("LoadFirewallPolicy returned error: %v", err)
+	}
+
+	expectedInbound := []string{
+		"ssh: in tcp 22 from 10.0.0.0/8,tag:bastion",
+		"web: in tcp 8000-9000 from lb:lb-1",
+		"web: in icmp from 0.0.0.0/0",
+	}
+	if !reflect.DeepEqual(policy.Inbound(), expectedInbound) {
+		t.Errorf("Inbound returned %q, expected %q", policy.Inbound(), expectedInbound)
+	}
+
+	tests := []struct {
+		name     string
+		inbound  bool
+		conn     FirewallConnection
+		expected string
+	}{
+		{"ssh from private range", true, FirewallConnection{Protocol: "tcp", Port: 22, Peer: FirewallPeer{Address: net.ParseIP("10.1.2.3")}}, "in tcp 22 from 10.0.0.0/8,tag:bastion"},
+		{"ssh from bastion", true, FirewallConnection{Protocol: "tcp", Port: 22, Peer: FirewallPeer{Tags: []string{"bastion"}}}, "in tcp 22 from 10.0.0.0/8,tag:bastion"},
+		{"ssh from internet", true, FirewallConnection{Protocol: "tcp", Port: 22, Peer: FirewallPeer{Address: net.ParseIP("192.0.2.1")}}, ""},
+		{"app from load balancer", true, FirewallConnection{Protocol: "tcp", Port: 8080, Peer: FirewallPeer{LoadBalancerUID: "lb-1"}}, "in tcp 8000-9000 from lb:lb-1"},
+		{"app outside range", true, FirewallConnection{Protocol: "tcp", Port: 9001, Peer: FirewallPeer{LoadBalancerUID: "lb-1"}}, ""},
+		{"ping", true, FirewallConnection{Protocol: "icmp", Peer: FirewallPeer{Address: net.ParseIP("192.0.2.1")}}, "in icmp from 0.0.0.0/0"},
+		{"dns out", false, FirewallConnection{Protocol: "udp", Port: 53, Peer: FirewallPeer{Address: net.ParseIP("192.0.2.53")}}, "out udp all to 0.0.0.0/0"},
+		{"https out", false, FirewallConnection{Protocol: "tcp", Port: 443, Peer: FirewallPeer{Address: net.ParseIP("192.0.2.53")}}, ""},
+	}
+
+	for _, tt := range tests {
+		var match *FirewallMatch
+		var allowed bool
+		if tt.inbound {
+			match, allowed = policy.AllowsInbound(tt.conn)
+		} else {
+			match, allowed = policy.AllowsOutbound(tt.conn)
+		}
+
+		if allowed != (tt.expected != "") {
+			t.Errorf("%s: allowed = %v, expected %v", tt.name, allowed, !allowed)
+			continue
+		}
+		if allowed && match.Rule != tt.expected {
+			t.Errorf("%s: matched %q, expected %q", tt.name, match.Rule, tt.expected)
+		}
+	}
+}
+
+func TestFirewallPolicy_NoFirewalls(t *testing.T) {
+	policy := &FirewallPolicy{DropletID: 10}
+	if match, allowed := policy.AllowsInbound(FirewallConnection{Protocol: "tcp", Port: 22}); !allowed || match != nil {
+		t.Errorf("AllowsInbound returned %v, %v, expected nil, true", match, allowed)
+	}
+}
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+const firewallLiveJSON = `{"firewall": {
+	"id": "fw", "status": "succeeded",
+	"inbound_rules": [
+		{"protocol": "tcp", "ports": "22", "sources": {"addresses": ["10.0.0.0/8", "192.0.2.1/32"], "tags": ["bastion"]}},
+		{"protocol": "tcp", "ports": "80", "sources": {"addresses": ["0.0.0.0/0"]}}
+	],
+	"outbound_rules": [
+		{"protocol": "tcp", "ports": "0", "destinations": {"addresses": ["::/0", "0.0.0.0/0"]}}
+	],
+	"droplet_ids": [1, 2],
+	"tags": ["web"],
+	"pending_changes": []
+}}`
+
+const firewallDesiredJSON = `{"firewall": {
+	"id": "fw", "status": "%s",
+	"inbound_rules": [
+		{"protocol": "tcp", "ports": "22", "sources": {"addresses": ["10.0.0.0/8", "192.0.2.1/32"], "tags": ["bastion"]}},
+		{"protocol": "tcp", "ports": "443", "sources": {"addresses": ["0.0.0.0/0"]}}
+	],
+	"outbound_rules": [
+		{"protocol": "tcp", "ports": "0", "destinations": {"addresses": ["::/0", "0.0.0.0/0"]}}
+	],
+	"droplet_ids": [2, 3],
+	"tags": ["web"],
+	"pending_changes": [%s]
+}}`
+
+func firewallDesired() *godo.FirewallRequest {
+	return &godo.FirewallRequest{
+		Name: "web",
+		InboundRules: []godo.InboundRule{
+			{Protocol: "TCP", PortRange: "22-22", Sources: &godo.Sources{Tags: []string{"bastion"}, Addresses: []string{"192.0.2.1", "10.0.0.0/8"}}},
+			{Protocol: "tcp", PortRange: "443", Sources: &godo.Sources{Addresses: []string{"0.0.0.0/0"}}},
+		},
+		OutboundRules: []godo.OutboundRule{
+			{Protocol: "tcp", PortRange: "all", Destinations: &godo.Destinations{Addresses: []string{"0.0.0.0/0", "::/0"}}},
+		},
+		DropletIDs: []int{3, 2},
+		Tags:       []string{"web"},
+	}
+}
+
+func TestDiffFirewall(t *testing.T) {
+	var root struct{ Firewall *godo.Firewall }
+	if err := json.Unmarshal([]byte(firewallLiveJSON), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffFirewall(root.Firewall, firewallDesired())
+
+	expected := "+ in tcp 443 from 0.0.0.0/0\n" +
+		"- in tcp 80 from 0.0.0.0/0\n" +
+		"+ droplet 3\n" +
+		"- droplet 1\n"
+	if diff.String() != expected {
+		t.Errorf("DiffFirewall returned\n%s\nexpected\n%s", diff, expected)
+	}
+
+	if d := DiffFirewall(root.Firewall, &godo.FirewallRequest{
+		InboundRules:  root.Firewall.InboundRules,
+		OutboundRules: root.Firewall.OutboundRules,
+		DropletIDs:    []int{2, 1},
+		Tags:          []string{"web"},
+	}); !d.Empty() {
+		t.Errorf("DiffFirewall of identical configuration returned\n%s", d)
+	}
+}
+
+func TestReconcileFirewall(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	gets := 0
+	mux.HandleFunc("/v2/firewalls/fw", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		gets++
+		switch {
+		case gets == 1:
+			fmt.Fprint(w, firewallLiveJSON)
+		case gets == 2:
+			fmt.Fprintf(w, firewallDesiredJSON, "waiting", `{"droplet_id": 3, "removing": false, "status": "waiting"}`)
+		default:
+			fmt.Fprintf(w, firewallDesiredJSON, "succeeded", "")
+		}
+	})
+	for _, path := range []string{"rules", "droplets", "tags"} {
+		path := path
+		mux.HandleFunc("/v2/firewalls/fw/"+path, func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatalf("decode json: %v", err)
+			}
+			calls = append(calls, fmt.Sprintf("%s %s %v", r.Method, path, body))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	previous := firewallDesired()
+	previous.InboundRules[1].PortRange = "80"
+	previous.DropletIDs = []int{1, 2, 4}
+
+	result, err := ReconcileFirewall(ctx, client, "fw", firewallDesired(), previous)
+	if err != nil {
+		t.Fatalf("ReconcileFirewall returned error: %v", err)
+	}
+
+	expectedCalls := []string{
+		"POST rules map[inbound_rules:[map[ports:443 protocol:tcp sources:map[addresses:[0.0.0.0/0]]]] outbound_rules:<nil>]",
+		"POST droplets map[droplet_ids:[3]]",
+		"DELETE rules map[inbound_rules:[map[ports:80 protocol:tcp sources:map[addresses:[0.0.0.0/0]]]] outbound_rules:<nil>]",
+		"DELETE droplets map[droplet_ids:[1]]",
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("calls = %q, expected %q", calls, expectedCalls)
+	}
+
+	if gets != 3 {
+		t.Errorf("firewall was fetched %d times, expected 3", gets)
+	}
+	if result.Firewall.Status != "succeeded" {
+		t.Errorf("firewall status = %q, expected succeeded", result.Firewall.Status)
+	}
+	if result.Drift == nil || result.Drift.String() != "+ droplet 4\n" {
+		t.Errorf("drift = %v, expected droplet 4 removed by someone else", result.Drift)
+	}
+}
+
+func TestReconcileFirewall_ChangedConcurrently(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/firewalls/fw", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, firewallLiveJSON)
+	})
+	mux.HandleFunc("/v2/firewalls/fw/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	_, err := ReconcileFirewall(ctx, client, "fw", firewallDesired(), nil)
+	if _, ok := err.(*FirewallChangedError); !ok {
+		t.Fatalf("expected *FirewallChangedError, got %v", err)
+	}
+}
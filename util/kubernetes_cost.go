@@ -0,0 +1,245 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/digitalocean/godo"
+)
+
+// defaultVolumePricePerGiB is the monthly price of one GiB of block storage.
+const defaultVolumePricePerGiB = 0.10
+
+// hoursPerMonth converts hourly prices to monthly ones, as the billing does.
+const hoursPerMonth = 730
+
+// defaultLoadBalancerPrices are the monthly prices of load balancers by size.
+var defaultLoadBalancerPrices = map[string]float64{
+	"lb-small":  10,
+	"lb-medium": 20,
+	"lb-large":  40,
+}
+
+// KubernetesCostScenario is a monthly cost with the autoscaling pools at
+// their minimum, current and maximum size.
+type KubernetesCostScenario struct {
+	Min     float64
+	Current float64
+	Max     float64
+}
+
+func (s *KubernetesCostScenario) add(o KubernetesCostScenario) {
+	s.Min += o.Min
+	s.Current += o.Current
+	s.Max += o.Max
+}
+
+// NodePoolCost is the estimated cost of a node pool.
+type NodePoolCost struct {
+	Name string
+	Size string
+
+	// NodePrice is the monthly price of one node.
+	NodePrice float64
+
+	MinNodes, Nodes, MaxNodes int
+
+	Monthly KubernetesCostScenario
+}
+
+// ResourceCost is the estimated monthly cost of a load balancer or volume
+// associated with a cluster.
+type ResourceCost struct {
+	Kind    string
+	ID      string
+	Name    string
+	Monthly float64
+}
+
+// KubernetesCostEstimate is the estimated monthly cost of a cluster.
+type KubernetesCostEstimate struct {
+	Pools     []NodePoolCost
+	Resources []ResourceCost
+
+	// Monthly is the total of the pools and resources.
+	Monthly KubernetesCostScenario
+}
+
+// String renders the estimate as a table.
+func (e *KubernetesCostEstimate) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%-20s %-16s %5s %9s %9s %9s\n", "POOL", "SIZE", "NODES", "MIN", "CURRENT", "MAX")
+	for _, p := range e.Pools {
+		fmt.Fprintf(&b, "%-20s %-16s %5d %9.2f %9.2f %9.2f\n", p.Name, p.Size, p.Nodes, p.Monthly.Min, p.Monthly.Current, p.Monthly.Max)
+	}
+	for _, r := range e.Resources {
+		fmt.Fprintf(&b, "%-20s %-16s %5s %9.2f %9.2f %9.2f\n", r.Name, r.Kind, "", r.Monthly, r.Monthly, r.Monthly)
+	}
+	fmt.Fprintf(&b, "%-20s %-16s %5s %9.2f %9.2f %9.2f\n", "TOTAL", "", "", e.Monthly.Min, e.Monthly.Current, e.Monthly.Max)
+	return b.String()
+}
+
+// KubernetesCostEstimator estimates the monthly cost of Kubernetes clusters
+// from the droplet prices returned by Sizes.List.
+type KubernetesCostEstimator struct {
+	Client *godo.Client
+
+	// IncludeResources adds the load balancers and volumes tagged with the
+	// cluster's "k8s:<cluster id>" tag.
+	IncludeResources bool
+
+	// LoadBalancerPrices are the monthly prices of load balancers by size
+	// slug. They default to the list prices of lb-small, lb-medium and
+	// lb-large.
+	LoadBalancerPrices map[string]float64
+
+	// VolumePricePerGiB defaults to 0.10.
+	VolumePricePerGiB float64
+
+	sizes map[string]godo.Size
+}
+
+// EstimateCluster estimates the cost of an existing cluster.
+func (e *KubernetesCostEstimator) EstimateCluster(ctx context.Context, cluster *godo.KubernetesCluster) (*KubernetesCostEstimate, error) {
+	if cluster == nil {
+		return nil, godo.NewArgError("cluster", "cannot be nil")
+	}
+
+	pools := make([]*godo.KubernetesNodePoolCreateRequest, 0, len(cluster.NodePools))
+	for _, p := range cluster.NodePools {
+		if p == nil {
+			// Left for estimatePools to report.
+			pools = append(pools, nil)
+			continue
+		}
+		pools = append(pools, &godo.KubernetesNodePoolCreateRequest{
+			Name:      p.Name,
+			Size:      p.Size,
+			Count:     p.Count,
+			AutoScale: p.AutoScale,
+			MinNodes:  p.MinNodes,
+			MaxNodes:  p.MaxNodes,
+		})
+	}
+	est, err := e.estimatePools(ctx, pools)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.IncludeResources && cluster.ID != "" {
+		if err := e.addResources(ctx, est, "k8s:"+cluster.ID); err != nil {
+			return nil, err
+		}
+	}
+	return est, nil
+}
+
+// EstimateCreateRequest estimates the cost of a cluster before it is
+// created. Autoscaling pools without a count start at their minimum size.
+func (e *KubernetesCostEstimator) EstimateCreateRequest(ctx context.Context, req *godo.KubernetesClusterCreateRequest) (*KubernetesCostEstimate, error) {
+	if req == nil {
+		return nil, godo.NewArgError("req", "cannot be nil")
+	}
+	return e.estimatePools(ctx, req.NodePools)
+}
+
+func (e *KubernetesCostEstimator) estimatePools(ctx context.Context, pools []*godo.KubernetesNodePoolCreateRequest) (*KubernetesCostEstimate, error) {
+	if e.sizes == nil {
+		sizes, err := listSizes(ctx, e.Client)
+		if err != nil {
+			return nil, err
+		}
+		e.sizes = make(map[string]godo.Size, len(sizes))
+		for _, s := range sizes {
+			e.sizes[s.Slug] = s
+		}
+	}
+
+	est := &KubernetesCostEstimate{}
+	for i, p := range pools {
+		if p == nil {
+			return nil, godo.NewArgError(fmt.Sprintf("node_pools[%d]", i), "cannot be nil")
+		}
+		size, ok := e.sizes[p.Size]
+		if !ok {
+			return nil, fmt.Errorf("node pool %s: unknown size %q", p.Name, p.Size)
+		}
+
+		c := NodePoolCost{Name: p.Name, Size: p.Size, NodePrice: monthlyPrice(size)}
+		c.MinNodes, c.Nodes, c.MaxNodes = p.Count, p.Count, p.Count
+		if p.AutoScale {
+			c.MinNodes, c.MaxNodes = p.MinNodes, p.MaxNodes
+			if c.Nodes < c.MinNodes {
+				c.Nodes = c.MinNodes
+			}
+			if c.Nodes > c.MaxNodes {
+				c.Nodes = c.MaxNodes
+			}
+		}
+		c.Monthly = KubernetesCostScenario{
+			Min:     float64(c.MinNodes) * c.NodePrice,
+			Current: float64(c.Nodes) * c.NodePrice,
+			Max:     float64(c.MaxNodes) * c.NodePrice,
+		}
+
+		est.Pools = append(est.Pools, c)
+		est.Monthly.add(c.Monthly)
+	}
+	return est, nil
+}
+
+func (e *KubernetesCostEstimator) addResources(ctx context.Context, est *KubernetesCostEstimate, tag string) error {
+	lbPrices := e.LoadBalancerPrices
+	if lbPrices == nil {
+		lbPrices = defaultLoadBalancerPrices
+	}
+	volumePrice := e.VolumePricePerGiB
+	if volumePrice == 0 {
+		volumePrice = defaultVolumePricePerGiB
+	}
+
+	lbs, err := listLoadBalancers(ctx, e.Client)
+	if err != nil {
+		return err
+	}
+	for _, lb := range lbs {
+		if !hasTag(lb.Tags, tag) {
+			continue
+		}
+		size := lb.SizeSlug
+		if size == "" {
+			size = "lb-small"
+		}
+		price, ok := lbPrices[size]
+		if !ok {
+			return fmt.Errorf("load balancer %s: no price for size %q", lb.Name, size)
+		}
+		est.addResource(ResourceCost{Kind: "load_balancer", ID: lb.ID, Name: lb.Name, Monthly: price})
+	}
+
+	volumes, err := listVolumes(ctx, e.Client)
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if hasTag(v.Tags, tag) {
+			est.addResource(ResourceCost{Kind: "volume", ID: v.ID, Name: v.Name, Monthly: float64(v.SizeGigaBytes) * volumePrice})
+		}
+	}
+	return nil
+}
+
+func (e *KubernetesCostEstimate) addResource(r ResourceCost) {
+	e.Resources = append(e.Resources, r)
+	e.Monthly.add(KubernetesCostScenario{Min: r.Monthly, Current: r.Monthly, Max: r.Monthly})
+}
+
+// monthlyPrice returns the monthly price of a size, derived from the hourly
+// price for sizes that only have one.
+func monthlyPrice(s godo.Size) float64 {
+	if s.PriceMonthly == 0 {
+		return s.PriceHourly * hoursPerMonth
+	}
+	return s.PriceMonthly
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func handleSizes(t *testing.T) {
+	mux.HandleFunc("/v2/sizes", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"sizes": [
+			{"slug": "s-1vcpu-2gb", "price_monthly": 10, "price_hourly": 0.01488},
+			{"slug": "s-2vcpu-4gb", "price_monthly": 20, "price_hourly": 0.02976}
+		]}`)
+	})
+}
+
+func TestKubernetesCostEstimator_EstimateCluster(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleSizes(t)
+	mux.HandleFunc("/v2/load_balancers", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"load_balancers": [
+			{"id": "lb1", "name": "ingress", "size": "lb-medium", "tags": ["k8s:k8s"]},
+			{"id": "lb2", "name": "other", "tags": ["web"]}
+		]}`)
+	})
+	mux.HandleFunc("/v2/volumes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"volumes": [
+			{"id": "v1", "name": "pvc-1", "size_gigabytes": 50, "tags": ["k8s", "k8s:k8s"]},
+			{"id": "v2", "name": "data", "size_gigabytes": 100}
+		]}`)
+	})
+
+	cluster := &godo.KubernetesCluster{
+		ID: "k8s",
+		NodePools: []*godo.KubernetesNodePool{
+			{Name: "workers", Size: "s-2vcpu-4gb", Count: 3},
+			{Name: "batch", Size: "s-1vcpu-2gb", Count: 2, AutoScale: true, MinNodes: 1, MaxNodes: 5},
+		},
+	}
+
+	e := &KubernetesCostEstimator{Client: client, IncludeResources: true}
+	est, err := e.EstimateCluster(ctx, cluster)
+	if err != nil {
+		t.Fatalf("EstimateCluster returned error: %v", err)
+	}
+
+	expectedPools := []NodePoolCost{
+		{Name: "workers", Size: "s-2vcpu-4gb", NodePrice: 20, MinNodes: 3, Nodes: 3, MaxNodes: 3,
+			Monthly: KubernetesCostScenario{Min: 60, Current: 60, Max: 60}},
+		{Name: "batch", Size: "s-1vcpu-2gb", NodePrice: 10, MinNodes: 1, Nodes: 2, MaxNodes: 5,
+			Monthly: KubernetesCostScenario{Min: 10, Current: 20, Max: 50}},
+	}
+	if !reflect.DeepEqual(est.Pools, expectedPools) {
+		t.Errorf("pools = %+v, expected %+v", est.Pools, expectedPools)
+	}
+
+	expectedResources := []ResourceCost{
+		{Kind: "load_balancer", ID: "lb1", Name: "ingress", Monthly: 20},
+		{Kind: "volume", ID: "v1", Name: "pvc-1", Monthly: 5},
+	}
+	if !reflect.DeepEqual(est.Resources, expectedResources) {
+		t.Errorf("resources = %+v, expected %+v", est.Resources, expectedResources)
+	}
+
+	expected := KubernetesCostScenario{Min: 95, Current: 105, Max: 135}
+	if est.Monthly != expected {
+		t.Errorf("monthly = %+v, expected %+v", est.Monthly, expected)
+	}
+}
+
+func TestKubernetesCostEstimator_EstimateCreateRequest(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleSizes(t)
+
+	e := &KubernetesCostEstimator{Client: client}
+	req := &godo.KubernetesClusterCreateRequest{
+		NodePools: []*godo.KubernetesNodePoolCreateRequest{
+			{Name: "pool", Size: "s-1vcpu-2gb", AutoScale: true, MinNodes: 2, MaxNodes: 4},
+		},
+	}
+	est, err := e.EstimateCreateRequest(ctx, req)
+	if err != nil {
+		t.Fatalf("EstimateCreateRequest returned error: %v", err)
+	}
+	expected := KubernetesCostScenario{Min: 20, Current: 20, Max: 40}
+	if est.Monthly != expected {
+		t.Errorf("monthly = %+v, expected %+v", est.Monthly, expected)
+	}
+
+	req.NodePools[0].Size = "s-64vcpu-256gb"
+	if _, err := e.EstimateCreateRequest(ctx, req); err == nil {
+		t.Error("expected error for an unknown size")
+	}
+}
+
+func TestKubernetesCostEstimator_HourlyOnlyAndNilPools(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/sizes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sizes": [{"slug": "gpu-1", "price_hourly": 2.5}]}`)
+	})
+
+	e := &KubernetesCostEstimator{Client: client}
+	cluster := &godo.KubernetesCluster{
+		NodePools: []*godo.KubernetesNodePool{{Name: "gpu", Size: "gpu-1", Count: 2}},
+	}
+	est, err := e.EstimateCluster(ctx, cluster)
+	if err != nil {
+		t.Fatalf("EstimateCluster returned error: %v", err)
+	}
+	if est.Pools[0].NodePrice != 1825 || est.Monthly.Current != 3650 {
+		t.Errorf("pool = %+v, expected a node price of 1825 from the hourly price", est.Pools[0])
+	}
+
+	cluster.NodePools = append(cluster.NodePools, nil)
+	_, err = e.EstimateCluster(ctx, cluster)
+	if _, ok := err.(*godo.ArgError); !ok {
+		t.Errorf("EstimateCluster returned %v for a nil pool, expected an ArgError", err)
+	}
+}
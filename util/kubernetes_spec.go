@@ -0,0 +1,517 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/digitalocean/godo"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// KubernetesClusterSpec is the desired state of a Kubernetes cluster. It can
+// be read from YAML or JSON with ParseKubernetesClusterSpec.
+type KubernetesClusterSpec struct {
+	Name   string   `json:"name" yaml:"name"`
+	Region string   `json:"region" yaml:"region"`
+	Tags   []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// Version is a version slug, a patch version such as "1.18.8" or a
+	// minor version such as "1.18". An empty version is not managed.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+
+	VPCUUID string `json:"vpc_uuid,omitempty" yaml:"vpc_uuid,omitempty"`
+
+	MaintenancePolicy *KubernetesMaintenanceSpec `json:"maintenance_policy,omitempty" yaml:"maintenance_policy,omitempty"`
+	AutoUpgrade       bool                       `json:"auto_upgrade" yaml:"auto_upgrade"`
+	SurgeUpgrade      bool                       `json:"surge_upgrade" yaml:"surge_upgrade"`
+
+	NodePools []KubernetesNodePoolSpec `json:"node_pools" yaml:"node_pools"`
+}
+
+// KubernetesMaintenanceSpec is the desired maintenance window of a cluster.
+// Day is a lower case day name or "any".
+type KubernetesMaintenanceSpec struct {
+	StartTime string `json:"start_time" yaml:"start_time"`
+	Day       string `json:"day" yaml:"day"`
+}
+
+// KubernetesNodePoolSpec is the desired state of a node pool. Pools are
+// matched to live pools by name. Count is ignored for autoscaled pools.
+type KubernetesNodePoolSpec struct {
+	Name      string            `json:"name" yaml:"name"`
+	Size      string            `json:"size" yaml:"size"`
+	Count     int               `json:"count,omitempty" yaml:"count,omitempty"`
+	AutoScale bool              `json:"auto_scale,omitempty" yaml:"auto_scale,omitempty"`
+	MinNodes  int               `json:"min_nodes,omitempty" yaml:"min_nodes,omitempty"`
+	MaxNodes  int               `json:"max_nodes,omitempty" yaml:"max_nodes,omitempty"`
+	Tags      []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Taints    []godo.Taint      `json:"taints,omitempty" yaml:"taints,omitempty"`
+}
+
+// ParseKubernetesClusterSpec reads a cluster spec from YAML or JSON.
+func ParseKubernetesClusterSpec(data []byte) (*KubernetesClusterSpec, error) {
+	spec := new(KubernetesClusterSpec)
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, err
+	}
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func (s *KubernetesClusterSpec) validate() error {
+	if s.Name == "" {
+		return godo.NewArgError("name", "cannot be empty")
+	}
+	if s.Region == "" {
+		return godo.NewArgError("region", "cannot be empty")
+	}
+	if s.MaintenancePolicy != nil {
+		if _, err := godo.KubernetesMaintenanceToDay(s.MaintenancePolicy.Day); err != nil {
+			return godo.NewArgError("maintenance_policy.day", err.Error())
+		}
+	}
+	if len(s.NodePools) == 0 {
+		return godo.NewArgError("node_pools", "must have at least one node pool")
+	}
+	names := make(map[string]bool)
+	for i, p := range s.NodePools {
+		arg := fmt.Sprintf("node_pools[%d]", i)
+		if p.Name == "" {
+			return godo.NewArgError(arg+".name", "cannot be empty")
+		}
+		if names[p.Name] {
+			return godo.NewArgError(arg+".name", fmt.Sprintf("duplicate pool name %q", p.Name))
+		}
+		names[p.Name] = true
+		if p.Size == "" {
+			return godo.NewArgError(arg+".size", "cannot be empty")
+		}
+		if p.AutoScale && p.MinNodes > p.MaxNodes {
+			return godo.NewArgError(arg+".min_nodes", "cannot be greater than max_nodes")
+		}
+	}
+	return nil
+}
+
+// KubernetesChangeType is the kind of change in a KubernetesPlan.
+type KubernetesChangeType string
+
+// Changes made by KubernetesSpecSync.
+const (
+	KubernetesUpdateCluster  KubernetesChangeType = "update-cluster"
+	KubernetesUpgradeCluster KubernetesChangeType = "upgrade-cluster"
+	KubernetesCreatePool     KubernetesChangeType = "create-pool"
+	KubernetesUpdatePool     KubernetesChangeType = "update-pool"
+	KubernetesDeletePool     KubernetesChangeType = "delete-pool"
+)
+
+// KubernetesChange is a single operation in a KubernetesPlan. Only the
+// request matching its Type is set.
+type KubernetesChange struct {
+	Type     KubernetesChangeType
+	PoolID   string
+	PoolName string
+
+	// Fields describes what changes, for example "count: 3 -> 5".
+	Fields []string
+
+	ClusterUpdate *godo.KubernetesClusterUpdateRequest
+	Upgrade       *godo.KubernetesClusterUpgradeRequest
+	PoolCreate    *godo.KubernetesNodePoolCreateRequest
+	PoolUpdate    *godo.KubernetesNodePoolUpdateRequest
+}
+
+// KubernetesConflict is a difference that cannot be applied in place.
+type KubernetesConflict struct {
+	Field   string
+	Live    string
+	Desired string
+	Reason  string
+}
+
+// KubernetesPlan lists the changes needed to converge a cluster to a spec.
+type KubernetesPlan struct {
+	ClusterID string
+	Changes   []KubernetesChange
+
+	// Conflicts are never applied. Most of them require replacing the
+	// cluster or a node pool.
+	Conflicts []KubernetesConflict
+}
+
+// Empty reports whether the plan neither changes anything nor has
+// conflicts.
+func (p *KubernetesPlan) Empty() bool {
+	return len(p.Changes) == 0 && len(p.Conflicts) == 0
+}
+
+// String renders the plan for review.
+func (p *KubernetesPlan) String() string {
+	var b bytes.Buffer
+	for _, c := range p.Changes {
+		b.WriteString(string(c.Type))
+		if c.PoolName != "" {
+			b.WriteString(" " + c.PoolName)
+		}
+		if len(c.Fields) > 0 {
+			b.WriteString(": " + strings.Join(c.Fields, ", "))
+		}
+		b.WriteString("\n")
+	}
+	for _, c := range p.Conflicts {
+		fmt.Fprintf(&b, "conflict %s: %s -> %s: %s\n", c.Field, c.Live, c.Desired, c.Reason)
+	}
+	return b.String()
+}
+
+// KubernetesSpecSync converges a cluster to a KubernetesClusterSpec.
+type KubernetesSpecSync struct {
+	Client    *godo.Client
+	ClusterID string
+
+	// Prune deletes the node pools that are not in the spec. They are left
+	// alone otherwise.
+	Prune bool
+}
+
+// Plan compares the spec with the live cluster and its node pools and
+// returns the changes needed. Nothing is changed.
+func (s *KubernetesSpecSync) Plan(ctx context.Context, spec *KubernetesClusterSpec) (*KubernetesPlan, error) {
+	if s.ClusterID == "" {
+		return nil, godo.NewArgError("ClusterID", "cannot be empty")
+	}
+	if spec == nil {
+		return nil, godo.NewArgError("spec", "cannot be nil")
+	}
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	cluster, _, err := s.Client.Kubernetes.Get(ctx, s.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+	pools, err := listNodePools(ctx, s.Client, s.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &KubernetesPlan{ClusterID: s.ClusterID}
+	if spec.Region != cluster.RegionSlug {
+		plan.conflict("region", cluster.RegionSlug, spec.Region, "requires a new cluster")
+	}
+	if spec.VPCUUID != "" && spec.VPCUUID != cluster.VPCUUID {
+		plan.conflict("vpc_uuid", cluster.VPCUUID, spec.VPCUUID, "requires a new cluster")
+	}
+
+	if c := diffKubernetesCluster(plan, cluster, spec); c != nil {
+		plan.Changes = append(plan.Changes, *c)
+	}
+
+	live := make(map[string]*godo.KubernetesNodePool, len(pools))
+	for _, p := range pools {
+		live[p.Name] = p
+	}
+	for i := range spec.NodePools {
+		want := &spec.NodePools[i]
+		have, ok := live[want.Name]
+		if !ok {
+			plan.Changes = append(plan.Changes, KubernetesChange{
+				Type:       KubernetesCreatePool,
+				PoolName:   want.Name,
+				Fields:     []string{fmt.Sprintf("size: %s", want.Size)},
+				PoolCreate: nodePoolCreateRequest(want),
+			})
+			continue
+		}
+		delete(live, want.Name)
+		if c := diffNodePool(plan, have, want); c != nil {
+			plan.Changes = append(plan.Changes, *c)
+		}
+	}
+	for _, p := range pools {
+		if _, ok := live[p.Name]; ok && s.Prune {
+			plan.Changes = append(plan.Changes, KubernetesChange{Type: KubernetesDeletePool, PoolID: p.ID, PoolName: p.Name})
+		}
+	}
+
+	if spec.Version != "" && !kubeVersionMatches(cluster.VersionSlug, spec.Version) {
+		if err := s.planUpgrade(ctx, plan, cluster.VersionSlug, spec.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+func (s *KubernetesSpecSync) planUpgrade(ctx context.Context, plan *KubernetesPlan, current, target string) error {
+	upgrades, _, err := s.Client.Kubernetes.GetUpgrades(ctx, s.ClusterID)
+	if err != nil {
+		return err
+	}
+
+	var available []kubeVersion
+	for _, v := range upgrades {
+		if kv, err := parseKubeVersion(v.Slug); err == nil {
+			available = append(available, kv)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool { return available[i].less(available[j]) })
+
+	to, err := resolveKubeTarget(available, target)
+	if err != nil {
+		plan.conflict("version", current, target, "not a direct upgrade, see PlanKubernetesUpgrade")
+		return nil
+	}
+	plan.Changes = append(plan.Changes, KubernetesChange{
+		Type:    KubernetesUpgradeCluster,
+		Fields:  []string{fmt.Sprintf("version: %s -> %s", current, to.slug)},
+		Upgrade: &godo.KubernetesClusterUpgradeRequest{VersionSlug: to.slug},
+	})
+	return nil
+}
+
+// Apply executes the changes of a plan. The cluster is updated first and
+// upgraded last, and Apply waits for the upgrade to finish. Conflicts are
+// not applied.
+func (s *KubernetesSpecSync) Apply(ctx context.Context, plan *KubernetesPlan) error {
+	if plan == nil {
+		return godo.NewArgError("plan", "cannot be nil")
+	}
+
+	order := []KubernetesChangeType{
+		KubernetesUpdateCluster,
+		KubernetesCreatePool,
+		KubernetesUpdatePool,
+		KubernetesDeletePool,
+		KubernetesUpgradeCluster,
+	}
+	for _, typ := range order {
+		for i := range plan.Changes {
+			c := &plan.Changes[i]
+			if c.Type != typ {
+				continue
+			}
+
+			var err error
+			switch c.Type {
+			case KubernetesUpdateCluster:
+				_, _, err = s.Client.Kubernetes.Update(ctx, plan.ClusterID, c.ClusterUpdate)
+			case KubernetesCreatePool:
+				_, _, err = s.Client.Kubernetes.CreateNodePool(ctx, plan.ClusterID, c.PoolCreate)
+			case KubernetesUpdatePool:
+				_, _, err = s.Client.Kubernetes.UpdateNodePool(ctx, plan.ClusterID, c.PoolID, c.PoolUpdate)
+			case KubernetesDeletePool:
+				_, err = s.Client.Kubernetes.DeleteNodePool(ctx, plan.ClusterID, c.PoolID)
+			case KubernetesUpgradeCluster:
+				if _, err = s.Client.Kubernetes.Upgrade(ctx, plan.ClusterID, c.Upgrade); err == nil {
+					err = waitForKubernetesVersion(ctx, s.Client, plan.ClusterID, c.Upgrade.VersionSlug)
+				}
+			}
+			if err != nil {
+				if c.PoolName != "" {
+					return fmt.Errorf("%s %s: %v", c.Type, c.PoolName, err)
+				}
+				return fmt.Errorf("%s: %v", c.Type, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Sync plans and applies a spec in one step.
+func (s *KubernetesSpecSync) Sync(ctx context.Context, spec *KubernetesClusterSpec) (*KubernetesPlan, error) {
+	plan, err := s.Plan(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	return plan, s.Apply(ctx, plan)
+}
+
+// cannotClearReason is the conflict reason for tags and labels that would be
+// cleared. Update requests omit empty values, so the API never sees them.
+const cannotClearReason = "cannot be cleared by an update request"
+
+func (p *KubernetesPlan) conflict(field, live, desired, reason string) {
+	p.Conflicts = append(p.Conflicts, KubernetesConflict{Field: field, Live: live, Desired: desired, Reason: reason})
+}
+
+func diffKubernetesCluster(plan *KubernetesPlan, have *godo.KubernetesCluster, want *KubernetesClusterSpec) *KubernetesChange {
+	// The update request requires the name even when it does not change.
+	req := &godo.KubernetesClusterUpdateRequest{Name: want.Name}
+	var fields []string
+
+	if want.Name != have.Name {
+		fields = append(fields, fmt.Sprintf("name: %s -> %s", have.Name, want.Name))
+	}
+	haveTags, wantTags := userKubeTags(have.Tags), userKubeTags(want.Tags)
+	switch {
+	case equalStrings(haveTags, wantTags):
+	case len(wantTags) == 0:
+		plan.conflict("tags", fmt.Sprint(haveTags), "[]", cannotClearReason)
+	default:
+		req.Tags = wantTags
+		fields = append(fields, fmt.Sprintf("tags: %v -> %v", haveTags, wantTags))
+	}
+	if mp := want.MaintenancePolicy; mp != nil {
+		var start, day string
+		if have.MaintenancePolicy != nil {
+			start, day = have.MaintenancePolicy.StartTime, have.MaintenancePolicy.Day.String()
+		}
+		if mp.StartTime != start || mp.Day != day {
+			d, _ := godo.KubernetesMaintenanceToDay(mp.Day)
+			req.MaintenancePolicy = &godo.KubernetesMaintenancePolicy{StartTime: mp.StartTime, Day: d}
+			fields = append(fields, fmt.Sprintf("maintenance_policy: %s %s -> %s %s", day, start, mp.Day, mp.StartTime))
+		}
+	}
+	if want.AutoUpgrade != have.AutoUpgrade {
+		req.AutoUpgrade = godo.Bool(want.AutoUpgrade)
+		fields = append(fields, fmt.Sprintf("auto_upgrade: %v -> %v", have.AutoUpgrade, want.AutoUpgrade))
+	}
+	if want.SurgeUpgrade != have.SurgeUpgrade {
+		if want.SurgeUpgrade {
+			req.SurgeUpgrade = true
+			fields = append(fields, "surge_upgrade: false -> true")
+		} else {
+			plan.conflict("surge_upgrade", "true", "false", "cannot be disabled by an update request")
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &KubernetesChange{Type: KubernetesUpdateCluster, Fields: fields, ClusterUpdate: req}
+}
+
+func diffNodePool(plan *KubernetesPlan, have *godo.KubernetesNodePool, want *KubernetesNodePoolSpec) *KubernetesChange {
+	if want.Size != have.Size {
+		plan.conflict(fmt.Sprintf("node_pools[%s].size", want.Name), have.Size, want.Size, "requires a new node pool")
+	}
+
+	req := &godo.KubernetesNodePoolUpdateRequest{Name: have.Name, Count: godo.Int(have.Count)}
+	var fields []string
+
+	if !want.AutoScale && want.Count != have.Count {
+		req.Count = godo.Int(want.Count)
+		fields = append(fields, fmt.Sprintf("count: %d -> %d", have.Count, want.Count))
+	}
+	if want.AutoScale != have.AutoScale {
+		req.AutoScale = godo.Bool(want.AutoScale)
+		fields = append(fields, fmt.Sprintf("auto_scale: %v -> %v", have.AutoScale, want.AutoScale))
+	}
+	if want.AutoScale && (want.MinNodes != have.MinNodes || want.MaxNodes != have.MaxNodes) {
+		req.AutoScale = godo.Bool(true)
+		req.MinNodes, req.MaxNodes = godo.Int(want.MinNodes), godo.Int(want.MaxNodes)
+		fields = append(fields, fmt.Sprintf("nodes: %d-%d -> %d-%d", have.MinNodes, have.MaxNodes, want.MinNodes, want.MaxNodes))
+	}
+	haveTags, wantTags := userKubeTags(have.Tags), userKubeTags(want.Tags)
+	switch {
+	case equalStrings(haveTags, wantTags):
+	case len(wantTags) == 0:
+		plan.conflict(fmt.Sprintf("node_pools[%s].tags", want.Name), fmt.Sprint(haveTags), "[]", cannotClearReason)
+	default:
+		req.Tags = wantTags
+		fields = append(fields, fmt.Sprintf("tags: %v -> %v", haveTags, wantTags))
+	}
+	switch {
+	case equalLabels(have.Labels, want.Labels):
+	case len(want.Labels) == 0:
+		plan.conflict(fmt.Sprintf("node_pools[%s].labels", want.Name), fmt.Sprint(have.Labels), "map[]", cannotClearReason)
+	default:
+		req.Labels = want.Labels
+		fields = append(fields, fmt.Sprintf("labels: %v -> %v", have.Labels, want.Labels))
+	}
+	haveTaints, wantTaints := taintStrings(have.Taints), taintStrings(want.Taints)
+	if !equalStrings(haveTaints, wantTaints) {
+		taints := append([]godo.Taint{}, want.Taints...)
+		req.Taints = &taints
+		fields = append(fields, fmt.Sprintf("taints: %v -> %v", haveTaints, wantTaints))
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &KubernetesChange{Type: KubernetesUpdatePool, PoolID: have.ID, PoolName: have.Name, Fields: fields, PoolUpdate: req}
+}
+
+func nodePoolCreateRequest(p *KubernetesNodePoolSpec) *godo.KubernetesNodePoolCreateRequest {
+	req := &godo.KubernetesNodePoolCreateRequest{
+		Name:      p.Name,
+		Size:      p.Size,
+		Count:     p.Count,
+		Tags:      p.Tags,
+		Labels:    p.Labels,
+		Taints:    p.Taints,
+		AutoScale: p.AutoScale,
+		MinNodes:  p.MinNodes,
+		MaxNodes:  p.MaxNodes,
+	}
+	if p.AutoScale && req.Count < p.MinNodes {
+		req.Count = p.MinNodes
+	}
+	return req
+}
+
+// kubeVersionMatches reports whether a version slug satisfies a spec
+// version, which may be a slug, a patch version or a minor version.
+func kubeVersionMatches(slug, want string) bool {
+	if slug == want {
+		return true
+	}
+	v, err := parseKubeVersion(slug)
+	if err != nil {
+		return false
+	}
+	return v.version() == want || fmt.Sprintf("%d.%d", v.major, v.minor) == want
+}
+
+// userKubeTags returns the sorted tags without the "k8s" tags that DOKS
+// manages itself.
+func userKubeTags(tags []string) []string {
+	var user []string
+	for _, t := range tags {
+		if t != "k8s" && !strings.HasPrefix(t, "k8s:") {
+			user = append(user, t)
+		}
+	}
+	return sortedStrings(user)
+}
+
+func taintStrings(taints []godo.Taint) []string {
+	s := make([]string, 0, len(taints))
+	for _, t := range taints {
+		s = append(s, t.String())
+	}
+	sort.Strings(s)
+	return s
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
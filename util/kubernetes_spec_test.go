@@ -0,0 +1,228 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+const testKubernetesSpec = `
+name: prod
+region: nyc1
+version: "1.17"
+tags: [web]
+maintenance_policy:
+  start_time: "04:00"
+  day: sunday
+auto_upgrade: true
+surge_upgrade: true
+node_pools:
+- name: workers
+  size: s-2vcpu-4gb
+  count: 5
+  labels:
+    tier: web
+  taints:
+  - key: dedicated
+    value: web
+    effect: NoSchedule
+- name: batch
+  size: s-4vcpu-8gb
+  auto_scale: true
+  min_nodes: 1
+  max_nodes: 4
+- name: system
+  size: s-4vcpu-8gb
+  count: 2
+`
+
+func handleKubernetesSpecCluster(t *testing.T) {
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_cluster": {"id": "k8s", "name": "prod", "region": "sfo2",
+			"version": "1.16.8-do.0", "tags": ["k8s", "k8s:k8s", "web"], "auto_upgrade": true,
+			"maintenance_policy": {"start_time": "00:00", "day": "any"}}}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"node_pools": [
+			{"id": "p1", "name": "workers", "size": "s-2vcpu-4gb", "count": 3, "tags": ["k8s", "k8s:worker"]},
+			{"id": "p2", "name": "system", "size": "s-2vcpu-4gb", "count": 2},
+			{"id": "p3", "name": "legacy", "size": "s-1vcpu-2gb", "count": 1}
+		]}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/upgrades", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"available_upgrade_versions": [{"slug": "1.17.5-do.0"}, {"slug": "1.17.9-do.0"}]}`)
+	})
+}
+
+func TestKubernetesSpecSync_Plan(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleKubernetesSpecCluster(t)
+
+	spec, err := ParseKubernetesClusterSpec([]byte(testKubernetesSpec))
+	if err != nil {
+		t.Fatalf("ParseKubernetesClusterSpec returned error: %v", err)
+	}
+
+	s := &KubernetesSpecSync{Client: client, ClusterID: "k8s", Prune: true}
+	plan, err := s.Plan(ctx, spec)
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	expected := `update-cluster: maintenance_policy: any 00:00 -> sunday 04:00, surge_upgrade: false -> true
+update-pool workers: count: 3 -> 5, labels: map[] -> map[tier:web], taints: [] -> [dedicated=web:NoSchedule]
+create-pool batch: size: s-4vcpu-8gb
+delete-pool legacy
+upgrade-cluster: version: 1.16.8-do.0 -> 1.17.9-do.0
+conflict region: sfo2 -> nyc1: requires a new cluster
+conflict node_pools[system].size: s-2vcpu-4gb -> s-4vcpu-8gb: requires a new node pool
+`
+	if got := plan.String(); got != expected {
+		t.Errorf("plan =\n%s\nexpected\n%s", got, expected)
+	}
+
+	if update := plan.Changes[0].ClusterUpdate; update.Name != "prod" {
+		t.Errorf("cluster update = %+v, expected it to carry the name", update)
+	}
+	if update := plan.Changes[1].PoolUpdate; update.Name != "workers" || update.Count == nil {
+		t.Errorf("pool update = %+v, expected it to carry the name and count", update)
+	}
+
+	create := plan.Changes[2].PoolCreate
+	if create.Count != 1 || !create.AutoScale || create.MaxNodes != 4 {
+		t.Errorf("create request = %+v, expected an autoscaled pool starting at 1 node", create)
+	}
+
+	s.Prune = false
+	if plan, err = s.Plan(ctx, spec); err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	for _, c := range plan.Changes {
+		if c.Type == KubernetesDeletePool {
+			t.Errorf("plan deletes %s without Prune", c.PoolName)
+		}
+	}
+}
+
+func TestKubernetesSpecSync_PlanClear(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_cluster": {"id": "k8s", "name": "prod", "region": "nyc1", "tags": ["k8s", "web"]}}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"node_pools": [
+			{"id": "p1", "name": "workers", "size": "s-2vcpu-4gb", "count": 3, "tags": ["k8s", "frontend"], "labels": {"tier": "web"}}
+		]}`)
+	})
+
+	spec := &KubernetesClusterSpec{
+		Name:      "prod",
+		Region:    "nyc1",
+		NodePools: []KubernetesNodePoolSpec{{Name: "workers", Size: "s-2vcpu-4gb", Count: 3}},
+	}
+	s := &KubernetesSpecSync{Client: client, ClusterID: "k8s"}
+	plan, err := s.Plan(ctx, spec)
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+
+	// Update requests omit empty tags and labels, so an update would never
+	// converge. The clears are reported instead.
+	expected := `conflict tags: [web] -> []: cannot be cleared by an update request
+conflict node_pools[workers].tags: [frontend] -> []: cannot be cleared by an update request
+conflict node_pools[workers].labels: map[tier:web] -> map[]: cannot be cleared by an update request
+`
+	if got := plan.String(); got != expected {
+		t.Errorf("plan =\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestKubernetesSpecSync_Apply(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	record := func(r *http.Request, v interface{}) {
+		if v != nil {
+			json.NewDecoder(r.Body).Decode(v)
+		}
+		calls = append(calls, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/v2/kubernetes/clusters/k8s"))
+	}
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			record(r, nil)
+		}
+		fmt.Fprint(w, `{"kubernetes_cluster": {"id": "k8s", "version": "1.17.9-do.0", "status": {"state": "running"}}}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		record(r, nil)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools", func(w http.ResponseWriter, r *http.Request) {
+		record(r, nil)
+		fmt.Fprint(w, `{"node_pool": {"id": "p4"}}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools/", func(w http.ResponseWriter, r *http.Request) {
+		record(r, nil)
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		fmt.Fprint(w, `{"node_pool": {"id": "p1"}}`)
+	})
+
+	plan := &KubernetesPlan{
+		ClusterID: "k8s",
+		Changes: []KubernetesChange{
+			{Type: KubernetesUpgradeCluster, Upgrade: &godo.KubernetesClusterUpgradeRequest{VersionSlug: "1.17.9-do.0"}},
+			{Type: KubernetesDeletePool, PoolID: "p3", PoolName: "legacy"},
+			{Type: KubernetesUpdatePool, PoolID: "p1", PoolName: "workers", PoolUpdate: &godo.KubernetesNodePoolUpdateRequest{Name: "workers"}},
+			{Type: KubernetesCreatePool, PoolName: "batch", PoolCreate: &godo.KubernetesNodePoolCreateRequest{Name: "batch"}},
+			{Type: KubernetesUpdateCluster, ClusterUpdate: &godo.KubernetesClusterUpdateRequest{SurgeUpgrade: true}},
+		},
+		Conflicts: []KubernetesConflict{{Field: "region", Live: "sfo2", Desired: "nyc1"}},
+	}
+
+	s := &KubernetesSpecSync{Client: client, ClusterID: "k8s"}
+	if err := s.Apply(ctx, plan); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+
+	expected := []string{
+		"PUT ",
+		"POST /node_pools",
+		"PUT /node_pools/p1",
+		"DELETE /node_pools/p3",
+		"POST /upgrade",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("calls = %q, expected %q", calls, expected)
+	}
+}
+
+func TestParseKubernetesClusterSpec_Invalid(t *testing.T) {
+	tests := []string{
+		`region: nyc1`,
+		`{"name": "prod", "region": "nyc1"}`,
+		`{"name": "prod", "region": "nyc1", "node_pools": []}`,
+		`{"name": "prod", "region": "nyc1", "maintenance_policy": {"start_time": "04:00", "day": "someday"}}`,
+		`{"name": "prod", "region": "nyc1", "node_pools": [{"name": "a", "size": "s"}, {"name": "a", "size": "s"}]}`,
+		`{"name": "prod", "region": "nyc1", "node_pools": [{"name": "a", "size": "s", "auto_scale": true, "min_nodes": 3, "max_nodes": 1}]}`,
+		`{"name": "prod", "region": "nyc1", "unknown": true}`,
+	}
+	for _, tt := range tests {
+		if _, err := ParseKubernetesClusterSpec([]byte(tt)); err == nil {
+			t.Errorf("ParseKubernetesClusterSpec(%s) expected error", tt)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+const (
+	// defaultMaintenanceWindow is the length of a maintenance window whose
+	// policy does not state a duration.
+	defaultMaintenanceWindow = 4 * time.Hour
+
+	defaultHopDuration = 30 * time.Minute
+)
+
+// KubernetesUpgradePlan is the sequence of versions a cluster passes through
+// on its way to a target version.
+type KubernetesUpgradePlan struct {
+	ClusterID string
+	From      string
+	To        string
+
+	// Hops are the version slugs to upgrade to, in order.
+	Hops []string
+}
+
+// PlanKubernetesUpgrade computes the upgrade path of a cluster to target,
+// which is a version slug such as "1.18.8-do.0", a patch version such as
+// "1.18.8" or a minor version such as "1.18". A minor version selects its
+// latest patch. Each hop moves at most one minor version, and the first hop
+// is one of the versions returned by Kubernetes.GetUpgrades.
+func PlanKubernetesUpgrade(ctx context.Context, client *godo.Client, clusterID, target string) (*KubernetesUpgradePlan, error) {
+	cluster, _, err := client.Kubernetes.Get(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	upgrades, _, err := client.Kubernetes.GetUpgrades(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	options, _, err := client.Kubernetes.GetOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := parseKubeVersion(cluster.VersionSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	var available []kubeVersion
+	for _, v := range options.Versions {
+		if kv, err := parseKubeVersion(v.Slug); err == nil {
+			available = append(available, kv)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool { return available[i].less(available[j]) })
+
+	to, err := resolveKubeTarget(available, target)
+	if err != nil {
+		return nil, err
+	}
+	if !current.less(to) {
+		return nil, godo.NewArgError("target", fmt.Sprintf("%s is not newer than the current version %s", to.slug, current.slug))
+	}
+
+	var first []kubeVersion
+	for _, v := range upgrades {
+		if kv, err := parseKubeVersion(v.Slug); err == nil {
+			first = append(first, kv)
+		}
+	}
+
+	plan := &KubernetesUpgradePlan{ClusterID: clusterID, From: current.slug, To: to.slug}
+	candidates := first
+	for cur := current; cur.slug != to.slug; {
+		next, ok := nextKubeHop(cur, to, candidates)
+		if !ok {
+			return nil, fmt.Errorf("no upgrade path from %s to %s", cur.slug, to.slug)
+		}
+		plan.Hops = append(plan.Hops, next.slug)
+		cur, candidates = next, available
+	}
+	return plan, nil
+}
+
+// nextKubeHop picks the target itself if it can be reached, and otherwise the
+// newest candidate at most one minor version ahead that does not pass the
+// target.
+func nextKubeHop(cur, to kubeVersion, candidates []kubeVersion) (kubeVersion, bool) {
+	var best kubeVersion
+	found := false
+	for _, c := range candidates {
+		if !cur.less(c) || to.less(c) || c.major != cur.major || c.minor > cur.minor+1 {
+			continue
+		}
+		if c.slug == to.slug {
+			return c, true
+		}
+		if !found || best.less(c) {
+			best, found = c, true
+		}
+	}
+	return best, found
+}
+
+func resolveKubeTarget(available []kubeVersion, target string) (kubeVersion, error) {
+	var match kubeVersion
+	found := false
+	for _, v := range available {
+		if v.slug == target || v.version() == target || fmt.Sprintf("%d.%d", v.major, v.minor) == target {
+			// available is sorted, so the last match is the newest.
+			match, found = v, true
+		}
+	}
+	if !found {
+		return kubeVersion{}, godo.NewArgError("target", fmt.Sprintf("%q is not an available version", target))
+	}
+	return match, nil
+}
+
+// KubernetesUpgradeOptions controls how an upgrade plan is run.
+type KubernetesUpgradeOptions struct {
+	// SurgeUpgrade enables surge upgrades on the cluster before the first
+	// hop.
+	SurgeUpgrade bool
+
+	// MaintenanceWindow only starts hops inside the cluster's maintenance
+	// window, and only if HopDuration fits in what is left of it.
+	MaintenanceWindow bool
+	HopDuration       time.Duration
+
+	// OnHop is called before each hop starts.
+	OnHop func(version string)
+}
+
+// KubernetesUpgradeError is returned when a hop leaves the cluster in a state
+// other than running.
+type KubernetesUpgradeError struct {
+	Version string
+	State   godo.KubernetesClusterStatusState
+	Message string
+}
+
+func (e *KubernetesUpgradeError) Error() string {
+	return fmt.Sprintf("upgrade to %s left the cluster %s: %s", e.Version, e.State, e.Message)
+}
+
+// RunKubernetesUpgrade upgrades a cluster along a plan, waiting for it to be
+// running on each version before starting the next hop. It stops at the
+// first hop that leaves the cluster degraded or in error.
+func RunKubernetesUpgrade(ctx context.Context, client *godo.Client, plan *KubernetesUpgradePlan, opts *KubernetesUpgradeOptions) error {
+	if plan == nil {
+		return godo.NewArgError("plan", "cannot be nil")
+	}
+	if opts == nil {
+		opts = &KubernetesUpgradeOptions{}
+	}
+
+	if opts.SurgeUpgrade {
+		// The update request requires the cluster's name.
+		cluster, _, err := client.Kubernetes.Get(ctx, plan.ClusterID)
+		if err != nil {
+			return err
+		}
+		_, _, err = client.Kubernetes.Update(ctx, plan.ClusterID, &godo.KubernetesClusterUpdateRequest{Name: cluster.Name, SurgeUpgrade: true})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, hop := range plan.Hops {
+		if opts.MaintenanceWindow {
+			if err := waitForMaintenanceWindow(ctx, client, plan.ClusterID, opts.HopDuration); err != nil {
+				return err
+			}
+		}
+		if opts.OnHop != nil {
+			opts.OnHop(hop)
+		}
+
+		if _, err := client.Kubernetes.Upgrade(ctx, plan.ClusterID, &godo.KubernetesClusterUpgradeRequest{VersionSlug: hop}); err != nil {
+			return fmt.Errorf("upgrade to %s: %v", hop, err)
+		}
+		if err := waitForKubernetesVersion(ctx, client, plan.ClusterID, hop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForKubernetesVersion polls a cluster until it is running the given
+// version.
+func waitForKubernetesVersion(ctx context.Context, client *godo.Client, clusterID, version string) error {
+	for {
+		cluster, _, err := client.Kubernetes.Get(ctx, clusterID)
+		if err != nil {
+			return err
+		}
+
+		var state godo.KubernetesClusterStatusState
+		var message string
+		if cluster.Status != nil {
+			state, message = cluster.Status.State, cluster.Status.Message
+		}
+		switch state {
+		case godo.KubernetesClusterStatusDegraded, godo.KubernetesClusterStatusError:
+			return &KubernetesUpgradeError{Version: version, State: state, Message: message}
+		case godo.KubernetesClusterStatusRunning:
+			if cluster.VersionSlug == version {
+				return nil
+			}
+		}
+
+		if err := sleep(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func waitForMaintenanceWindow(ctx context.Context, client *godo.Client, clusterID string, hop time.Duration) error {
+	cluster, _, err := client.Kubernetes.Get(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	if cluster.MaintenancePolicy == nil {
+		return fmt.Errorf("cluster %s has no maintenance policy", clusterID)
+	}
+	if hop == 0 {
+		hop = defaultHopDuration
+	}
+
+	start, err := nextMaintenanceSlot(cluster.MaintenancePolicy, hop, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	select {
+	case <-time.After(time.Until(start)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nextMaintenanceSlot returns the earliest time at or after now that lies
+// inside a maintenance window with at least hop left in it.
+func nextMaintenanceSlot(policy *godo.KubernetesMaintenancePolicy, hop time.Duration, now time.Time) (time.Time, error) {
+	start, err := time.Parse("15:04", policy.StartTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("maintenance start time %q: %v", policy.StartTime, err)
+	}
+	length := defaultMaintenanceWindow
+	if policy.Duration != "" {
+		if length, err = time.ParseDuration(policy.Duration); err != nil {
+			return time.Time{}, fmt.Errorf("maintenance duration %q: %v", policy.Duration, err)
+		}
+	}
+	if hop > length {
+		return time.Time{}, fmt.Errorf("a hop of %s does not fit in a maintenance window of %s", hop, length)
+	}
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), start.Hour(), start.Minute(), 0, 0, time.UTC)
+	for d := -1; d <= 7; d++ {
+		open := day.AddDate(0, 0, d)
+		if !maintenanceDay(policy.Day, open.Weekday()) {
+			continue
+		}
+		latest := open.Add(length - hop)
+		if now.After(latest) {
+			continue
+		}
+		if now.After(open) {
+			return now, nil
+		}
+		return open, nil
+	}
+	return time.Time{}, fmt.Errorf("no maintenance window found")
+}
+
+func maintenanceDay(day godo.KubernetesMaintenancePolicyDay, weekday time.Weekday) bool {
+	if day == godo.KubernetesMaintenanceDayAny {
+		return true
+	}
+	// The policy days run from Monday (1) to Sunday (7).
+	return int(day)%7 == int(weekday)
+}
+
+// kubeVersion is a parsed version slug such as "1.18.8-do.0".
+type kubeVersion struct {
+	slug                     string
+	major, minor, patch, rev int
+}
+
+func parseKubeVersion(slug string) (kubeVersion, error) {
+	v := kubeVersion{slug: slug}
+	version, rev := slug, "0"
+	if i := strings.Index(slug, "-do."); i >= 0 {
+		version, rev = slug[:i], slug[i+len("-do."):]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version slug %q", slug)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return v, fmt.Errorf("invalid version slug %q", slug)
+		}
+		*nums[i] = n
+	}
+	n, err := strconv.Atoi(rev)
+	if err != nil {
+		return v, fmt.Errorf("invalid version slug %q", slug)
+	}
+	v.rev = n
+	return v, nil
+}
+
+func (v kubeVersion) version() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+func (v kubeVersion) less(o kubeVersion) bool {
+	a := []int{v.major, v.minor, v.patch, v.rev}
+	b := []int{o.major, o.minor, o.patch, o.rev}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
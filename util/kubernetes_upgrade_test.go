@@ -0,0 +1,183 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+func handleKubernetesVersions(t *testing.T) {
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/upgrades", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"available_upgrade_versions": [
+			{"slug": "1.16.10-do.0", "kubernetes_version": "1.16.10"},
+			{"slug": "1.17.5-do.0", "kubernetes_version": "1.17.5"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/options", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"options": {"versions": [
+			{"slug": "1.19.3-do.0"},
+			{"slug": "1.18.8-do.1"},
+			{"slug": "1.18.8-do.0"},
+			{"slug": "1.18.3-do.0"},
+			{"slug": "1.17.9-do.0"},
+			{"slug": "1.17.5-do.0"},
+			{"slug": "1.16.10-do.0"}
+		]}}`)
+	})
+}
+
+func TestPlanKubernetesUpgrade(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleKubernetesVersions(t)
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_cluster": {"id": "k8s", "version": "1.16.8-do.0"}}`)
+	})
+
+	tests := []struct {
+		target string
+		hops   []string
+	}{
+		{"1.18", []string{"1.17.5-do.0", "1.18.8-do.1"}},
+		{"1.18.3", []string{"1.17.5-do.0", "1.18.3-do.0"}},
+		{"1.19.3-do.0", []string{"1.17.5-do.0", "1.18.8-do.1", "1.19.3-do.0"}},
+		{"1.16", []string{"1.16.10-do.0"}},
+	}
+	for _, tt := range tests {
+		plan, err := PlanKubernetesUpgrade(ctx, client, "k8s", tt.target)
+		if err != nil {
+			t.Errorf("PlanKubernetesUpgrade(%q) returned error: %v", tt.target, err)
+			continue
+		}
+		if !reflect.DeepEqual(plan.Hops, tt.hops) {
+			t.Errorf("PlanKubernetesUpgrade(%q) hops = %v, expected %v", tt.target, plan.Hops, tt.hops)
+		}
+	}
+
+	if _, err := PlanKubernetesUpgrade(ctx, client, "k8s", "1.20"); err == nil {
+		t.Error("expected error for an unavailable version")
+	}
+}
+
+func TestRunKubernetesUpgrade(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The cluster reports each version as upgrading once before running.
+	version, polls := "1.16.8-do.0", 0
+	var calls []string
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			v := new(godo.KubernetesClusterUpdateRequest)
+			json.NewDecoder(r.Body).Decode(v)
+			calls = append(calls, fmt.Sprintf("update name=%s surge=%v", v.Name, v.SurgeUpgrade))
+			fmt.Fprint(w, `{"kubernetes_cluster": {"id": "k8s"}}`)
+		case http.MethodGet:
+			polls++
+			state := "running"
+			if polls == 1 {
+				state = "upgrading"
+			}
+			fmt.Fprintf(w, `{"kubernetes_cluster": {"id": "k8s", "name": "prod", "version": %q, "status": {"state": %q}}}`, version, state)
+		}
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		v := new(godo.KubernetesClusterUpgradeRequest)
+		json.NewDecoder(r.Body).Decode(v)
+		calls = append(calls, "upgrade "+v.VersionSlug)
+		version, polls = v.VersionSlug, 0
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	var started []string
+	plan := &KubernetesUpgradePlan{ClusterID: "k8s", Hops: []string{"1.17.5-do.0", "1.18.8-do.1"}}
+	err := RunKubernetesUpgrade(ctx, client, plan, &KubernetesUpgradeOptions{
+		SurgeUpgrade: true,
+		OnHop:        func(v string) { started = append(started, v) },
+	})
+	if err != nil {
+		t.Fatalf("RunKubernetesUpgrade returned error: %v", err)
+	}
+
+	expected := []string{"update name=prod surge=true", "upgrade 1.17.5-do.0", "upgrade 1.18.8-do.1"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("calls = %v, expected %v", calls, expected)
+	}
+	if !reflect.DeepEqual(started, plan.Hops) {
+		t.Errorf("OnHop saw %v, expected %v", started, plan.Hops)
+	}
+}
+
+func TestRunKubernetesUpgrade_Degraded(t *testing.T) {
+	setup()
+	defer teardown()
+
+	upgrades := 0
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"kubernetes_cluster": {"id": "k8s", "version": "1.17.5-do.0",
+			"status": {"state": "degraded", "message": "node pool unhealthy"}}}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		upgrades++
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	plan := &KubernetesUpgradePlan{ClusterID: "k8s", Hops: []string{"1.17.5-do.0", "1.18.8-do.1"}}
+	err := RunKubernetesUpgrade(ctx, client, plan, nil)
+	e, ok := err.(*KubernetesUpgradeError)
+	if !ok || e.Version != "1.17.5-do.0" || e.State != godo.KubernetesClusterStatusDegraded {
+		t.Fatalf("expected KubernetesUpgradeError for the first hop, got %v", err)
+	}
+	if upgrades != 1 {
+		t.Errorf("%d upgrades were started, expected 1", upgrades)
+	}
+}
+
+func TestNextMaintenanceSlot(t *testing.T) {
+	monday := &godo.KubernetesMaintenancePolicy{StartTime: "00:00", Day: godo.KubernetesMaintenanceDayMonday}
+	daily := &godo.KubernetesMaintenancePolicy{StartTime: "22:00", Duration: "4h0m0s", Day: godo.KubernetesMaintenanceDayAny}
+
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		policy   *godo.KubernetesMaintenancePolicy
+		now      string
+		expected string
+	}{
+		{monday, "2020-10-18T12:00:00Z", "2020-10-19T00:00:00Z"},
+		{monday, "2020-10-19T01:00:00Z", "2020-10-19T01:00:00Z"},
+		{monday, "2020-10-19T03:45:00Z", "2020-10-26T00:00:00Z"},
+		{daily, "2020-10-20T01:00:00Z", "2020-10-20T01:00:00Z"},
+		{daily, "2020-10-20T12:00:00Z", "2020-10-20T22:00:00Z"},
+	}
+	for _, tt := range tests {
+		slot, err := nextMaintenanceSlot(tt.policy, 30*time.Minute, at(tt.now))
+		if err != nil {
+			t.Errorf("nextMaintenanceSlot(%s) returned error: %v", tt.now, err)
+			continue
+		}
+		if !slot.Equal(at(tt.expected)) {
+			t.Errorf("nextMaintenanceSlot(%s) = %s, expected %s", tt.now, slot.Format(time.RFC3339), tt.expected)
+		}
+	}
+
+	if _, err := nextMaintenanceSlot(monday, 5*time.Hour, at("2020-10-19T00:00:00Z")); err == nil {
+		t.Error("expected error for a hop longer than the window")
+	}
+}
@@ -0,0 +1,284 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+const defaultRotationTimeout = 5 * time.Minute
+
+// HealthProber checks whether a backend passes a load balancer health check.
+type HealthProber interface {
+	Probe(ctx context.Context, address string, check *godo.HealthCheck) error
+}
+
+// HTTPHealthProber probes backends the way the load balancer does: an HTTP
+// or HTTPS GET of the check path expecting a 2xx or 3xx response, or a TCP
+// connection.
+type HTTPHealthProber struct {
+	HTTPClient *http.Client
+
+	// TLSConfig is used for https probes when HTTPClient is nil. Backends
+	// are probed by IP address, so certificate verification fails unless
+	// it sets ServerName to a name the certificate covers, or sets
+	// InsecureSkipVerify.
+	TLSConfig *tls.Config
+}
+
+// Probe implements HealthProber.
+func (p *HTTPHealthProber) Probe(ctx context.Context, address string, check *godo.HealthCheck) error {
+	timeout := time.Duration(check.ResponseTimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	hostPort := net.JoinHostPort(address, strconv.Itoa(check.Port))
+
+	switch check.Protocol {
+	case "tcp":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", hostPort)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http", "https":
+		client := p.HTTPClient
+		if client == nil {
+			client = http.DefaultClient
+			if check.Protocol == "https" && p.TLSConfig != nil {
+				transport := &http.Transport{TLSClientConfig: p.TLSConfig}
+				defer transport.CloseIdleConnections()
+				client = &http.Client{Transport: transport}
+			}
+		}
+		url := fmt.Sprintf("%s://%s%s", check.Protocol, hostPort, check.Path)
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := godo.DoRequestWithClient(ctx, client, req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported health check protocol %q", check.Protocol)
+	}
+}
+
+// LBRotation replaces the droplets behind a load balancer with a new set. The
+// new droplets are added and probed with the load balancer's health check
+// against their private addresses. Once all are healthy the old droplets
+// keep serving alongside them for DrainPeriod, and are then removed. If the
+// new droplets do not become healthy within HealthyTimeout they are removed
+// again and the old set is left in place.
+//
+// Load balancers that select droplets by tag are rotated by tagging the new
+// droplets and untagging the old ones.
+type LBRotation struct {
+	Client         *godo.Client
+	LoadBalancerID string
+	NewDropletIDs  []int
+
+	// OldDropletIDs are the droplets to remove. When empty, all current
+	// members of the load balancer other than the new droplets are removed.
+	OldDropletIDs []int
+
+	// Prober defaults to an HTTPHealthProber.
+	Prober HealthProber
+
+	// ProbeInterval defaults to the health check's interval.
+	ProbeInterval  time.Duration
+	HealthyTimeout time.Duration
+	DrainPeriod    time.Duration
+}
+
+// LBRotationResult describes a rotation.
+type LBRotationResult struct {
+	Added   []int
+	Removed []int
+
+	// RolledBack is set when the new droplets were removed again because
+	// they did not become healthy.
+	RolledBack bool
+}
+
+// UnhealthyBackendError is returned when new droplets did not pass the
+// health check in time.
+type UnhealthyBackendError struct {
+	DropletID int
+	Err       error
+}
+
+func (e *UnhealthyBackendError) Error() string {
+	return fmt.Sprintf("droplet %d did not become healthy: %v", e.DropletID, e.Err)
+}
+
+// Run performs the rotation.
+func (r *LBRotation) Run(ctx context.Context) (*LBRotationResult, error) {
+	if r.LoadBalancerID == "" {
+		return nil, godo.NewArgError("LoadBalancerID", "cannot be empty")
+	}
+	if len(r.NewDropletIDs) == 0 {
+		return nil, godo.NewArgError("NewDropletIDs", "cannot be empty")
+	}
+
+	lb, _, err := r.Client.LoadBalancers.Get(ctx, r.LoadBalancerID)
+	if err != nil {
+		return nil, err
+	}
+
+	check := lb.HealthCheck
+	if check == nil {
+		check = &godo.HealthCheck{Protocol: "tcp", Port: 80}
+	}
+
+	old := r.OldDropletIDs
+	if len(old) == 0 {
+		members := lb.DropletIDs
+		if lb.Tag != "" {
+			tagged, err := listDropletsByTag(ctx, r.Client, lb.Tag)
+			if err != nil {
+				return nil, err
+			}
+			members = nil
+			for _, d := range tagged {
+				members = append(members, d.ID)
+			}
+		}
+		_, old = diffInts(members, r.NewDropletIDs)
+	}
+
+	result := &LBRotationResult{}
+	if err := r.attach(ctx, lb, r.NewDropletIDs); err != nil {
+		return result, err
+	}
+	result.Added = r.NewDropletIDs
+
+	if err := r.waitHealthy(ctx, check); err != nil {
+		if rbErr := r.detach(ctx, lb, r.NewDropletIDs); rbErr != nil {
+			return result, fmt.Errorf("%v; rollback failed: %v", err, rbErr)
+		}
+		result.RolledBack = true
+		return result, err
+	}
+
+	if len(old) == 0 {
+		return result, nil
+	}
+
+	if r.DrainPeriod > 0 {
+		select {
+		case <-time.After(r.DrainPeriod):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+
+	if err := r.detach(ctx, lb, old); err != nil {
+		return result, err
+	}
+	result.Removed = old
+	return result, nil
+}
+
+func (r *LBRotation) attach(ctx context.Context, lb *godo.LoadBalancer, dropletIDs []int) error {
+	if lb.Tag == "" {
+		_, err := r.Client.LoadBalancers.AddDroplets(ctx, lb.ID, dropletIDs...)
+		return err
+	}
+	_, err := r.Client.Tags.TagResources(ctx, lb.Tag, &godo.TagResourcesRequest{Resources: dropletResources(dropletIDs)})
+	return err
+}
+
+func (r *LBRotation) detach(ctx context.Context, lb *godo.LoadBalancer, dropletIDs []int) error {
+	if lb.Tag == "" {
+		_, err := r.Client.LoadBalancers.RemoveDroplets(ctx, lb.ID, dropletIDs...)
+		return err
+	}
+	_, err := r.Client.Tags.UntagResources(ctx, lb.Tag, &godo.UntagResourcesRequest{Resources: dropletResources(dropletIDs)})
+	return err
+}
+
+// waitHealthy probes each new droplet until it passes the health check the
+// check's healthy threshold number of times in a row.
+func (r *LBRotation) waitHealthy(ctx context.Context, check *godo.HealthCheck) error {
+	prober := r.Prober
+	if prober == nil {
+		prober = &HTTPHealthProber{}
+	}
+	interval := r.ProbeInterval
+	if interval == 0 {
+		interval = time.Duration(check.CheckIntervalSeconds) * time.Second
+	}
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	threshold := check.HealthyThreshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	timeout := r.HealthyTimeout
+	if timeout == 0 {
+		timeout = defaultRotationTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, id := range r.NewDropletIDs {
+		droplet, _, err := r.Client.Droplets.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		addr, err := droplet.PrivateIPv4()
+		if err != nil || addr == "" {
+			return &UnhealthyBackendError{DropletID: id, Err: fmt.Errorf("no private address")}
+		}
+
+		passed := 0
+		var lastErr error
+		for passed < threshold {
+			if lastErr = prober.Probe(ctx, addr, check); lastErr == nil {
+				passed++
+				if passed == threshold {
+					break
+				}
+			} else {
+				passed = 0
+			}
+
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				if lastErr == nil {
+					lastErr = ctx.Err()
+				}
+				return &UnhealthyBackendError{DropletID: id, Err: lastErr}
+			}
+		}
+	}
+	return nil
+}
+
+func dropletResources(dropletIDs []int) []godo.Resource {
+	resources := make([]godo.Resource, 0, len(dropletIDs))
+	for _, id := range dropletIDs {
+		resources = append(resources, godo.Resource{ID: strconv.Itoa(id), Type: godo.DropletResourceType})
+	}
+	return resources
+}
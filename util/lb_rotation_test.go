@@ -0,0 +1,219 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+type fakeProber struct {
+	mu      sync.Mutex
+	healthy map[string]bool
+	probes  map[string]int
+}
+
+func (p *fakeProber) Probe(ctx context.Context, address string, check *godo.HealthCheck) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.probes == nil {
+		p.probes = make(map[string]int)
+	}
+	p.probes[address]++
+	if !p.healthy[address] {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func handleRotationDroplets(t *testing.T) {
+	for id := 3; id <= 4; id++ {
+		id := id
+		mux.HandleFunc(fmt.Sprintf("/v2/droplets/%d", id), func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, http.MethodGet)
+			fmt.Fprintf(w, `{"droplet": {"id": %d, "networks": {"v4": [
+				{"ip_address": "192.0.2.%d", "type": "public"},
+				{"ip_address": "10.0.0.%d", "type": "private"}
+			]}}}`, id, id, id)
+		})
+	}
+}
+
+func recordBodies(t *testing.T, calls *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*calls = append(*calls, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestLBRotation(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	mux.HandleFunc("/v2/load_balancers/lb", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"load_balancer": {"id": "lb", "droplet_ids": [1, 2],
+			"health_check": {"protocol": "http", "port": 80, "path": "/", "healthy_threshold": 2}}}`)
+	})
+	mux.HandleFunc("/v2/load_balancers/lb/droplets", recordBodies(t, &calls))
+	handleRotationDroplets(t)
+
+	prober := &fakeProber{healthy: map[string]bool{"10.0.0.3": true, "10.0.0.4": true}}
+	rotation := &LBRotation{
+		Client:         client,
+		LoadBalancerID: "lb",
+		NewDropletIDs:  []int{3, 4},
+		Prober:         prober,
+		ProbeInterval:  time.Millisecond,
+		DrainPeriod:    time.Millisecond,
+	}
+
+	result, err := rotation.Run(ctx)
+	if err != nil {
+		t.Fatalf("LBRotation.Run returned error: %v", err)
+	}
+
+	expectedCalls := []string{
+		`POST /v2/load_balancers/lb/droplets {"droplet_ids":[3,4]}`,
+		`DELETE /v2/load_balancers/lb/droplets {"droplet_ids":[1,2]}`,
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("calls = %q, expected %q", calls, expectedCalls)
+	}
+	expected := &LBRotationResult{Added: []int{3, 4}, Removed: []int{1, 2}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("LBRotation.Run returned %+v, expected %+v", result, expected)
+	}
+	if prober.probes["10.0.0.3"] != 2 || prober.probes["10.0.0.4"] != 2 {
+		t.Errorf("probes = %v, expected 2 per droplet", prober.probes)
+	}
+}
+
+func TestLBRotation_RollBack(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	mux.HandleFunc("/v2/load_balancers/lb", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"load_balancer": {"id": "lb", "droplet_ids": [1, 2],
+			"health_check": {"protocol": "tcp", "port": 80}}}`)
+	})
+	mux.HandleFunc("/v2/load_balancers/lb/droplets", recordBodies(t, &calls))
+	handleRotationDroplets(t)
+
+	rotation := &LBRotation{
+		Client:         client,
+		LoadBalancerID: "lb",
+		NewDropletIDs:  []int{3, 4},
+		Prober:         &fakeProber{healthy: map[string]bool{"10.0.0.3": true}},
+		ProbeInterval:  time.Millisecond,
+		HealthyTimeout: 20 * time.Millisecond,
+	}
+
+	result, err := rotation.Run(ctx)
+	if e, ok := err.(*UnhealthyBackendError); !ok || e.DropletID != 4 {
+		t.Fatalf("expected *UnhealthyBackendError for droplet 4, got %v", err)
+	}
+	if !result.RolledBack {
+		t.Error("expected rotation to be rolled back")
+	}
+
+	expectedCalls := []string{
+		`POST /v2/load_balancers/lb/droplets {"droplet_ids":[3,4]}`,
+		`DELETE /v2/load_balancers/lb/droplets {"droplet_ids":[3,4]}`,
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("calls = %q, expected %q", calls, expectedCalls)
+	}
+}
+
+func TestLBRotation_Tagged(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var calls []string
+	mux.HandleFunc("/v2/load_balancers/lb", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"load_balancer": {"id": "lb", "tag": "web", "droplet_ids": [1],
+			"health_check": {"protocol": "tcp", "port": 80}}}`)
+	})
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		if tag := r.URL.Query().Get("tag_name"); tag != "web" {
+			t.Errorf("tag_name = %q, expected web", tag)
+		}
+		fmt.Fprint(w, `{"droplets": [{"id": 1}, {"id": 2}]}`)
+	})
+	mux.HandleFunc("/v2/tags/web/resources", func(w http.ResponseWriter, r *http.Request) {
+		v := new(godo.TagResourcesRequest)
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, res := range v.Resources {
+			ids = append(ids, res.ID)
+		}
+		calls = append(calls, r.Method+" "+strings.Join(ids, ","))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handleRotationDroplets(t)
+
+	rotation := &LBRotation{
+		Client:         client,
+		LoadBalancerID: "lb",
+		NewDropletIDs:  []int{3},
+		Prober:         &fakeProber{healthy: map[string]bool{"10.0.0.3": true}},
+		ProbeInterval:  time.Millisecond,
+	}
+
+	result, err := rotation.Run(ctx)
+	if err != nil {
+		t.Fatalf("LBRotation.Run returned error: %v", err)
+	}
+
+	expectedCalls := []string{"POST 3", "DELETE 1,2"}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("calls = %q, expected %q", calls, expectedCalls)
+	}
+	if !reflect.DeepEqual(result.Removed, []int{1, 2}) {
+		t.Errorf("removed = %v, expected [1 2]", result.Removed)
+	}
+}
+
+func TestHTTPHealthProber_HTTPS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	check := &godo.HealthCheck{Protocol: "https", Port: p, Path: "/healthz", ResponseTimeoutSeconds: 1}
+
+	if err := (&HTTPHealthProber{}).Probe(ctx, host, check); err == nil {
+		t.Error("expected the certificate check to fail without a TLS config")
+	}
+
+	prober := &HTTPHealthProber{TLSConfig: &tls.Config{InsecureSkipVerify: true}}
+	if err := prober.Probe(ctx, host, check); err != nil {
+		t.Errorf("Probe returned error: %v", err)
+	}
+}
@@ -0,0 +1,482 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+const (
+	defaultSampleInterval = 5 * time.Minute
+	defaultAdviceHeadroom = 0.2
+	defaultIdleThreshold  = 0.75
+
+	// minAdviceSamples is the number of samples a pool needs before it is
+	// advised on.
+	minAdviceSamples = 2
+)
+
+// NodePoolSample is the size of a node pool at one point in time.
+type NodePoolSample struct {
+	Time      time.Time `json:"time"`
+	ClusterID string    `json:"cluster_id"`
+	PoolID    string    `json:"pool_id"`
+	PoolName  string    `json:"pool_name"`
+	Size      string    `json:"size"`
+
+	// Count is the number of nodes the pool asks for.
+	Count int `json:"count"`
+
+	AutoScale bool `json:"auto_scale,omitempty"`
+	MinNodes  int  `json:"min_nodes,omitempty"`
+	MaxNodes  int  `json:"max_nodes,omitempty"`
+}
+
+// NodePoolSampleStore keeps the samples taken by a NodePoolAdvisor.
+type NodePoolSampleStore interface {
+	Add(samples ...NodePoolSample) error
+
+	// Samples returns the samples of a cluster taken at or after since,
+	// oldest first.
+	Samples(clusterID string, since time.Time) ([]NodePoolSample, error)
+}
+
+// MemorySampleStore keeps samples in memory.
+type MemorySampleStore struct {
+	mu      sync.Mutex
+	samples []NodePoolSample
+}
+
+// Add implements NodePoolSampleStore.
+func (s *MemorySampleStore) Add(samples ...NodePoolSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, samples...)
+	return nil
+}
+
+// Samples implements NodePoolSampleStore.
+func (s *MemorySampleStore) Samples(clusterID string, since time.Time) ([]NodePoolSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return filterSamples(s.samples, clusterID, since), nil
+}
+
+// FileSampleStore appends samples to a file as one JSON object per line.
+type FileSampleStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Add implements NodePoolSampleStore.
+func (s *FileSampleStore) Add(samples ...NodePoolSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, sample := range samples {
+		if err := enc.Encode(sample); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Samples implements NodePoolSampleStore. A missing file holds no samples.
+func (s *FileSampleStore) Samples(clusterID string, since time.Time) ([]NodePoolSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []NodePoolSample
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var sample NodePoolSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", s.Path, line, err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return filterSamples(samples, clusterID, since), nil
+}
+
+func filterSamples(samples []NodePoolSample, clusterID string, since time.Time) []NodePoolSample {
+	var out []NodePoolSample
+	for _, s := range samples {
+		if s.ClusterID == clusterID && !s.Time.Before(since) {
+			out = append(out, s)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+// NodePoolSuggestion is one change suggested for a node pool. The monthly
+// cost changes are at the average observed demand and at the floor and
+// ceiling of the pool.
+type NodePoolSuggestion struct {
+	Reason           string
+	MonthlyChange    float64
+	MinMonthlyChange float64
+	MaxMonthlyChange float64
+}
+
+// NodePoolAdvice suggests autoscale bounds and a node size for a pool.
+type NodePoolAdvice struct {
+	PoolID   string
+	PoolName string
+	Samples  int
+
+	// Low and Peak are the smallest and largest node counts observed, and
+	// IdleFraction the share of samples whose count was below the middle
+	// of that range. It is zero for pools whose count never changed.
+	Low          int
+	Peak         int
+	IdleFraction float64
+
+	CurrentSize      string
+	CurrentCount     int
+	CurrentMinNodes  int
+	CurrentMaxNodes  int
+	CurrentAutoScale bool
+
+	Size     string
+	MinNodes int
+	MaxNodes int
+
+	// CurrentMonthly and SuggestedMonthly are priced at the average
+	// observed demand. The Min and Max costs are priced at MinNodes and
+	// MaxNodes, or at the count of a pool that does not autoscale.
+	CurrentMonthly      float64
+	CurrentMinMonthly   float64
+	CurrentMaxMonthly   float64
+	SuggestedMonthly    float64
+	SuggestedMinMonthly float64
+	SuggestedMaxMonthly float64
+	MonthlyChange       float64
+
+	Suggestions []NodePoolSuggestion
+}
+
+func (a *NodePoolAdvice) suggest(reason string, monthly, min, max float64) {
+	a.Suggestions = append(a.Suggestions, NodePoolSuggestion{
+		Reason:           reason,
+		MonthlyChange:    monthly,
+		MinMonthlyChange: min,
+		MaxMonthlyChange: max,
+	})
+}
+
+// UpdateRequest returns the request that applies the suggested autoscale
+// bounds, keeping the current count within them. A different Size cannot be
+// applied in place; it needs a new node pool.
+func (a *NodePoolAdvice) UpdateRequest() *godo.KubernetesNodePoolUpdateRequest {
+	count := a.CurrentCount
+	if count < a.MinNodes {
+		count = a.MinNodes
+	}
+	if count > a.MaxNodes {
+		count = a.MaxNodes
+	}
+	return &godo.KubernetesNodePoolUpdateRequest{
+		Name:      a.PoolName,
+		Count:     godo.Int(count),
+		AutoScale: godo.Bool(true),
+		MinNodes:  godo.Int(a.MinNodes),
+		MaxNodes:  godo.Int(a.MaxNodes),
+	}
+}
+
+// NodePoolAdvisor samples the node pools of a cluster into a store and
+// suggests autoscale bounds and node sizes from the history. Only the node
+// counts are sampled, so idleness is measured from the swings of the
+// autoscaler; a fixed-size pool is never considered idle.
+type NodePoolAdvisor struct {
+	Client    *godo.Client
+	ClusterID string
+	Store     NodePoolSampleStore
+
+	// Interval between samples taken by Run. It defaults to 5 minutes.
+	Interval time.Duration
+
+	// Headroom is the fraction added on top of the observed peak for the
+	// suggested MaxNodes. It defaults to 0.2.
+	Headroom float64
+
+	// IdleThreshold is the IdleFraction above which a smaller node size is
+	// considered. It defaults to 0.75.
+	IdleThreshold float64
+}
+
+// Sample records the current size of every node pool of the cluster.
+func (a *NodePoolAdvisor) Sample(ctx context.Context) error {
+	if a.ClusterID == "" {
+		return godo.NewArgError("ClusterID", "cannot be empty")
+	}
+	if a.Store == nil {
+		return godo.NewArgError("Store", "cannot be nil")
+	}
+
+	pools, err := listNodePools(ctx, a.Client, a.ClusterID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	samples := make([]NodePoolSample, 0, len(pools))
+	for _, p := range pools {
+		samples = append(samples, NodePoolSample{
+			Time:      now,
+			ClusterID: a.ClusterID,
+			PoolID:    p.ID,
+			PoolName:  p.Name,
+			Size:      p.Size,
+			Count:     p.Count,
+			AutoScale: p.AutoScale,
+			MinNodes:  p.MinNodes,
+			MaxNodes:  p.MaxNodes,
+		})
+	}
+	return a.Store.Add(samples...)
+}
+
+// Run calls Sample every Interval until the context is done.
+func (a *NodePoolAdvisor) Run(ctx context.Context) error {
+	interval := a.Interval
+	if interval == 0 {
+		interval = defaultSampleInterval
+	}
+	for {
+		if err := a.Sample(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Advise suggests bounds and sizes for every pool with enough samples taken
+// at or after since. Costs use the prices returned by Sizes.List.
+func (a *NodePoolAdvisor) Advise(ctx context.Context, since time.Time) ([]NodePoolAdvice, error) {
+	if a.Store == nil {
+		return nil, godo.NewArgError("Store", "cannot be nil")
+	}
+	samples, err := a.Store.Samples(a.ClusterID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, err := listSizes(ctx, a.Client)
+	if err != nil {
+		return nil, err
+	}
+	bySlug := make(map[string]godo.Size, len(sizes))
+	for _, s := range sizes {
+		bySlug[s.Slug] = s
+	}
+
+	var order []string
+	byPool := make(map[string][]NodePoolSample)
+	for _, s := range samples {
+		if _, ok := byPool[s.PoolID]; !ok {
+			order = append(order, s.PoolID)
+		}
+		byPool[s.PoolID] = append(byPool[s.PoolID], s)
+	}
+
+	var advice []NodePoolAdvice
+	for _, id := range order {
+		if len(byPool[id]) < minAdviceSamples {
+			continue
+		}
+		adv, err := a.advise(byPool[id], bySlug, sizes)
+		if err != nil {
+			return nil, err
+		}
+		advice = append(advice, *adv)
+	}
+	return advice, nil
+}
+
+func (a *NodePoolAdvisor) advise(samples []NodePoolSample, bySlug map[string]godo.Size, sizes []godo.Size) (*NodePoolAdvice, error) {
+	headroom := a.Headroom
+	if headroom == 0 {
+		headroom = defaultAdviceHeadroom
+	}
+	idleThreshold := a.IdleThreshold
+	if idleThreshold == 0 {
+		idleThreshold = defaultIdleThreshold
+	}
+
+	last := samples[len(samples)-1]
+	current, ok := bySlug[last.Size]
+	if !ok {
+		return nil, fmt.Errorf("node pool %s: unknown size %q", last.PoolName, last.Size)
+	}
+
+	adv := &NodePoolAdvice{
+		PoolID:           last.PoolID,
+		PoolName:         last.PoolName,
+		Samples:          len(samples),
+		Low:              samples[0].Count,
+		CurrentSize:      last.Size,
+		CurrentCount:     last.Count,
+		CurrentMinNodes:  last.MinNodes,
+		CurrentMaxNodes:  last.MaxNodes,
+		CurrentAutoScale: last.AutoScale,
+	}
+	saturated := 0
+	for _, s := range samples {
+		if s.Count < adv.Low {
+			adv.Low = s.Count
+		}
+		if s.Count > adv.Peak {
+			adv.Peak = s.Count
+		}
+		if s.AutoScale && s.Count >= s.MaxNodes {
+			saturated++
+		}
+	}
+	// A pool that never scaled says nothing about how idle it is.
+	if adv.Peak > adv.Low {
+		middle := float64(adv.Low+adv.Peak) / 2
+		idle := 0
+		for _, s := range samples {
+			if float64(s.Count) < middle {
+				idle++
+			}
+		}
+		adv.IdleFraction = float64(idle) / float64(len(samples))
+	}
+
+	// Pick the cheapest size of the same family that serves the average
+	// demand, looking at smaller sizes for mostly idle pools and larger
+	// ones for pools that keep hitting their maximum.
+	adv.Size = current.Slug
+	adv.CurrentMonthly = averageNodes(samples, 1) * monthlyPrice(current)
+	adv.SuggestedMonthly = adv.CurrentMonthly
+	if adv.IdleFraction >= idleThreshold || saturated > 0 {
+		for _, s := range sizes {
+			if !s.Available || sizeFamily(s.Slug) != sizeFamily(current.Slug) || s.Slug == current.Slug {
+				continue
+			}
+			smaller := s.Vcpus <= current.Vcpus && s.Memory <= current.Memory
+			if smaller != (saturated == 0) {
+				continue
+			}
+			monthly := averageNodes(samples, nodeRatio(current, s)) * monthlyPrice(s)
+			if monthly < adv.SuggestedMonthly {
+				adv.Size, adv.SuggestedMonthly = s.Slug, monthly
+			}
+		}
+	}
+
+	suggested := bySlug[adv.Size]
+	ratio := nodeRatio(current, suggested)
+	currentPrice, suggestedPrice := monthlyPrice(current), monthlyPrice(suggested)
+
+	floor, ceiling := last.Count, last.Count
+	if last.AutoScale {
+		floor, ceiling = last.MinNodes, last.MaxNodes
+	}
+	adv.CurrentMinMonthly = float64(floor) * currentPrice
+	adv.CurrentMaxMonthly = float64(ceiling) * currentPrice
+
+	// The current floor and ceiling carried over to the suggested size.
+	sizedMin := math.Ceil(float64(floor)*ratio) * suggestedPrice
+	sizedMax := math.Ceil(float64(ceiling)*ratio) * suggestedPrice
+
+	if adv.Size != current.Slug {
+		var reason string
+		if saturated > 0 {
+			reason = fmt.Sprintf("at its maximum in %d of %d samples, %s is cheaper for the same capacity", saturated, len(samples), adv.Size)
+		} else {
+			reason = fmt.Sprintf("idle %.0f%% of the time, %s is cheaper for the same capacity", adv.IdleFraction*100, adv.Size)
+		}
+		adv.suggest(reason, adv.SuggestedMonthly-adv.CurrentMonthly, sizedMin-adv.CurrentMinMonthly, sizedMax-adv.CurrentMaxMonthly)
+	}
+
+	adv.MinNodes = int(math.Ceil(float64(adv.Low) * ratio))
+	if adv.MinNodes < 1 {
+		adv.MinNodes = 1
+	}
+	adv.MaxNodes = int(math.Ceil(float64(adv.Peak) * ratio * (1 + headroom)))
+	if adv.MaxNodes <= adv.MinNodes {
+		adv.MaxNodes = adv.MinNodes + 1
+	}
+	adv.SuggestedMinMonthly = float64(adv.MinNodes) * suggestedPrice
+	adv.SuggestedMaxMonthly = float64(adv.MaxNodes) * suggestedPrice
+
+	// New bounds move the floor and ceiling but not the cost of the
+	// observed demand, which stays within them.
+	if adv.MinNodes != last.MinNodes || adv.MaxNodes != last.MaxNodes || !last.AutoScale {
+		reason := fmt.Sprintf("observed %d to %d nodes, bounds %d-%d leave %.0f%% headroom", adv.Low, adv.Peak, adv.MinNodes, adv.MaxNodes, headroom*100)
+		if saturated > 0 && adv.Size == current.Slug {
+			reason = fmt.Sprintf("at its maximum of %d nodes in %d of %d samples, ", last.MaxNodes, saturated, len(samples)) + reason
+		}
+		adv.suggest(reason, 0, adv.SuggestedMinMonthly-sizedMin, adv.SuggestedMaxMonthly-sizedMax)
+	}
+
+	adv.MonthlyChange = adv.SuggestedMonthly - adv.CurrentMonthly
+	return adv, nil
+}
+
+// averageNodes returns the average node count of the samples after scaling
+// each count by ratio and rounding up.
+func averageNodes(samples []NodePoolSample, ratio float64) float64 {
+	total := 0.0
+	for _, s := range samples {
+		total += math.Ceil(float64(s.Count) * ratio)
+	}
+	return total / float64(len(samples))
+}
+
+// nodeRatio is the number of nodes of size to that replace one node of size
+// from, going by both CPUs and memory.
+func nodeRatio(from, to godo.Size) float64 {
+	if from.Slug == to.Slug || to.Vcpus == 0 || to.Memory == 0 {
+		return 1
+	}
+	return math.Max(float64(from.Vcpus)/float64(to.Vcpus), float64(from.Memory)/float64(to.Memory))
+}
+
+// sizeFamily returns the family of a size slug, such as "s" for
+// "s-2vcpu-4gb".
+func sizeFamily(slug string) string {
+	if i := strings.Index(slug, "-"); i >= 0 {
+		return slug[:i]
+	}
+	return slug
+}
@@ -0,0 +1,149 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodePoolAdvisor(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/sizes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sizes": [
+			{"slug": "s-1vcpu-2gb", "vcpus": 1, "memory": 2048, "price_monthly": 8, "available": true},
+			{"slug": "s-2vcpu-4gb", "vcpus": 2, "memory": 4096, "price_monthly": 20, "available": true},
+			{"slug": "c-2", "vcpus": 2, "memory": 4096, "price_monthly": 40, "available": true}
+		]}`)
+	})
+
+	pools := `{"node_pools": [
+		{"id": "p1", "name": "web", "size": "s-2vcpu-4gb", "count": %d, "auto_scale": true, "min_nodes": 1, "max_nodes": 4},
+		{"id": "p2", "name": "idle", "size": "s-2vcpu-4gb", "count": %d},
+		{"id": "p3", "name": "static", "size": "s-2vcpu-4gb", "count": 2}
+	]}`
+	counts := []int{2, 4, 4, 3}
+	idleCounts := []int{1, 1, 1, 4}
+	polls := 0
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, pools, counts[polls], idleCounts[polls])
+		polls++
+	})
+
+	store := &MemorySampleStore{}
+	a := &NodePoolAdvisor{Client: client, ClusterID: "k8s", Store: store}
+	for range counts {
+		if err := a.Sample(ctx); err != nil {
+			t.Fatalf("Sample returned error: %v", err)
+		}
+	}
+
+	samples, _ := store.Samples("k8s", time.Time{})
+	if len(samples) != 12 || samples[0].Count != 2 || samples[1].PoolName != "idle" {
+		t.Fatalf("store holds %+v", samples)
+	}
+
+	advice, err := a.Advise(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("Advise returned error: %v", err)
+	}
+	if len(advice) != 3 {
+		t.Fatalf("got %d pieces of advice, expected 3", len(advice))
+	}
+
+	web := advice[0]
+	if web.Size != "s-2vcpu-4gb" || web.Low != 2 || web.Peak != 4 || web.MinNodes != 2 || web.MaxNodes != 5 {
+		t.Errorf("web advice = %+v, expected bounds 2-5 on the same size", web)
+	}
+	if web.CurrentMonthly != 65 || web.MonthlyChange != 0 {
+		t.Errorf("web costs %v with change %v, expected 65 and 0", web.CurrentMonthly, web.MonthlyChange)
+	}
+	expectedCosts := []NodePoolSuggestion{
+		{Reason: "at its maximum of 4 nodes in 2 of 4 samples, observed 2 to 4 nodes, bounds 2-5 leave 20% headroom", MinMonthlyChange: 20, MaxMonthlyChange: 20},
+	}
+	if !reflect.DeepEqual(web.Suggestions, expectedCosts) {
+		t.Errorf("web suggestions = %+v, expected %+v", web.Suggestions, expectedCosts)
+	}
+
+	idle := advice[1]
+	if idle.Size != "s-1vcpu-2gb" || idle.MinNodes != 2 || idle.MaxNodes != 10 || idle.IdleFraction != 0.75 {
+		t.Errorf("idle advice = %+v, expected 2-10 nodes of s-1vcpu-2gb", idle)
+	}
+	if idle.CurrentMonthly != 35 || idle.SuggestedMonthly != 28 || idle.MonthlyChange != -7 {
+		t.Errorf("idle costs %v -> %v (%v), expected 35 -> 28 (-7)", idle.CurrentMonthly, idle.SuggestedMonthly, idle.MonthlyChange)
+	}
+	if idle.CurrentMinMonthly != 80 || idle.CurrentMaxMonthly != 80 || idle.SuggestedMinMonthly != 16 || idle.SuggestedMaxMonthly != 80 {
+		t.Errorf("idle floor and ceiling %v-%v -> %v-%v, expected 80-80 -> 16-80",
+			idle.CurrentMinMonthly, idle.CurrentMaxMonthly, idle.SuggestedMinMonthly, idle.SuggestedMaxMonthly)
+	}
+	expectedCosts = []NodePoolSuggestion{
+		{Reason: "idle 75% of the time, s-1vcpu-2gb is cheaper for the same capacity", MonthlyChange: -7, MinMonthlyChange: -16, MaxMonthlyChange: -16},
+		{Reason: "observed 1 to 4 nodes, bounds 2-10 leave 20% headroom", MinMonthlyChange: -48, MaxMonthlyChange: 16},
+	}
+	if !reflect.DeepEqual(idle.Suggestions, expectedCosts) {
+		t.Errorf("idle suggestions = %+v, expected %+v", idle.Suggestions, expectedCosts)
+	}
+
+	req := idle.UpdateRequest()
+	if *req.Count != 4 || *req.MinNodes != 2 || *req.MaxNodes != 10 || !*req.AutoScale {
+		t.Errorf("update request = %+v", req)
+	}
+
+	// The web pool's last count of 3 is within its suggested bounds.
+	if req := web.UpdateRequest(); *req.Count != 3 {
+		t.Errorf("web update request count = %d, expected 3", *req.Count)
+	}
+	if req := (&NodePoolAdvice{CurrentCount: 1, MinNodes: 2, MaxNodes: 5}).UpdateRequest(); *req.Count != 2 {
+		t.Errorf("update request count = %d, expected it clamped to 2", *req.Count)
+	}
+
+	static := advice[2]
+	if static.Size != "s-2vcpu-4gb" || static.IdleFraction != 0 || static.MonthlyChange != 0 {
+		t.Errorf("static advice = %+v, expected no idle time and the same size", static)
+	}
+}
+
+func TestFileSampleStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godo-samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &FileSampleStore{Path: filepath.Join(dir, "samples.json")}
+	if samples, err := s.Samples("k8s", time.Time{}); err != nil || samples != nil {
+		t.Fatalf("empty store returned %v, %v", samples, err)
+	}
+
+	t0 := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	added := []NodePoolSample{
+		{Time: t0.Add(time.Minute), ClusterID: "k8s", PoolID: "p1", Count: 3},
+		{Time: t0, ClusterID: "k8s", PoolID: "p1", Count: 2},
+		{Time: t0, ClusterID: "other", PoolID: "p9", Count: 1},
+	}
+	if err := s.Add(added[:2]...); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+	if err := s.Add(added[2]); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+
+	samples, err := s.Samples("k8s", t0)
+	if err != nil {
+		t.Fatalf("Samples returned error: %v", err)
+	}
+	expected := []NodePoolSample{added[1], added[0]}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Samples = %+v, expected %+v", samples, expected)
+	}
+
+	if samples, _ = s.Samples("k8s", t0.Add(time.Second)); len(samples) != 1 {
+		t.Errorf("Samples since a later time returned %d samples, expected 1", len(samples))
+	}
+}
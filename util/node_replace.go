@@ -0,0 +1,303 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+const defaultNodeBatchTimeout = 20 * time.Minute
+
+// NodeTimeline records the replacement of one node.
+type NodeTimeline struct {
+	NodeID          string     `json:"node_id"`
+	DeleteRequested time.Time  `json:"delete_requested"`
+	Removed         *time.Time `json:"removed,omitempty"`
+
+	ReplacementID      string     `json:"replacement_id,omitempty"`
+	ReplacementRunning *time.Time `json:"replacement_running,omitempty"`
+}
+
+// NodeReplacementState is the progress of a rolling replacement. It can be
+// saved, for example as JSON, and passed back to resume an interrupted
+// replacement.
+type NodeReplacementState struct {
+	// Originals are the nodes the pool had when the replacement started.
+	Originals []string `json:"originals"`
+
+	Timeline []NodeTimeline `json:"timeline"`
+
+	// Before are the nodes the pool had when the latest batch was deleted.
+	// They are never taken as replacements.
+	Before []string `json:"before,omitempty"`
+}
+
+func (s *NodeReplacementState) requested(nodeID string) bool {
+	for _, e := range s.Timeline {
+		if e.NodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *NodeReplacementState) original(nodeID string) bool {
+	for _, id := range s.Originals {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *NodeReplacementState) existedBefore(nodeID string) bool {
+	for _, id := range s.Before {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeReplacement replaces every node of a node pool in batches. Each batch
+// is deleted with the replace option, and the next batch starts once its
+// replacements are running. A batch is shrunk, or waited for, so that the
+// number of running nodes never drops below MinReady. Only nodes that appear
+// after a batch is deleted are taken as its replacements.
+type NodeReplacement struct {
+	Client    *godo.Client
+	ClusterID string
+	PoolID    string
+
+	// BatchSize defaults to 1.
+	BatchSize int
+
+	// MinReady is the number of running nodes to keep. It defaults to the
+	// pool size minus BatchSize when nil; set it to zero to allow every
+	// node to be replaced at once.
+	MinReady *int
+
+	// SkipDrain deletes nodes without draining them first.
+	SkipDrain bool
+
+	// BatchTimeout bounds the wait for the replacements of one batch.
+	BatchTimeout time.Duration
+
+	// State is used to resume a replacement. A new state is created when
+	// it is nil.
+	State *NodeReplacementState
+
+	// OnProgress is called with the state whenever it changes, so that it
+	// can be saved.
+	OnProgress func(*NodeReplacementState)
+}
+
+// Run replaces the nodes and returns the per-node timeline.
+func (r *NodeReplacement) Run(ctx context.Context) ([]NodeTimeline, error) {
+	if r.ClusterID == "" {
+		return nil, godo.NewArgError("ClusterID", "cannot be empty")
+	}
+	if r.PoolID == "" {
+		return nil, godo.NewArgError("PoolID", "cannot be empty")
+	}
+	batchSize := r.BatchSize
+	if batchSize == 0 {
+		batchSize = 1
+	}
+	if batchSize < 0 {
+		return nil, godo.NewArgError("BatchSize", "cannot be negative")
+	}
+
+	pool, _, err := r.Client.Kubernetes.GetNodePool(ctx, r.ClusterID, r.PoolID)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.State == nil {
+		r.State = &NodeReplacementState{}
+		for _, n := range pool.Nodes {
+			r.State.Originals = append(r.State.Originals, n.ID)
+		}
+		r.progress()
+	}
+	state := r.State
+
+	minReady := len(state.Originals) - batchSize
+	if r.MinReady != nil {
+		if *r.MinReady < 0 {
+			return nil, godo.NewArgError("MinReady", "cannot be negative")
+		}
+		minReady = *r.MinReady
+	}
+	if minReady < 0 {
+		minReady = 0
+	}
+
+	// Finish a batch that was interrupted before its replacements ran.
+	if err := r.waitForReplacements(ctx); err != nil {
+		return state.Timeline, err
+	}
+
+	for {
+		pool, _, err = r.Client.Kubernetes.GetNodePool(ctx, r.ClusterID, r.PoolID)
+		if err != nil {
+			return state.Timeline, err
+		}
+
+		var pending []*godo.KubernetesNode
+		for _, n := range pool.Nodes {
+			if state.original(n.ID) && !state.requested(n.ID) {
+				pending = append(pending, n)
+			}
+		}
+		if len(pending) == 0 {
+			return state.Timeline, nil
+		}
+
+		room := runningNodes(pool) - minReady
+		if room < 1 {
+			if err := r.waitForRunning(ctx, minReady+1); err != nil {
+				return state.Timeline, err
+			}
+			continue
+		}
+		size := batchSize
+		if room < size {
+			size = room
+		}
+		if size > len(pending) {
+			size = len(pending)
+		}
+
+		state.Before = state.Before[:0]
+		for _, n := range pool.Nodes {
+			state.Before = append(state.Before, n.ID)
+		}
+		for _, n := range pending[:size] {
+			_, err := r.Client.Kubernetes.DeleteNode(ctx, r.ClusterID, r.PoolID, n.ID, &godo.KubernetesNodeDeleteRequest{
+				Replace:   true,
+				SkipDrain: r.SkipDrain,
+			})
+			if err != nil {
+				return state.Timeline, fmt.Errorf("delete node %s: %v", n.ID, err)
+			}
+			state.Timeline = append(state.Timeline, NodeTimeline{NodeID: n.ID, DeleteRequested: time.Now()})
+			r.progress()
+		}
+
+		if err := r.waitForReplacements(ctx); err != nil {
+			return state.Timeline, err
+		}
+	}
+}
+
+// waitForRunning polls the pool until at least n of its nodes are running.
+func (r *NodeReplacement) waitForRunning(ctx context.Context, n int) error {
+	ctx, cancel := context.WithTimeout(ctx, r.batchTimeout())
+	defer cancel()
+
+	for {
+		pool, _, err := r.Client.Kubernetes.GetNodePool(ctx, r.ClusterID, r.PoolID)
+		if err != nil {
+			return err
+		}
+		running := runningNodes(pool)
+		if running >= n {
+			return nil
+		}
+		if err := sleep(ctx); err != nil {
+			return fmt.Errorf("node pool %s has %d running nodes, waiting for %d: %v", r.PoolID, running, n, err)
+		}
+	}
+}
+
+// waitForReplacements polls the pool until every requested node is gone and
+// has a running replacement.
+func (r *NodeReplacement) waitForReplacements(ctx context.Context) error {
+	state := r.State
+	ctx, cancel := context.WithTimeout(ctx, r.batchTimeout())
+	defer cancel()
+
+	for {
+		pool, _, err := r.Client.Kubernetes.GetNodePool(ctx, r.ClusterID, r.PoolID)
+		if err != nil {
+			return err
+		}
+
+		present := make(map[string]bool)
+		var running []string
+		for _, n := range pool.Nodes {
+			present[n.ID] = true
+			if !state.original(n.ID) && !state.existedBefore(n.ID) && n.Status != nil && n.Status.State == "running" {
+				running = append(running, n.ID)
+			}
+		}
+
+		assigned := make(map[string]bool)
+		for _, e := range state.Timeline {
+			if e.ReplacementID != "" {
+				assigned[e.ReplacementID] = true
+			}
+		}
+
+		done := true
+		changed := false
+		for i := range state.Timeline {
+			e := &state.Timeline[i]
+			if e.Removed == nil && !present[e.NodeID] {
+				now := time.Now()
+				e.Removed = &now
+				changed = true
+			}
+			if e.ReplacementID == "" {
+				for _, id := range running {
+					if !assigned[id] {
+						now := time.Now()
+						e.ReplacementID, e.ReplacementRunning = id, &now
+						assigned[id] = true
+						changed = true
+						break
+					}
+				}
+			}
+			if e.Removed == nil || e.ReplacementID == "" {
+				done = false
+			}
+		}
+		if changed {
+			r.progress()
+		}
+		if done {
+			return nil
+		}
+
+		if err := sleep(ctx); err != nil {
+			return fmt.Errorf("waiting for replacement nodes in pool %s: %v", r.PoolID, err)
+		}
+	}
+}
+
+func (r *NodeReplacement) batchTimeout() time.Duration {
+	if r.BatchTimeout == 0 {
+		return defaultNodeBatchTimeout
+	}
+	return r.BatchTimeout
+}
+
+func (r *NodeReplacement) progress() {
+	if r.OnProgress != nil {
+		r.OnProgress(r.State)
+	}
+}
+
+func runningNodes(pool *godo.KubernetesNodePool) int {
+	n := 0
+	for _, node := range pool.Nodes {
+		if node.Status != nil && node.Status.State == "running" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,244 @@
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// fakeNodePool simulates a node pool whose deleted nodes are replaced by a
+// provisioning node that is running on the next read.
+type fakeNodePool struct {
+	mu      sync.Mutex
+	nodes   []*godo.KubernetesNode
+	deleted []string
+
+	// afterRead, if set, is called with the number of reads so far after
+	// each read.
+	afterRead func(reads int)
+	reads     int
+}
+
+func newFakeNodePool(ids ...string) *fakeNodePool {
+	p := &fakeNodePool{}
+	for _, id := range ids {
+		p.nodes = append(p.nodes, &godo.KubernetesNode{ID: id, Status: &godo.KubernetesNodeStatus{State: "running"}})
+	}
+	return p
+}
+
+func (p *fakeNodePool) register(t *testing.T) {
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools/pool", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"node_pool": &godo.KubernetesNodePool{ID: "pool", Count: len(p.nodes), Nodes: p.nodes},
+		})
+		for _, n := range p.nodes {
+			n.Status.State = "running"
+		}
+		p.reads++
+		if p.afterRead != nil {
+			p.afterRead(p.reads)
+		}
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools/pool/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		if r.URL.Query().Get("replace") != "1" {
+			t.Errorf("node deleted without replace")
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		id := strings.TrimPrefix(r.URL.Path, "/v2/kubernetes/clusters/k8s/node_pools/pool/nodes/")
+		p.deleted = append(p.deleted, id)
+		nodes := p.nodes[:0]
+		for _, n := range p.nodes {
+			if n.ID != id {
+				nodes = append(nodes, n)
+			}
+		}
+		p.nodes = append(nodes, &godo.KubernetesNode{ID: "r-" + id, Status: &godo.KubernetesNodeStatus{State: "provisioning"}})
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func TestNodeReplacement(t *testing.T) {
+	setup()
+	defer teardown()
+
+	pool := newFakeNodePool("n1", "n2", "n3")
+	pool.register(t)
+
+	saves := 0
+	r := &NodeReplacement{
+		Client:     client,
+		ClusterID:  "k8s",
+		PoolID:     "pool",
+		BatchSize:  2,
+		OnProgress: func(*NodeReplacementState) { saves++ },
+	}
+
+	timeline, err := r.Run(ctx)
+	if err != nil {
+		t.Fatalf("NodeReplacement.Run returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(pool.deleted, []string{"n1", "n2", "n3"}) {
+		t.Errorf("deleted = %v, expected [n1 n2 n3]", pool.deleted)
+	}
+	if len(timeline) != 3 {
+		t.Fatalf("timeline has %d entries, expected 3", len(timeline))
+	}
+	for _, e := range timeline {
+		if e.ReplacementID != "r-"+e.NodeID {
+			t.Errorf("%s was replaced by %q, expected r-%s", e.NodeID, e.ReplacementID, e.NodeID)
+		}
+		if e.Removed == nil || e.Removed.Before(e.DeleteRequested) || e.ReplacementRunning == nil {
+			t.Errorf("timeline of %s is incomplete: %+v", e.NodeID, e)
+		}
+	}
+	if saves == 0 {
+		t.Error("OnProgress was never called")
+	}
+	if !reflect.DeepEqual(r.State.Originals, []string{"n1", "n2", "n3"}) {
+		t.Errorf("originals = %v, expected [n1 n2 n3]", r.State.Originals)
+	}
+}
+
+func TestNodeReplacement_Resume(t *testing.T) {
+	setup()
+	defer teardown()
+
+	pool := newFakeNodePool("r-n1", "n2", "n3")
+	pool.register(t)
+
+	now := time.Now()
+	state := &NodeReplacementState{
+		Originals: []string{"n1", "n2", "n3"},
+		Timeline: []NodeTimeline{
+			{NodeID: "n1", DeleteRequested: now, Removed: &now, ReplacementID: "r-n1", ReplacementRunning: &now},
+		},
+	}
+
+	r := &NodeReplacement{Client: client, ClusterID: "k8s", PoolID: "pool", State: state}
+	timeline, err := r.Run(ctx)
+	if err != nil {
+		t.Fatalf("NodeReplacement.Run returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(pool.deleted, []string{"n2", "n3"}) {
+		t.Errorf("deleted = %v, expected [n2 n3]", pool.deleted)
+	}
+	if len(timeline) != 3 || timeline[2].ReplacementID != "r-n3" {
+		t.Errorf("timeline = %+v, expected n3 replaced by r-n3 last", timeline)
+	}
+}
+
+func TestNodeReplacement_MinReady(t *testing.T) {
+	setup()
+	defer teardown()
+
+	pool := newFakeNodePool("n1", "n2")
+	pool.nodes[1].Status.State = "draining"
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools/pool", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"node_pool": &godo.KubernetesNodePool{ID: "pool", Nodes: pool.nodes},
+		})
+	})
+
+	r := &NodeReplacement{Client: client, ClusterID: "k8s", PoolID: "pool", MinReady: godo.Int(1), BatchTimeout: 20 * time.Millisecond}
+	if _, err := r.Run(ctx); err == nil {
+		t.Fatal("expected error when the pool stays at MinReady")
+	}
+}
+
+func TestNodeReplacement_ZeroMinReady(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The second node never becomes ready, so the default MinReady of one
+	// would stop the replacement.
+	pool := newFakeNodePool("n1", "n2")
+	pool.nodes[1].Status.State = "draining"
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools/pool", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"node_pool": &godo.KubernetesNodePool{ID: "pool", Nodes: pool.nodes},
+		})
+	})
+	mux.HandleFunc("/v2/kubernetes/clusters/k8s/node_pools/pool/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v2/kubernetes/clusters/k8s/node_pools/pool/nodes/")
+		pool.deleted = append(pool.deleted, id)
+		nodes := pool.nodes[:0]
+		for _, n := range pool.nodes {
+			if n.ID != id {
+				nodes = append(nodes, n)
+			}
+		}
+		pool.nodes = append(nodes, &godo.KubernetesNode{ID: "r-" + id, Status: &godo.KubernetesNodeStatus{State: "running"}})
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	r := &NodeReplacement{Client: client, ClusterID: "k8s", PoolID: "pool", MinReady: godo.Int(0)}
+	if _, err := r.Run(ctx); err != nil {
+		t.Fatalf("NodeReplacement.Run returned error: %v", err)
+	}
+	if !reflect.DeepEqual(pool.deleted, []string{"n1", "n2"}) {
+		t.Errorf("deleted = %v, expected [n1 n2]", pool.deleted)
+	}
+}
+
+func TestNodeReplacement_WaitsForMinReady(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// n2 is not running for the first reads, leaving no room above the
+	// default MinReady of one.
+	pool := newFakeNodePool("n1", "n2")
+	pool.register(t)
+	pool.afterRead = func(reads int) {
+		if reads < 4 {
+			pool.nodes[1].Status.State = "draining"
+		}
+	}
+	pool.nodes[1].Status.State = "draining"
+
+	r := &NodeReplacement{Client: client, ClusterID: "k8s", PoolID: "pool"}
+	if _, err := r.Run(ctx); err != nil {
+		t.Fatalf("NodeReplacement.Run returned error: %v", err)
+	}
+	if !reflect.DeepEqual(pool.deleted, []string{"n1", "n2"}) {
+		t.Errorf("deleted = %v, expected [n1 n2]", pool.deleted)
+	}
+}
+
+func TestNodeReplacement_IgnoresAutoscaledNodes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The autoscaler adds a1 after the replacement started.
+	pool := newFakeNodePool("n1")
+	pool.register(t)
+	pool.afterRead = func(reads int) {
+		if reads == 1 {
+			pool.nodes = append(pool.nodes, &godo.KubernetesNode{ID: "a1", Status: &godo.KubernetesNodeStatus{State: "running"}})
+		}
+	}
+
+	r := &NodeReplacement{Client: client, ClusterID: "k8s", PoolID: "pool"}
+	timeline, err := r.Run(ctx)
+	if err != nil {
+		t.Fatalf("NodeReplacement.Run returned error: %v", err)
+	}
+	if len(timeline) != 1 || timeline[0].ReplacementID != "r-n1" {
+		t.Errorf("timeline = %+v, expected n1 replaced by r-n1", timeline)
+	}
+}
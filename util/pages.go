@@ -0,0 +1,170 @@
+package util
+
+import (
+	"context"
+
+	"github.com/digitalocean/godo"
+)
+
+// forEachPage calls list with increasing page numbers until the API reports
+// the last page.
+func forEachPage(list func(opt *godo.ListOptions) (*godo.Response, error)) error {
+	opt := &godo.ListOptions{}
+	for {
+		resp, err := list(opt)
+		if err != nil {
+			return err
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			return nil
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return err
+		}
+
+		opt.Page = page + 1
+	}
+}
+
+// listDropletsByTag pages through all droplets carrying a tag.
+func listDropletsByTag(ctx context.Context, client *godo.Client, tag string) ([]godo.Droplet, error) {
+	list := []godo.Droplet{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		droplets, resp, err := client.Droplets.ListByTag(ctx, tag, opt)
+		list = append(list, droplets...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listVolumes pages through all block storage volumes.
+func listVolumes(ctx context.Context, client *godo.Client) ([]godo.Volume, error) {
+	list := []godo.Volume{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		volumes, resp, err := client.Storage.ListVolumes(ctx, &godo.ListVolumeParams{ListOptions: opt})
+		list = append(list, volumes...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listFloatingIPs pages through all floating IPs.
+func listFloatingIPs(ctx context.Context, client *godo.Client) ([]godo.FloatingIP, error) {
+	list := []godo.FloatingIP{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		ips, resp, err := client.FloatingIPs.List(ctx, opt)
+		list = append(list, ips...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listDomainRecords pages through all records of a domain.
+func listDomainRecords(ctx context.Context, client *godo.Client, domain string) ([]godo.DomainRecord, error) {
+	list := []godo.DomainRecord{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		records, resp, err := client.Domains.Records(ctx, domain, opt)
+		list = append(list, records...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listFirewalls pages through all firewalls.
+func listFirewalls(ctx context.Context, client *godo.Client) ([]godo.Firewall, error) {
+	list := []godo.Firewall{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		firewalls, resp, err := client.Firewalls.List(ctx, opt)
+		list = append(list, firewalls...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listFirewallsByDroplet pages through the firewalls applied to a droplet.
+func listFirewallsByDroplet(ctx context.Context, client *godo.Client, dropletID int) ([]godo.Firewall, error) {
+	list := []godo.Firewall{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		firewalls, resp, err := client.Firewalls.ListByDroplet(ctx, dropletID, opt)
+		list = append(list, firewalls...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listNodePools pages through the node pools of a Kubernetes cluster.
+func listNodePools(ctx context.Context, client *godo.Client, clusterID string) ([]*godo.KubernetesNodePool, error) {
+	list := []*godo.KubernetesNodePool{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		pools, resp, err := client.Kubernetes.ListNodePools(ctx, clusterID, opt)
+		list = append(list, pools...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listSizes pages through all droplet sizes.
+func listSizes(ctx context.Context, client *godo.Client) ([]godo.Size, error) {
+	list := []godo.Size{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		sizes, resp, err := client.Sizes.List(ctx, opt)
+		list = append(list, sizes...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listLoadBalancers pages through all load balancers.
+func listLoadBalancers(ctx context.Context, client *godo.Client) ([]godo.LoadBalancer, error) {
+	list := []godo.LoadBalancer{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		lbs, resp, err := client.LoadBalancers.List(ctx, opt)
+		list = append(list, lbs...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// listKubernetesClusters pages through all Kubernetes clusters.
+func listKubernetesClusters(ctx context.Context, client *godo.Client) ([]*godo.KubernetesCluster, error) {
+	list := []*godo.KubernetesCluster{}
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		clusters, resp, err := client.Kubernetes.List(ctx, opt)
+		list = append(list, clusters...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,171 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/godo/kubeconfig"
+)
+
+// registryHostSuffix matches the hosts of DigitalOcean container registries,
+// such as registry.digitalocean.com.
+const registryHostSuffix = "digitalocean.com"
+
+// RegistryIntegrationStatus reports whether a cluster can pull from the
+// account's container registry.
+type RegistryIntegrationStatus struct {
+	ClusterID   string
+	ClusterName string
+	Linked      bool
+
+	// Registry is the hostname of the linked registry.
+	Registry string
+
+	// Context is the kubeconfig context of the cluster, if any.
+	Context string
+
+	// Reason explains why the cluster is not linked.
+	Reason string
+}
+
+// RegistryIntegration manages the integration of Kubernetes clusters with
+// the account's container registry.
+type RegistryIntegration struct {
+	Client *godo.Client
+
+	// Kubeconfig, when set, is used to report the context of each
+	// cluster.
+	Kubeconfig *kubeconfig.Config
+}
+
+// Status reports the integration of every cluster. A cluster is linked when
+// its registry integration is enabled and the account has a registry, whose
+// hostname is read from Registry.DockerCredentials.
+func (m *RegistryIntegration) Status(ctx context.Context) ([]RegistryIntegrationStatus, error) {
+	clusters, err := listKubernetesClusters(ctx, m.Client)
+	if err != nil {
+		return nil, err
+	}
+	host, err := m.registryHost(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]RegistryIntegrationStatus, 0, len(clusters))
+	for _, c := range clusters {
+		s := RegistryIntegrationStatus{
+			ClusterID:   c.ID,
+			ClusterName: c.Name,
+			Context:     m.contextFor(c.ID),
+		}
+		switch {
+		case host == "":
+			s.Reason = "the account has no container registry"
+		case !c.RegistryEnabled:
+			s.Reason = "registry integration is not enabled"
+		default:
+			s.Linked, s.Registry = true, host
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// EnableForTag enables the registry integration of every cluster carrying
+// tag that does not have it yet, and returns the IDs of those clusters. It
+// fails if the account has no container registry.
+func (m *RegistryIntegration) EnableForTag(ctx context.Context, tag string) ([]string, error) {
+	if tag == "" {
+		return nil, godo.NewArgError("tag", "cannot be empty")
+	}
+	host, err := m.registryHost(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return nil, fmt.Errorf("the account has no container registry")
+	}
+	clusters, err := listKubernetesClusters(ctx, m.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, c := range clusters {
+		if !c.RegistryEnabled && hasTag(c.Tags, tag) {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sort.Strings(ids)
+
+	if _, err := m.Client.Kubernetes.AddRegistry(ctx, &godo.KubernetesClusterRegistryRequest{ClusterUUIDs: ids}); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Disable disables the registry integration of the given clusters.
+func (m *RegistryIntegration) Disable(ctx context.Context, clusterIDs ...string) error {
+	if len(clusterIDs) == 0 {
+		return godo.NewArgError("clusterIDs", "cannot be empty")
+	}
+	_, err := m.Client.Kubernetes.RemoveRegistry(ctx, &godo.KubernetesClusterRegistryRequest{ClusterUUIDs: clusterIDs})
+	return err
+}
+
+// registryHost returns the hostname of the account's DigitalOcean registry,
+// or "" if the account has none. Other registries in the credentials are
+// ignored.
+func (m *RegistryIntegration) registryHost(ctx context.Context) (string, error) {
+	creds, resp, err := m.Client.Registry.DockerCredentials(ctx, &godo.RegistryDockerCredentialsRequest{})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	var config struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}
+	if err := json.Unmarshal(creds.DockerConfigJSON, &config); err != nil {
+		return "", fmt.Errorf("docker credentials: %v", err)
+	}
+	hosts := make([]string, 0, len(config.Auths))
+	for host := range config.Auths {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if host == registryHostSuffix || strings.HasSuffix(host, "."+registryHostSuffix) {
+			return host, nil
+		}
+	}
+	return "", nil
+}
+
+// contextFor returns the first kubeconfig context whose cluster points at
+// the given cluster ID.
+func (m *RegistryIntegration) contextFor(clusterID string) string {
+	if m.Kubeconfig == nil {
+		return ""
+	}
+	for _, c := range m.Kubeconfig.Contexts {
+		cluster := m.Kubeconfig.Cluster(c.Context.Cluster)
+		if cluster == nil {
+			continue
+		}
+		if id, ok := kubeconfig.ClusterID(cluster.Cluster.Server); ok && id == clusterID {
+			return c.Name
+		}
+	}
+	return ""
+}
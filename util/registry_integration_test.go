@@ -0,0 +1,131 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/godo"
+	"github.com/digitalocean/godo/kubeconfig"
+)
+
+func handleRegistryClusters(t *testing.T) {
+	mux.HandleFunc("/v2/kubernetes/clusters", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"kubernetes_clusters": [
+			{"id": "aaa", "name": "prod", "tags": ["ci"], "registry_enabled": true},
+			{"id": "bbb", "name": "staging", "tags": ["ci"]},
+			{"id": "ccc", "name": "dev"}
+		]}`)
+	})
+}
+
+func handleDockerCredentials(t *testing.T) {
+	mux.HandleFunc("/v2/registry/docker-credentials", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"auths": {"registry.digitalocean.com": {"auth": "dG9rZW46dG9rZW4="}}}`)
+	})
+}
+
+func TestRegistryIntegration_Status(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleRegistryClusters(t)
+	mux.HandleFunc("/v2/registry/docker-credentials", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprint(w, `{"auths": {
+			"docker.io": {"auth": "dXNlcjpwYXNz"},
+			"registry.digitalocean.com": {"auth": "dG9rZW46dG9rZW4="}
+		}}`)
+	})
+
+	kc := kubeconfig.New()
+	kc.SetCluster(kubeconfig.NamedCluster{Name: "do-nyc1-prod", Cluster: kubeconfig.Cluster{Server: "https://aaa.k8s.ondigitalocean.com"}})
+	kc.SetContext(kubeconfig.NamedContext{Name: "do-nyc1-prod", Context: kubeconfig.Context{Cluster: "do-nyc1-prod"}})
+
+	m := &RegistryIntegration{Client: client, Kubeconfig: kc}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+
+	expected := []RegistryIntegrationStatus{
+		{ClusterID: "aaa", ClusterName: "prod", Linked: true, Registry: "registry.digitalocean.com", Context: "do-nyc1-prod"},
+		{ClusterID: "bbb", ClusterName: "staging", Reason: "registry integration is not enabled"},
+		{ClusterID: "ccc", ClusterName: "dev", Reason: "registry integration is not enabled"},
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Status = %+v, expected %+v", statuses, expected)
+	}
+}
+
+func TestRegistryIntegration_StatusWithoutRegistry(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleRegistryClusters(t)
+	mux.HandleFunc("/v2/registry/docker-credentials", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"id": "not_found", "message": "registry not found"}`)
+	})
+
+	m := &RegistryIntegration{Client: client}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status returned error: %v", err)
+	}
+	if statuses[0].Linked || statuses[0].Reason != "the account has no container registry" {
+		t.Errorf("Status of a registry-enabled cluster = %+v, expected not linked", statuses[0])
+	}
+}
+
+func TestRegistryIntegration_EnableForTag(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleRegistryClusters(t)
+	handleDockerCredentials(t)
+	var added []string
+	mux.HandleFunc("/v2/kubernetes/registry", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		v := new(godo.KubernetesClusterRegistryRequest)
+		json.NewDecoder(r.Body).Decode(v)
+		added = append(added, v.ClusterUUIDs...)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	m := &RegistryIntegration{Client: client}
+	ids, err := m.EnableForTag(ctx, "ci")
+	if err != nil {
+		t.Fatalf("EnableForTag returned error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"bbb"}) || !reflect.DeepEqual(added, ids) {
+		t.Errorf("EnableForTag enabled %v (requested %v), expected [bbb]", ids, added)
+	}
+
+	if ids, _ = m.EnableForTag(ctx, "none"); ids != nil {
+		t.Errorf("EnableForTag for an unused tag returned %v", ids)
+	}
+}
+
+func TestRegistryIntegration_EnableForTagWithoutRegistry(t *testing.T) {
+	setup()
+	defer teardown()
+
+	handleRegistryClusters(t)
+	mux.HandleFunc("/v2/registry/docker-credentials", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"id": "not_found", "message": "registry not found"}`)
+	})
+	mux.HandleFunc("/v2/kubernetes/registry", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("registry integration enabled without a registry")
+	})
+
+	m := &RegistryIntegration{Client: client}
+	if _, err := m.EnableForTag(ctx, "ci"); err == nil {
+		t.Error("expected error enabling the integration without a registry")
+	}
+}
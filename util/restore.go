@@ -0,0 +1,132 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// RestoreOptions controls RestoreToPointInTime.
+type RestoreOptions struct {
+	// SafetySnapshot, when not empty, is the name of a snapshot taken of
+	// the droplet before it is restored.
+	SafetySnapshot string
+
+	// SkipBackups and SkipSnapshots exclude backups or snapshots from the
+	// images considered.
+	SkipBackups   bool
+	SkipSnapshots bool
+}
+
+// RestoreResult describes a completed restore.
+type RestoreResult struct {
+	// Image is the backup or snapshot the droplet was restored from.
+	Image godo.Image
+
+	// FromBackup is set when Image is a backup rather than a snapshot.
+	FromBackup bool
+
+	Droplet *godo.Droplet
+}
+
+// FindRestorePoint returns the newest backup or snapshot of a droplet that
+// was created at or before t.
+func FindRestorePoint(ctx context.Context, client *godo.Client, dropletID int, t time.Time, opts *RestoreOptions) (*godo.Image, bool, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+
+	var best *godo.Image
+	var fromBackup bool
+	consider := func(images []godo.Image, backup bool) {
+		for i := range images {
+			created := createdAt(images[i].Created)
+			if created.IsZero() || created.After(t) {
+				continue
+			}
+			if best == nil || created.After(createdAt(best.Created)) {
+				best = &images[i]
+				fromBackup = backup
+			}
+		}
+	}
+
+	if !opts.SkipBackups {
+		err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+			backups, resp, err := client.Droplets.Backups(ctx, dropletID, opt)
+			consider(backups, true)
+			return resp, err
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if !opts.SkipSnapshots {
+		err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+			snapshots, resp, err := client.Droplets.Snapshots(ctx, dropletID, opt)
+			consider(snapshots, false)
+			return resp, err
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if best == nil {
+		return nil, false, fmt.Errorf("no backup or snapshot of droplet %d at or before %s", dropletID, t.Format(time.RFC3339))
+	}
+	return best, fromBackup, nil
+}
+
+// RestoreToPointInTime restores a droplet from its newest backup or
+// snapshot created at or before t. Backups are restored in place, snapshots
+// are used to rebuild the droplet. It waits for the action to complete and
+// verifies that the droplet now runs the chosen image.
+func RestoreToPointInTime(ctx context.Context, client *godo.Client, dropletID int, t time.Time, opts *RestoreOptions) (*RestoreResult, error) {
+	if dropletID < 1 {
+		return nil, godo.NewArgError("dropletID", "cannot be less than 1")
+	}
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+
+	image, fromBackup, err := FindRestorePoint(ctx, client, dropletID, t, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SafetySnapshot != "" {
+		action, _, err := client.DropletActions.Snapshot(ctx, dropletID, opts.SafetySnapshot)
+		if err != nil {
+			return nil, err
+		}
+		if err := waitForDropletAction(ctx, client, dropletID, action); err != nil {
+			return nil, err
+		}
+	}
+
+	var action *godo.Action
+	if fromBackup {
+		action, _, err = client.DropletActions.Restore(ctx, dropletID, image.ID)
+	} else {
+		action, _, err = client.DropletActions.RebuildByImageID(ctx, dropletID, image.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := waitForDropletAction(ctx, client, dropletID, action); err != nil {
+		return nil, err
+	}
+
+	droplet, _, err := client.Droplets.Get(ctx, dropletID)
+	if err != nil {
+		return nil, err
+	}
+	if droplet.Image == nil || droplet.Image.ID != image.ID {
+		return nil, fmt.Errorf("droplet %d does not run image %d after restore", dropletID, image.ID)
+	}
+
+	return &RestoreResult{Image: *image, FromBackup: fromBackup, Droplet: droplet}, nil
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRestoreToPointInTime(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets/1/backups", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"backups": [
+			{"id": 10, "created_at": "2020-10-10T00:00:00Z"},
+			{"id": 11, "created_at": "2020-10-17T00:00:00Z"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/droplets/1/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"snapshots": [
+			{"id": 20, "created_at": "2020-10-15T00:00:00Z"},
+			{"id": 21, "created_at": "2020-10-18T00:00:00Z"}
+		]}`)
+	})
+
+	var requests []map[string]interface{}
+	mux.HandleFunc("/v2/droplets/1/actions", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		v := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		requests = append(requests, v)
+		fmt.Fprintf(w, `{"action": {"id": %d, "status": "in-progress"}}`, len(requests))
+	})
+	mux.HandleFunc("/v2/droplets/1/actions/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"action": {"status": "completed"}}`)
+	})
+	mux.HandleFunc("/v2/droplets/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"droplet": {"id": 1, "image": {"id": 20}}}`)
+	})
+
+	at := time.Date(2020, 10, 16, 0, 0, 0, 0, time.UTC)
+	result, err := RestoreToPointInTime(ctx, client, 1, at, &RestoreOptions{SafetySnapshot: "before-restore"})
+	if err != nil {
+		t.Fatalf("RestoreToPointInTime returned error: %v", err)
+	}
+
+	if result.Image.ID != 20 || result.FromBackup {
+		t.Errorf("expected restore from snapshot 20, got %+v", result)
+	}
+
+	expected := []map[string]interface{}{
+		{"type": "snapshot", "name": "before-restore"},
+		{"type": "rebuild", "image": float64(20)},
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("action requests\n got=%v\nwant=%v", requests, expected)
+	}
+}
+
+func TestRestoreToPointInTime_Backup(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/droplets/1/backups", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"backups": [{"id": 11, "created_at": "2020-10-17T00:00:00Z"}]}`)
+	})
+	mux.HandleFunc("/v2/droplets/1/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"snapshots": []}`)
+	})
+	mux.HandleFunc("/v2/droplets/1/actions", func(w http.ResponseWriter, r *http.Request) {
+		v := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		if v["type"] != "restore" {
+			t.Errorf("expected restore action, got %v", v)
+		}
+		fmt.Fprint(w, `{"action": {"id": 1, "status": "completed"}}`)
+	})
+	mux.HandleFunc("/v2/droplets/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"droplet": {"id": 1, "image": {"id": 5}}}`)
+	})
+
+	_, err := RestoreToPointInTime(ctx, client, 1, time.Date(2020, 10, 18, 0, 0, 0, 0, time.UTC), nil)
+	if err == nil {
+		t.Error("expected an error when the droplet image does not match")
+	}
+
+	_, err = RestoreToPointInTime(ctx, client, 1, time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC), nil)
+	if err == nil {
+		t.Error("expected an error when no restore point exists")
+	}
+}
@@ -0,0 +1,454 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// Snapshot resource types understood by the retention engine.
+const (
+	RetentionDroplets = "droplet"
+	RetentionVolumes  = "volume"
+)
+
+// RetentionRule describes how many snapshots to keep, grandfather-father-son
+// style. For every period only the newest snapshot is kept, for the N most
+// recent periods that have a snapshot. A snapshot kept by any rule is kept.
+type RetentionRule struct {
+	Last    int
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// RetentionScope selects the snapshots a policy applies to. Rules are
+// evaluated separately for every resource in scope.
+type RetentionScope struct {
+	// ResourceType is either RetentionDroplets or RetentionVolumes.
+	ResourceType string
+
+	// Tag limits the scope to snapshots of droplets or volumes carrying
+	// the tag.
+	Tag string
+
+	// ResourceIDs limits the scope to snapshots of the given droplets or
+	// volumes.
+	ResourceIDs []string
+
+	// NamePrefix limits the scope to snapshots whose name starts with the
+	// prefix. It is also the prefix of snapshots taken by RunRetention.
+	NamePrefix string
+
+	// AllResources must be set to apply the policy to every snapshot of
+	// the resource type in the account when neither Tag, ResourceIDs nor
+	// NamePrefix limit the scope.
+	AllResources bool
+
+	// CountBackups makes droplet backups occupy retention slots. Backups
+	// are managed by DigitalOcean and are never deleted.
+	CountBackups bool
+}
+
+// RetentionPolicy combines a scope with the rule applied to it.
+type RetentionPolicy struct {
+	Scope RetentionScope
+	Rule  RetentionRule
+}
+
+// RetentionCandidate is a snapshot or backup considered by the engine.
+type RetentionCandidate struct {
+	Snapshot godo.Snapshot
+
+	// Backup is set for droplet backups.
+	Backup bool
+
+	// Reasons lists the rules that kept the snapshot.
+	Reasons []string
+}
+
+// RetentionPlan lists what a policy keeps and deletes.
+type RetentionPlan struct {
+	Created []godo.Snapshot
+	Keep    []RetentionCandidate
+	Delete  []RetentionCandidate
+}
+
+// String renders the plan for dry-run output.
+func (p *RetentionPlan) String() string {
+	var b bytes.Buffer
+	for _, s := range p.Created {
+		fmt.Fprintf(&b, "create %s %s (resource %s)\n", s.ID, s.Name, s.ResourceID)
+	}
+	for _, c := range p.Keep {
+		fmt.Fprintf(&b, "keep   %s %s %s (%s)\n", c.Snapshot.ID, c.Snapshot.Name, c.Snapshot.Created, strings.Join(c.Reasons, ", "))
+	}
+	for _, c := range p.Delete {
+		fmt.Fprintf(&b, "delete %s %s %s\n", c.Snapshot.ID, c.Snapshot.Name, c.Snapshot.Created)
+	}
+	return b.String()
+}
+
+// PlanRetention lists the snapshots in scope of the policy and works out
+// which ones to keep and which ones to delete. Nothing is changed.
+func PlanRetention(ctx context.Context, client *godo.Client, policy *RetentionPolicy) (*RetentionPlan, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	resources, err := policy.resources(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := policy.candidates(ctx, client, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	byResource := make(map[string][]RetentionCandidate)
+	var ids []string
+	for _, c := range candidates {
+		id := c.Snapshot.ResourceID
+		if _, ok := byResource[id]; !ok {
+			ids = append(ids, id)
+		}
+		byResource[id] = append(byResource[id], c)
+	}
+	sort.Strings(ids)
+
+	plan := &RetentionPlan{}
+	for _, id := range ids {
+		keep, del := policy.Rule.apply(byResource[id])
+		plan.Keep = append(plan.Keep, keep...)
+		plan.Delete = append(plan.Delete, del...)
+	}
+	return plan, nil
+}
+
+// PruneSnapshots deletes the snapshots that fall outside the policy. When
+// dryRun is set the plan is returned without deleting anything.
+func PruneSnapshots(ctx context.Context, client *godo.Client, policy *RetentionPolicy, dryRun bool) (*RetentionPlan, error) {
+	plan, err := PlanRetention(ctx, client, policy)
+	if err != nil || dryRun {
+		return plan, err
+	}
+
+	return plan, deleteSnapshots(ctx, client, plan.Delete)
+}
+
+// RunRetention takes a new snapshot of every resource in scope of the
+// policy and then prunes old snapshots, so that a scheduler can call it
+// once per period. When dryRun is set no snapshots are taken or deleted.
+func RunRetention(ctx context.Context, client *godo.Client, policy *RetentionPolicy, dryRun bool) (*RetentionPlan, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	var created []godo.Snapshot
+	if !dryRun {
+		resources, err := policy.resources(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		if resources == nil {
+			return nil, godo.NewArgError("policy.Scope", "must select resources by Tag or ResourceIDs to take snapshots")
+		}
+
+		ids := make([]string, 0, len(resources))
+		for id := range resources {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		name := policy.Scope.NamePrefix + time.Now().UTC().Format("20060102-150405")
+		for _, id := range ids {
+			s, err := policy.takeSnapshot(ctx, client, id, name)
+			if err != nil {
+				return &RetentionPlan{Created: created}, err
+			}
+			created = append(created, *s)
+		}
+	}
+
+	plan, err := PruneSnapshots(ctx, client, policy, dryRun)
+	if plan != nil {
+		plan.Created = created
+	}
+	return plan, err
+}
+
+func (p *RetentionPolicy) validate() error {
+	if p == nil {
+		return godo.NewArgError("policy", "cannot be nil")
+	}
+	switch p.Scope.ResourceType {
+	case RetentionDroplets, RetentionVolumes:
+	default:
+		return godo.NewArgError("policy.Scope.ResourceType", fmt.Sprintf("must be %q or %q", RetentionDroplets, RetentionVolumes))
+	}
+	if s := p.Scope; s.Tag == "" && len(s.ResourceIDs) == 0 && s.NamePrefix == "" && !s.AllResources {
+		return godo.NewArgError("policy.Scope", "must set Tag, ResourceIDs or NamePrefix, or AllResources for the whole account")
+	}
+	if p.Scope.CountBackups && p.Scope.ResourceType != RetentionDroplets {
+		return godo.NewArgError("policy.Scope.CountBackups", "only applies to droplets")
+	}
+	r := p.Rule
+	if r.Last < 0 || r.Hourly < 0 || r.Daily < 0 || r.Weekly < 0 || r.Monthly < 0 {
+		return godo.NewArgError("policy.Rule", "cannot keep a negative number of snapshots")
+	}
+	if r.Last+r.Hourly+r.Daily+r.Weekly+r.Monthly == 0 {
+		// Refuse to delete every snapshot in scope by accident.
+		return godo.NewArgError("policy.Rule", "must keep at least one snapshot")
+	}
+	return nil
+}
+
+// resources returns the set of resource IDs in scope, or nil when the scope
+// is not limited to particular resources.
+func (p *RetentionPolicy) resources(ctx context.Context, client *godo.Client) (map[string]bool, error) {
+	s := p.Scope
+	if s.Tag == "" && len(s.ResourceIDs) == 0 {
+		return nil, nil
+	}
+
+	set := make(map[string]bool)
+	for _, id := range s.ResourceIDs {
+		set[id] = true
+	}
+	if s.Tag == "" {
+		return set, nil
+	}
+
+	tagged := make(map[string]bool)
+	switch s.ResourceType {
+	case RetentionDroplets:
+		droplets, err := listDropletsByTag(ctx, client, s.Tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range droplets {
+			tagged[strconv.Itoa(d.ID)] = true
+		}
+	case RetentionVolumes:
+		volumes, err := listVolumes(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range volumes {
+			if hasTag(v.Tags, s.Tag) {
+				tagged[v.ID] = true
+			}
+		}
+	}
+
+	if len(s.ResourceIDs) == 0 {
+		return tagged, nil
+	}
+	for id := range set {
+		if !tagged[id] {
+			delete(set, id)
+		}
+	}
+	return set, nil
+}
+
+func (p *RetentionPolicy) candidates(ctx context.Context, client *godo.Client, resources map[string]bool) ([]RetentionCandidate, error) {
+	var snapshots []godo.Snapshot
+	err := forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		var page []godo.Snapshot
+		var resp *godo.Response
+		var err error
+		if p.Scope.ResourceType == RetentionDroplets {
+			page, resp, err = client.Snapshots.ListDroplet(ctx, opt)
+		} else {
+			page, resp, err = client.Snapshots.ListVolume(ctx, opt)
+		}
+		snapshots = append(snapshots, page...)
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []RetentionCandidate
+	droplets := make(map[string]bool)
+	for _, s := range snapshots {
+		if resources != nil && !resources[s.ResourceID] {
+			continue
+		}
+		if !strings.HasPrefix(s.Name, p.Scope.NamePrefix) {
+			continue
+		}
+		candidates = append(candidates, RetentionCandidate{Snapshot: s})
+		droplets[s.ResourceID] = true
+	}
+
+	if !p.Scope.CountBackups {
+		return candidates, nil
+	}
+
+	for id := range resources {
+		droplets[id] = true
+	}
+	for id := range droplets {
+		dropletID, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+		err = forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+			backups, resp, err := client.Droplets.Backups(ctx, dropletID, opt)
+			for _, b := range backups {
+				candidates = append(candidates, RetentionCandidate{
+					Snapshot: godo.Snapshot{
+						ID:            strconv.Itoa(b.ID),
+						Name:          b.Name,
+						ResourceID:    id,
+						ResourceType:  RetentionDroplets,
+						Regions:       b.Regions,
+						MinDiskSize:   b.MinDiskSize,
+						SizeGigaBytes: b.SizeGigaBytes,
+						Created:       b.Created,
+					},
+					Backup: true,
+				})
+			}
+			return resp, err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return candidates, nil
+}
+
+func (p *RetentionPolicy) takeSnapshot(ctx context.Context, client *godo.Client, resourceID, name string) (*godo.Snapshot, error) {
+	if p.Scope.ResourceType == RetentionVolumes {
+		s, _, err := client.Storage.CreateSnapshot(ctx, &godo.SnapshotCreateRequest{
+			VolumeID: resourceID,
+			Name:     name,
+		})
+		return s, err
+	}
+
+	dropletID, err := strconv.Atoi(resourceID)
+	if err != nil {
+		return nil, err
+	}
+	action, _, err := client.DropletActions.Snapshot(ctx, dropletID, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitForDropletAction(ctx, client, dropletID, action); err != nil {
+		return nil, err
+	}
+
+	// The snapshot action does not report the image it creates, so find it
+	// by name among the droplet's snapshots.
+	var image *godo.Image
+	err = forEachPage(func(opt *godo.ListOptions) (*godo.Response, error) {
+		images, resp, err := client.Droplets.Snapshots(ctx, dropletID, opt)
+		for i := range images {
+			if images[i].Name != name {
+				continue
+			}
+			if image == nil || createdAt(images[i].Created).After(createdAt(image.Created)) {
+				image = &images[i]
+			}
+		}
+		return resp, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if image == nil {
+		return nil, fmt.Errorf("snapshot %q of droplet %d not found", name, dropletID)
+	}
+
+	return &godo.Snapshot{
+		ID:            strconv.Itoa(image.ID),
+		Name:          image.Name,
+		ResourceID:    resourceID,
+		ResourceType:  RetentionDroplets,
+		Regions:       image.Regions,
+		MinDiskSize:   image.MinDiskSize,
+		SizeGigaBytes: image.SizeGigaBytes,
+		Created:       image.Created,
+	}, nil
+}
+
+// retentionPeriods maps rule names to a function returning the period a
+// time falls in.
+var retentionPeriods = []struct {
+	name   string
+	count  func(RetentionRule) int
+	period func(time.Time) string
+}{
+	{"last", func(r RetentionRule) int { return r.Last }, nil},
+	{"hourly", func(r RetentionRule) int { return r.Hourly }, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+	{"daily", func(r RetentionRule) int { return r.Daily }, func(t time.Time) string { return t.Format("2006-01-02") }},
+	{"weekly", func(r RetentionRule) int { return r.Weekly }, func(t time.Time) string {
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	}},
+	{"monthly", func(r RetentionRule) int { return r.Monthly }, func(t time.Time) string { return t.Format("2006-01") }},
+}
+
+// apply splits the snapshots of a single resource into those to keep and
+// those to delete. Backups are never deleted.
+func (r RetentionRule) apply(candidates []RetentionCandidate) (keep, del []RetentionCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return createdAt(candidates[i].Snapshot.Created).After(createdAt(candidates[j].Snapshot.Created))
+	})
+
+	for _, p := range retentionPeriods {
+		n := p.count(r)
+		seen := make(map[string]bool)
+		for i := range candidates {
+			if len(seen) >= n {
+				break
+			}
+			key := strconv.Itoa(i)
+			if p.period != nil {
+				key = p.period(createdAt(candidates[i].Snapshot.Created).UTC())
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			candidates[i].Reasons = append(candidates[i].Reasons, p.name)
+		}
+	}
+
+	for _, c := range candidates {
+		switch {
+		case len(c.Reasons) > 0:
+			keep = append(keep, c)
+		case c.Backup:
+			c.Reasons = []string{"backup"}
+			keep = append(keep, c)
+		default:
+			del = append(del, c)
+		}
+	}
+	return keep, del
+}
+
+func deleteSnapshots(ctx context.Context, client *godo.Client, candidates []RetentionCandidate) error {
+	for _, c := range candidates {
+		if c.Backup {
+			continue
+		}
+		if _, err := client.Snapshots.Delete(ctx, c.Snapshot.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
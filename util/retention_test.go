@@ -0,0 +1,239 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestRetentionRule_Apply(t *testing.T) {
+	created := []string{
+		"2020-10-19T12:00:00Z", // 0 newest
+		"2020-10-19T11:30:00Z", // 1 same hour as 2
+		"2020-10-19T11:00:00Z", // 2
+		"2020-10-18T09:00:00Z", // 3 previous day
+		"2020-10-05T09:00:00Z", // 4 two weeks back
+		"2020-09-30T09:00:00Z", // 5 previous month
+		"2020-08-01T09:00:00Z", // 6
+	}
+	var candidates []RetentionCandidate
+	for i, c := range created {
+		candidates = append(candidates, RetentionCandidate{Snapshot: godo.Snapshot{ID: fmt.Sprint(i), Created: c}})
+	}
+
+	rule := RetentionRule{Hourly: 2, Daily: 2, Weekly: 3, Monthly: 2}
+	keep, del := rule.apply(candidates)
+
+	var kept, deleted []string
+	for _, c := range keep {
+		kept = append(kept, c.Snapshot.ID)
+	}
+	for _, c := range del {
+		deleted = append(deleted, c.Snapshot.ID)
+	}
+
+	if want := []string{"0", "1", "3", "4", "5"}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+	if want := []string{"2", "6"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted %v, want %v", deleted, want)
+	}
+	if want := []string{"hourly", "daily", "weekly", "monthly"}; !reflect.DeepEqual(keep[0].Reasons, want) {
+		t.Errorf("reasons %v, want %v", keep[0].Reasons, want)
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		if r.URL.Query().Get("resource_type") != "droplet" {
+			t.Errorf("expected droplet snapshots, got %q", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"snapshots": [
+			{"id": "1", "name": "nightly-a", "resource_id": "10", "created_at": "2020-10-19T00:00:00Z"},
+			{"id": "2", "name": "nightly-b", "resource_id": "10", "created_at": "2020-10-18T00:00:00Z"},
+			{"id": "3", "name": "nightly-c", "resource_id": "10", "created_at": "2020-10-17T00:00:00Z"},
+			{"id": "4", "name": "manual", "resource_id": "10", "created_at": "2020-10-16T00:00:00Z"},
+			{"id": "5", "name": "nightly-d", "resource_id": "20", "created_at": "2020-10-10T00:00:00Z"}
+		]}`)
+	})
+	mux.HandleFunc("/v2/droplets/10/backups", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"backups": [{"id": 99, "name": "backup", "created_at": "2020-10-19T06:00:00Z"}]}`)
+	})
+	mux.HandleFunc("/v2/droplets/20/backups", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"backups": []}`)
+	})
+	var deleted []string
+	mux.HandleFunc("/v2/snapshots/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/snapshots/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	policy := &RetentionPolicy{
+		Scope: RetentionScope{
+			ResourceType: RetentionDroplets,
+			NamePrefix:   "nightly-",
+			CountBackups: true,
+		},
+		Rule: RetentionRule{Daily: 2},
+	}
+
+	plan, err := PruneSnapshots(ctx, client, policy, true)
+	if err != nil {
+		t.Fatalf("PruneSnapshots returned error: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("dry run deleted snapshots %v", deleted)
+	}
+	if got := plan.String(); !strings.Contains(got, "delete 1 nightly-a") || !strings.Contains(got, "delete 3 nightly-c") {
+		t.Errorf("unexpected plan output:\n%s", got)
+	}
+
+	if _, err := PruneSnapshots(ctx, client, policy, false); err != nil {
+		t.Fatalf("PruneSnapshots returned error: %v", err)
+	}
+	// The backup taken later on the 19th occupies that day's slot.
+	sort.Strings(deleted)
+	if want := []string{"1", "3"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted %v, want %v", deleted, want)
+	}
+}
+
+func TestRunRetention_Volumes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	mux.HandleFunc("/v2/volumes", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"volumes": [
+			{"id": "vol-1", "tags": ["db"]},
+			{"id": "vol-2", "tags": ["scratch"]}
+		]}`)
+	})
+	var created []string
+	mux.HandleFunc("/v2/volumes/vol-1/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		req := new(godo.SnapshotCreateRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		if !strings.HasPrefix(req.Name, "auto-") {
+			t.Errorf("unexpected snapshot name %q", req.Name)
+		}
+		created = append(created, req.VolumeID)
+		fmt.Fprintf(w, `{"snapshot": {"id": "new", "name": %q, "resource_id": "vol-1"}}`, req.Name)
+	})
+	mux.HandleFunc("/v2/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"snapshots": [
+			{"id": "a", "name": "auto-1", "resource_id": "vol-1", "created_at": "2020-10-19T00:00:00Z"},
+			{"id": "b", "name": "auto-2", "resource_id": "vol-1", "created_at": "2020-10-18T00:00:00Z"},
+			{"id": "c", "name": "auto-3", "resource_id": "vol-2", "created_at": "2020-10-01T00:00:00Z"}
+		]}`)
+	})
+	var deleted []string
+	mux.HandleFunc("/v2/snapshots/", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodDelete)
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v2/snapshots/"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	policy := &RetentionPolicy{
+		Scope: RetentionScope{ResourceType: RetentionVolumes, Tag: "db", NamePrefix: "auto-"},
+		Rule:  RetentionRule{Last: 1},
+	}
+
+	plan, err := RunRetention(ctx, client, policy, false)
+	if err != nil {
+		t.Fatalf("RunRetention returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(created, []string{"vol-1"}) {
+		t.Errorf("created snapshots for %v, want [vol-1]", created)
+	}
+	if len(plan.Created) != 1 {
+		t.Errorf("expected plan to record 1 created snapshot, got %d", len(plan.Created))
+	}
+	if !reflect.DeepEqual(deleted, []string{"b"}) {
+		t.Errorf("deleted %v, want [b]", deleted)
+	}
+}
+
+func TestRunRetention_Droplets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	var name string
+	mux.HandleFunc("/v2/droplets/10/actions", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodPost)
+		v := make(map[string]interface{})
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Fatalf("decode json: %v", err)
+		}
+		name, _ = v["name"].(string)
+		fmt.Fprint(w, `{"action": {"id": 1, "status": "in-progress"}}`)
+	})
+	mux.HandleFunc("/v2/droplets/10/actions/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"action": {"id": 1, "status": "completed"}}`)
+	})
+	mux.HandleFunc("/v2/droplets/10/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, http.MethodGet)
+		fmt.Fprintf(w, `{"snapshots": [
+			{"id": 7, "name": "auto-old", "created_at": "2020-10-18T00:00:00Z"},
+			{"id": 8, "name": %q, "size_gigabytes": 2.5, "created_at": "2020-10-19T00:00:00Z"}
+		]}`, name)
+	})
+	mux.HandleFunc("/v2/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"snapshots": []}`)
+	})
+
+	policy := &RetentionPolicy{
+		Scope: RetentionScope{ResourceType: RetentionDroplets, ResourceIDs: []string{"10"}, NamePrefix: "auto-"},
+		Rule:  RetentionRule{Last: 1},
+	}
+
+	plan, err := RunRetention(ctx, client, policy, false)
+	if err != nil {
+		t.Fatalf("RunRetention returned error: %v", err)
+	}
+
+	expected := []godo.Snapshot{{
+		ID:            "8",
+		Name:          name,
+		ResourceID:    "10",
+		ResourceType:  RetentionDroplets,
+		SizeGigaBytes: 2.5,
+		Created:       "2020-10-19T00:00:00Z",
+	}}
+	if !reflect.DeepEqual(plan.Created, expected) {
+		t.Errorf("created %+v, want %+v", plan.Created, expected)
+	}
+}
+
+func TestRetentionPolicy_Validate(t *testing.T) {
+	tests := []*RetentionPolicy{
+		nil,
+		{Scope: RetentionScope{ResourceType: "image"}, Rule: RetentionRule{Last: 1}},
+		{Scope: RetentionScope{ResourceType: RetentionVolumes, CountBackups: true}, Rule: RetentionRule{Last: 1}},
+		{Scope: RetentionScope{ResourceType: RetentionDroplets}},
+		{Scope: RetentionScope{ResourceType: RetentionDroplets}, Rule: RetentionRule{Last: 1}},
+	}
+	for _, p := range tests {
+		if _, ok := p.validate().(*godo.ArgError); !ok {
+			t.Errorf("expected ArgError for %+v", p)
+		}
+	}
+
+	all := &RetentionPolicy{Scope: RetentionScope{ResourceType: RetentionDroplets, AllResources: true}, Rule: RetentionRule{Last: 1}}
+	if err := all.validate(); err != nil {
+		t.Errorf("validate returned error for an account-wide policy: %v", err)
+	}
+}
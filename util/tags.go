@@ -0,0 +1,13 @@
+package util
+
+// hasTag reports whether tags contains any of want.
+func hasTag(tags []string, want ...string) bool {
+	for _, t := range tags {
+		for _, w := range want {
+			if t == w {
+				return true
+			}
+		}
+	}
+	return false
+}
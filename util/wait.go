@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// sleep waits for the poll interval or until the context is done.
+func sleep(ctx context.Context) error {
+	select {
+	case <-time.After(pollInterval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForDropletStatus polls a droplet until it reports the given status.
+func waitForDropletStatus(ctx context.Context, client *godo.Client, dropletID int, status string) (*godo.Droplet, error) {
+	for {
+		droplet, _, err := client.Droplets.Get(ctx, dropletID)
+		if err != nil {
+			return nil, err
+		}
+		if droplet.Status == status {
+			return droplet, nil
+		}
+		if err := sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForAction polls an action through get until it is completed.
+func waitForAction(ctx context.Context, action *godo.Action, get func(actionID int) (*godo.Action, *godo.Response, error)) error {
+	for action.Status != godo.ActionCompleted {
+		if action.Status != godo.ActionInProgress {
+			return fmt.Errorf("%s action %d on %s %d ended with status: [%s]",
+				action.Type, action.ID, action.ResourceType, action.ResourceID, action.Status)
+		}
+		if err := sleep(ctx); err != nil {
+			return err
+		}
+
+		var err error
+		action, _, err = get(action.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForDropletAction polls a droplet action until it is completed.
+func waitForDropletAction(ctx context.Context, client *godo.Client, dropletID int, action *godo.Action) error {
+	return waitForAction(ctx, action, func(actionID int) (*godo.Action, *godo.Response, error) {
+		return client.DropletActions.Get(ctx, dropletID, actionID)
+	})
+}
+
+// waitForVolumeAction polls a volume action until it is completed.
+func waitForVolumeAction(ctx context.Context, client *godo.Client, volumeID string, action *godo.Action) error {
+	return waitForAction(ctx, action, func(actionID int) (*godo.Action, *godo.Response, error) {
+		return client.StorageActions.Get(ctx, volumeID, actionID)
+	})
+}
+
+// waitForFloatingIPAction polls a floating IP action until it is completed.
+func waitForFloatingIPAction(ctx context.Context, client *godo.Client, ip string, action *godo.Action) error {
+	return waitForAction(ctx, action, func(actionID int) (*godo.Action, *godo.Response, error) {
+		return client.FloatingIPActions.Get(ctx, ip, actionID)
+	})
+}